@@ -0,0 +1,509 @@
+package treeblood
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AsciiMath (https://asciimath.org) is translated into TeX, which is then rendered like any other TeX. This way,
+// AsciiMath shares the symbol table, post-processing, and output of TeX, and the TeX it was translated to is kept in
+// the annotation of the resulting <math> element.
+
+type amKind int
+
+const (
+	amConst  amKind = iota // a symbol written as is
+	amUnary                // a command taking one argument, such as sqrt
+	amBinary               // a command taking two arguments, such as frac
+	amLeft                 // an opening bracket
+	amRight                // a closing bracket
+	amPipe                 // |, which may open or close an absolute value
+	amDivide               // the infix /
+	amSub                  // _
+	amSup                  // ^
+	amText                 // "quoted text", text(...), or mbox(...)
+	amFunc                 // a function such as sin, which applies to the expression following it
+)
+
+type amSymbol struct {
+	tex  string
+	kind amKind
+}
+
+var (
+	asciiMathSymbols = map[string]amSymbol{
+		// Greek letters
+		"alpha": {`\alpha`, amConst}, "beta": {`\beta`, amConst}, "gamma": {`\gamma`, amConst},
+		"Gamma": {`\Gamma`, amConst}, "delta": {`\delta`, amConst}, "Delta": {`\Delta`, amConst},
+		"epsilon": {`\epsilon`, amConst}, "varepsilon": {`\varepsilon`, amConst}, "zeta": {`\zeta`, amConst},
+		"eta": {`\eta`, amConst}, "theta": {`\theta`, amConst}, "Theta": {`\Theta`, amConst},
+		"vartheta": {`\vartheta`, amConst}, "iota": {`\iota`, amConst}, "kappa": {`\kappa`, amConst},
+		"lambda": {`\lambda`, amConst}, "Lambda": {`\Lambda`, amConst}, "lamda": {`\lambda`, amConst},
+		"Lamda": {`\Lambda`, amConst}, "mu": {`\mu`, amConst}, "nu": {`\nu`, amConst}, "xi": {`\xi`, amConst},
+		"Xi": {`\Xi`, amConst}, "pi": {`\pi`, amConst}, "Pi": {`\Pi`, amConst}, "rho": {`\rho`, amConst},
+		"sigma": {`\sigma`, amConst}, "Sigma": {`\Sigma`, amConst}, "tau": {`\tau`, amConst},
+		"upsilon": {`\upsilon`, amConst}, "phi": {`\phi`, amConst}, "Phi": {`\Phi`, amConst},
+		"varphi": {`\varphi`, amConst}, "chi": {`\chi`, amConst}, "psi": {`\psi`, amConst}, "Psi": {`\Psi`, amConst},
+		"omega": {`\omega`, amConst}, "Omega": {`\Omega`, amConst},
+		// operators
+		"*": {`\cdot`, amConst}, "**": {`\ast`, amConst}, "***": {`\star`, amConst}, "//": {`/`, amConst},
+		`\\`: {`\backslash`, amConst}, "setminus": {`\setminus`, amConst}, "xx": {`\times`, amConst},
+		"|><": {`\ltimes`, amConst}, "><|": {`\rtimes`, amConst}, "|><|": {`\bowtie`, amConst},
+		"-:": {`\div`, amConst}, "divide": {`\div`, amConst}, "@": {`\circ`, amConst}, "o+": {`\oplus`, amConst},
+		"ox": {`\otimes`, amConst}, "o.": {`\odot`, amConst}, "sum": {`\sum`, amConst}, "prod": {`\prod`, amConst},
+		"^^": {`\wedge`, amConst}, "^^^": {`\bigwedge`, amConst}, "vv": {`\vee`, amConst},
+		"vvv": {`\bigvee`, amConst}, "nn": {`\cap`, amConst}, "nnn": {`\bigcap`, amConst}, "uu": {`\cup`, amConst},
+		"uuu": {`\bigcup`, amConst},
+		// relations
+		"!=": {`\neq`, amConst}, "<=": {`\leq`, amConst}, "lt=": {`\leq`, amConst}, ">=": {`\geq`, amConst},
+		"gt=": {`\geq`, amConst}, "lt": {`<`, amConst}, "gt": {`>`, amConst}, "mlt": {`\ll`, amConst},
+		"mgt": {`\gg`, amConst}, "-<": {`\prec`, amConst}, ">-": {`\succ`, amConst}, "-<=": {`\preceq`, amConst},
+		">-=": {`\succeq`, amConst}, "in": {`\in`, amConst}, "!in": {`\notin`, amConst}, "sub": {`\subset`, amConst},
+		"sup": {`\supset`, amConst}, "sube": {`\subseteq`, amConst}, "supe": {`\supseteq`, amConst},
+		"-=": {`\equiv`, amConst}, "~=": {`\cong`, amConst}, "~~": {`\approx`, amConst}, "~": {`\sim`, amConst},
+		"prop": {`\propto`, amConst},
+		// logic
+		"and": {`\text{ and }`, amConst}, "or": {`\text{ or }`, amConst}, "if": {`\text{ if }`, amConst},
+		"not": {`\neg`, amConst}, "=>": {`\Rightarrow`, amConst}, "implies": {`\Rightarrow`, amConst},
+		"<=>": {`\Leftrightarrow`, amConst}, "iff": {`\Leftrightarrow`, amConst}, "AA": {`\forall`, amConst},
+		"EE": {`\exists`, amConst}, "_|_": {`\bot`, amConst}, "TT": {`\top`, amConst}, "|--": {`\vdash`, amConst},
+		"|==": {`\models`, amConst},
+		// miscellaneous
+		"int": {`\int`, amConst}, "oint": {`\oint`, amConst}, "del": {`\partial`, amConst},
+		"grad": {`\nabla`, amConst}, "+-": {`\pm`, amConst}, "-+": {`\mp`, amConst}, "O/": {`\emptyset`, amConst},
+		"oo": {`\infty`, amConst}, "aleph": {`\aleph`, amConst}, ":.": {`\therefore`, amConst},
+		":'": {`\because`, amConst}, "/_": {`\angle`, amConst}, "/_\\": {`\triangle`, amConst},
+		`\ `: {`\ `, amConst}, "frown": {`\frown`, amConst}, "quad": {`\quad`, amConst},
+		"qquad": {`\qquad`, amConst}, "cdots": {`\cdots`, amConst}, "vdots": {`\vdots`, amConst},
+		"ldots": {`\ldots`, amConst}, "ddots": {`\ddots`, amConst}, "diamond": {`\diamond`, amConst},
+		"square": {`\square`, amConst}, "|__": {`\lfloor`, amConst}, "__|": {`\rfloor`, amConst},
+		"|~": {`\lceil`, amConst}, "~|": {`\rceil`, amConst}, "CC": {`\mathbb{C}`, amConst},
+		"NN": {`\mathbb{N}`, amConst}, "QQ": {`\mathbb{Q}`, amConst}, "RR": {`\mathbb{R}`, amConst},
+		"ZZ": {`\mathbb{Z}`, amConst},
+		// functions
+		"sin": {`\sin`, amFunc}, "cos": {`\cos`, amFunc}, "tan": {`\tan`, amFunc}, "sec": {`\sec`, amFunc},
+		"csc": {`\csc`, amFunc}, "cot": {`\cot`, amFunc}, "arcsin": {`\arcsin`, amFunc},
+		"arccos": {`\arccos`, amFunc}, "arctan": {`\arctan`, amFunc}, "sinh": {`\sinh`, amFunc},
+		"cosh": {`\cosh`, amFunc}, "tanh": {`\tanh`, amFunc}, "coth": {`\coth`, amFunc},
+		"sech": {`\mathop{sech}\nolimits`, amFunc}, "csch": {`\mathop{csch}\nolimits`, amFunc},
+		"exp": {`\exp`, amFunc}, "log": {`\log`, amFunc}, "ln": {`\ln`, amFunc}, "det": {`\det`, amFunc},
+		"dim": {`\dim`, amFunc}, "mod": {`\mathop{mod}\nolimits`, amConst}, "gcd": {`\gcd`, amFunc},
+		"lcm": {`\mathop{lcm}\nolimits`, amFunc}, "lub": {`\mathop{lub}`, amConst},
+		"glb": {`\mathop{glb}`, amConst}, "min": {`\min`, amConst}, "max": {`\max`, amConst},
+		"lim": {`\lim`, amConst}, "Lim": {`\mathop{Lim}`, amConst},
+		// arrows
+		"uarr": {`\uparrow`, amConst}, "darr": {`\downarrow`, amConst}, "rarr": {`\rightarrow`, amConst},
+		"->": {`\to`, amConst}, ">->": {`\rightarrowtail`, amConst}, "->>": {`\twoheadrightarrow`, amConst},
+		">->>": {`\twoheadrightarrowtail`, amConst}, "|->": {`\mapsto`, amConst}, "larr": {`\leftarrow`, amConst},
+		"harr": {`\leftrightarrow`, amConst}, "rArr": {`\Rightarrow`, amConst}, "lArr": {`\Leftarrow`, amConst},
+		"hArr": {`\Leftrightarrow`, amConst},
+		// accents, fonts, and other commands of one argument
+		"hat": {`\hat`, amUnary}, "bar": {`\overline`, amUnary}, "overline": {`\overline`, amUnary},
+		"ul": {`\underline`, amUnary}, "underline": {`\underline`, amUnary}, "vec": {`\vec`, amUnary},
+		"tilde": {`\tilde`, amUnary}, "dot": {`\dot`, amUnary}, "ddot": {`\ddot`, amUnary},
+		"obrace": {`\overbrace`, amUnary}, "overbrace": {`\overbrace`, amUnary}, "ubrace": {`\underbrace`, amUnary},
+		"underbrace": {`\underbrace`, amUnary}, "cancel": {`\cancel`, amUnary}, "sqrt": {`\sqrt`, amUnary},
+		"bb": {`\mathbf`, amUnary}, "bbb": {`\mathbb`, amUnary}, "cc": {`\mathcal`, amUnary},
+		"tt": {`\mathtt`, amUnary}, "fr": {`\mathfrak`, amUnary}, "sf": {`\mathsf`, amUnary},
+		"rm": {`\mathrm`, amUnary}, "abs": {`|`, amUnary}, "floor": {`\lfloor`, amUnary},
+		"ceil": {`\lceil`, amUnary}, "norm": {`\lVert`, amUnary},
+		"text": {`\text`, amText}, "mbox": {`\text`, amText},
+		// commands of two arguments
+		"frac": {`\frac`, amBinary}, "root": {`\sqrt`, amBinary}, "stackrel": {`\overset`, amBinary},
+		"overset": {`\overset`, amBinary}, "underset": {`\underset`, amBinary}, "color": {`\textcolor`, amBinary},
+		// brackets
+		"(": {`(`, amLeft}, ")": {`)`, amRight}, "[": {`[`, amLeft}, "]": {`]`, amRight},
+		"{": {`\{`, amLeft}, "}": {`\}`, amRight}, "(:": {`\langle`, amLeft}, ":)": {`\rangle`, amRight},
+		"<<": {`\langle`, amLeft}, ">>": {`\rangle`, amRight}, "{:": {`.`, amLeft}, ":}": {`.`, amRight},
+		"|": {`|`, amPipe},
+		// scripts and fractions
+		"/": {`/`, amDivide}, "_": {`_`, amSub}, "^": {`^`, amSup},
+		// differentials, each a single operand so that dy/dx is a fraction
+		"dx": {`{dx}`, amConst}, "dy": {`{dy}`, amConst}, "dz": {`{dz}`, amConst}, "dt": {`{dt}`, amConst},
+	}
+	// the closing delimiters of the functions written as brackets around their argument
+	asciiMathFences = map[string]string{
+		"|":       "|",
+		`\lfloor`: `\rfloor`,
+		`\lceil`:  `\rceil`,
+		`\lVert`:  `\rVert`,
+	}
+	asciiMathLongest = func() int {
+		longest := 0
+		for s := range asciiMathSymbols {
+			longest = max(longest, len(s))
+		}
+		return longest
+	}()
+)
+
+// An amToken is a single symbol, number, letter, or piece of text in AsciiMath.
+type amToken struct {
+	input string
+	amSymbol
+}
+
+func tokenizeAsciiMath(expr string) []amToken {
+	var toks []amToken
+	for i := 0; i < len(expr); {
+		r, size := utf8.DecodeRuneInString(expr[i:])
+		if unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+		if r == '"' {
+			end := strings.IndexByte(expr[i+1:], '"')
+			if end < 0 {
+				end = len(expr) - i - 1
+			}
+			toks = append(toks, amToken{expr[i+1 : i+1+end], amSymbol{`\text`, amText}})
+			i += end + 2
+			continue
+		}
+		if unicode.IsDigit(r) {
+			j := i
+			for j < len(expr) && (expr[j] >= '0' && expr[j] <= '9' || expr[j] == '.' && j+1 < len(expr) && expr[j+1] >= '0' && expr[j+1] <= '9') {
+				j++
+			}
+			toks = append(toks, amToken{expr[i:j], amSymbol{expr[i:j], amConst}})
+			i = j
+			continue
+		}
+		found := false
+		for l := min(asciiMathLongest, len(expr)-i); l > 0; l-- {
+			sym, ok := asciiMathSymbols[expr[i:i+l]]
+			if !ok {
+				continue
+			}
+			found = true
+			if sym.kind == amText {
+				// the argument of text(...) is taken literally
+				j := i + l
+				for j < len(expr) && expr[j] == ' ' {
+					j++
+				}
+				if j < len(expr) && expr[j] == '(' {
+					depth := 0
+					k := j
+					for ; k < len(expr); k++ {
+						if expr[k] == '(' {
+							depth++
+						} else if expr[k] == ')' {
+							depth--
+							if depth == 0 {
+								break
+							}
+						}
+					}
+					toks = append(toks, amToken{expr[j+1 : min(k, len(expr))], sym})
+					i = k + 1
+					break
+				}
+				sym = amSymbol{expr[i : i+l], amConst}
+			}
+			toks = append(toks, amToken{expr[i : i+l], sym})
+			i += l
+			break
+		}
+		if found {
+			continue
+		}
+		tex := string(r)
+		switch r {
+		case '#', '$', '%', '&':
+			tex = `\` + tex
+		case '\\':
+			tex = `\backslash`
+		}
+		toks = append(toks, amToken{string(r), amSymbol{tex, amConst}})
+		i += size
+	}
+	return toks
+}
+
+// An amExpr is a parsed piece of AsciiMath.
+type amExpr struct {
+	tex         string
+	bracketed   bool
+	open, close amToken   // the brackets, if bracketed
+	items       []*amExpr // the contents of the brackets
+	comma       bool      // the expression is a comma
+}
+
+// inner returns the TeX for e without any enclosing brackets, as taken by the arguments of commands and scripts.
+func (e *amExpr) inner() string {
+	if e == nil {
+		return ""
+	}
+	if e.bracketed {
+		switch e.open.input {
+		case "(", "[", "{", "{:":
+			return joinAsciiMath(e.items)
+		}
+	}
+	return e.tex
+}
+
+func joinAsciiMath(items []*amExpr) string {
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = item.tex
+	}
+	return strings.Join(parts, " ")
+}
+
+type amParser struct {
+	toks []amToken
+	pos  int
+}
+
+func (p *amParser) peek() *amToken {
+	if p.pos < len(p.toks) {
+		return &p.toks[p.pos]
+	}
+	return nil
+}
+
+// expression parses a sequence of terms, up to a closing bracket. If pipe is set, a | also ends the sequence.
+func (p *amParser) expression(top, pipe bool) []*amExpr {
+	var items []*amExpr
+	for t := p.peek(); t != nil; t = p.peek() {
+		if t.kind == amRight && !top || t.kind == amPipe && pipe {
+			break
+		}
+		term := p.intermediate()
+		if term == nil {
+			break
+		}
+		if next := p.peek(); next != nil && next.kind == amDivide {
+			p.pos++
+			denominator := p.intermediate()
+			term = &amExpr{tex: `\frac{` + term.inner() + `}{` + denominator.inner() + `}`}
+		}
+		items = append(items, term)
+	}
+	return items
+}
+
+// intermediate parses a simple expression with an optional subscript and superscript.
+func (p *amParser) intermediate() *amExpr {
+	base := p.simple()
+	if base == nil {
+		return nil
+	}
+	var sub, sup bool
+	for t := p.peek(); t != nil && (t.kind == amSub && !sub || t.kind == amSup && !sup); t = p.peek() {
+		p.pos++
+		script := p.simple()
+		if t.kind == amSub {
+			sub = true
+		} else {
+			sup = true
+		}
+		base = &amExpr{tex: base.tex + t.tex + "{" + script.inner() + "}"}
+	}
+	return base
+}
+
+// simple parses a single symbol, a bracketed expression, or a command with its arguments.
+func (p *amParser) simple() *amExpr {
+	t := p.peek()
+	if t == nil {
+		return nil
+	}
+	p.pos++
+	switch t.kind {
+	case amLeft:
+		return p.bracket(*t, p.expression(false, false))
+	case amPipe:
+		if p.closesPipe() {
+			return p.bracket(*t, p.expression(false, true))
+		}
+		return &amExpr{tex: `\mid`}
+	case amUnary:
+		arg := p.simple()
+		if arg == nil {
+			// an empty argument, which TeX does not accept for every command
+			arg = &amExpr{tex: `\phantom{}`}
+		}
+		if closer, ok := asciiMathFences[t.tex]; ok {
+			return &amExpr{tex: `\left` + t.tex + " " + arg.inner() + ` \right` + closer}
+		}
+		return &amExpr{tex: t.tex + "{" + arg.inner() + "}"}
+	case amBinary:
+		a, b := p.simple(), p.simple()
+		switch t.input {
+		case "root":
+			return &amExpr{tex: `\sqrt[` + a.inner() + "]{" + b.inner() + "}"}
+		case "color":
+			return &amExpr{tex: t.tex + "{" + strings.ReplaceAll(a.inner(), " ", "") + "}{" + b.inner() + "}"}
+		}
+		return &amExpr{tex: t.tex + "{" + a.inner() + "}{" + b.inner() + "}"}
+	case amFunc:
+		// a function keeps the brackets around its argument, and takes scripts of its own, as in sin^2 x
+		if next := p.peek(); next == nil || next.kind == amSub || next.kind == amSup || next.kind == amRight {
+			return &amExpr{tex: t.tex}
+		}
+		arg := p.simple()
+		return &amExpr{tex: t.tex + " " + arg.tex}
+	case amText:
+		return &amExpr{tex: `\text{` + escapeTextTeX(t.input) + "}"}
+	case amRight, amDivide, amSub, amSup:
+		// out of place, so written as an ordinary symbol
+		tex := t.tex
+		if t.kind == amRight {
+			tex = asciiMathSymbols[t.input].tex
+			if tex == "." {
+				tex = ""
+			}
+		}
+		return &amExpr{tex: tex}
+	}
+	return &amExpr{tex: t.tex, comma: t.input == ","}
+}
+
+// closesPipe reports whether a | at the same level of brackets follows the current position.
+func (p *amParser) closesPipe() bool {
+	depth := 0
+	for _, t := range p.toks[p.pos:] {
+		switch t.kind {
+		case amLeft:
+			depth++
+		case amRight:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case amPipe:
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bracket completes a bracketed expression whose opening bracket and contents have been parsed.
+func (p *amParser) bracket(open amToken, items []*amExpr) *amExpr {
+	e := &amExpr{bracketed: true, open: open, items: items}
+	closeTex := "."
+	if t := p.peek(); t != nil && (t.kind == amRight || t.kind == amPipe) {
+		e.close = *t
+		closeTex = t.tex
+		p.pos++
+	}
+	var sb strings.Builder
+	sb.WriteString(`\left`)
+	sb.WriteString(open.tex)
+	sb.WriteByte(' ')
+	if rows, ok := asciiMathMatrix(items); ok {
+		sb.WriteString(`\begin{matrix} `)
+		for i, row := range rows {
+			if i > 0 {
+				sb.WriteString(` \\ `)
+			}
+			sb.WriteString(strings.Join(row, " & "))
+		}
+		sb.WriteString(` \end{matrix}`)
+	} else {
+		sb.WriteString(joinAsciiMath(items))
+	}
+	sb.WriteString(` \right`)
+	sb.WriteString(closeTex)
+	e.tex = sb.String()
+	return e
+}
+
+// asciiMathMatrix reports whether items, the contents of a bracket, are the rows of a matrix, such as [[a,b],[c,d]],
+// and if so returns the TeX for each of its cells. Every row must be enclosed in the same (round or square) brackets
+// and have the same number of cells, and there must be more than one row.
+func asciiMathMatrix(items []*amExpr) ([][]string, bool) {
+	if len(items) < 3 || len(items)%2 == 0 {
+		return nil, false
+	}
+	var rows [][]string
+	for i, item := range items {
+		if i%2 == 1 {
+			if !item.comma {
+				return nil, false
+			}
+			continue
+		}
+		if !item.bracketed || item.open.input != items[0].open.input || item.close.input != items[0].close.input {
+			return nil, false
+		}
+		if item.open.input != "(" && item.open.input != "[" {
+			return nil, false
+		}
+		row := []string{}
+		var cell []*amExpr
+		for _, c := range item.items {
+			if c.comma {
+				row = append(row, joinAsciiMath(cell))
+				cell = nil
+				continue
+			}
+			cell = append(cell, c)
+		}
+		row = append(row, joinAsciiMath(cell))
+		if len(rows) > 0 && len(row) != len(rows[0]) {
+			return nil, false
+		}
+		rows = append(rows, row)
+	}
+	return rows, true
+}
+
+// escapeTextTeX escapes the characters of s that have a special meaning in TeX.
+func escapeTextTeX(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '#', '$', '%', '&', '_', '{', '}':
+			sb.WriteByte('\\')
+		case '\\':
+			sb.WriteString(`\backslash `)
+			continue
+		case '~':
+			sb.WriteString(`\textasciitilde `)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// asciiMathToTeX translates the AsciiMath expr into TeX.
+func asciiMathToTeX(expr string) string {
+	p := amParser{toks: tokenizeAsciiMath(expr)}
+	return joinAsciiMath(p.expression(true, false))
+}
+
+// AsciiMath renders the AsciiMath expr as MathML, in displaystyle if display is true. The expression is translated to
+// TeX, which is recorded in the annotation of the <math> element alongside the original AsciiMath.
+func (pitz *Pitziil) AsciiMath(expr string, display bool) (string, error) {
+	var indent int
+	if pitz.PrintOneLine {
+		indent = -1
+	}
+	ast, rc, err := pitz.renderAST(asciiMathToTeX(expr), display)
+	if ast == nil {
+		return "", err
+	}
+	pitz.resolveLabels(rc.pending)
+	pitz.speakMath(ast)
+	if len(ast.Children) > 0 && ast.Children[0].Tag == "semantics" {
+		semantics := ast.Children[0]
+		annotation := NewMMLNode("annotation", textEscaper.Replace(expr)).SetAttr("encoding", "text/x-asciimath")
+		last := len(semantics.Children) - 1
+		semantics.Children = append(semantics.Children[:last], annotation, semantics.Children[last])
+	}
+	var builder strings.Builder
+	builder.WriteRune('\n')
+	if werr := pitz.writeMath(&builder, ast, indent); werr != nil {
+		err = werr
+	}
+	builder.WriteRune('\n')
+	return builder.String(), err
+}
@@ -1,6 +1,12 @@
 package treeblood
 
-import "unicode"
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
 
 func cmd_multirow(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
 	var attr string
@@ -91,24 +97,70 @@ func cmd_sideset(pitz *Pitziil, name string, star bool, ctx parseContext, args [
 }
 
 func cmd_textcolor(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
+	color, bad := pitz.colorArg(name, args[0])
+	if bad != nil {
+		return bad
+	}
 	n := pitz.ParseTex(args[1], ctx)
-	n.SetAttr("mathcolor", StringifyTokens(args[0].Expr))
+	n.SetAttr("mathcolor", color)
 	return n
 }
 
+// relations is the set of <mo> texts that are spaced as relations.
+var relations = sync.OnceValue(func() map[string]bool {
+	rels := map[string]bool{"=": true, "<": true, ">": true}
+	for _, sym := range symbolTable {
+		if sym.kind == sym_relation && sym.char != "" {
+			rels[sym.char] = true
+		}
+	}
+	return rels
+})
+
+// isRelation reports whether the operator n is spaced as a relation.
+func isRelation(n *MMLNode) bool {
+	return relations()[nodeText(n)]
+}
+
+// cmd_undersetOverset sets one or two expressions over and under a base. When the base is an operator, the result is
+// an embellished operator spaced like the base, so that \overset{*}{+} is a binary operator and \overset{!}{=} a
+// relation. \stackrel is a relation whatever its base.
 func cmd_undersetOverset(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
-	var base, embellishment *MMLNode
-	base = pitz.ParseTex(args[1], ctx&^ctxChemical)
-	embellishment = pitz.ParseTex(args[0], ctx&^ctxChemical)
+	var base, under, over *MMLNode
+	base = pitz.ParseTex(args[len(args)-1], ctx&^ctxChemical)
 	if base.Tag == "mo" {
 		base.SetTrue("stretchy")
 	}
-	tag := "munder"
-	if name == "overset" {
-		tag = "mover"
+	switch name {
+	case "overset", "stackrel":
+		over = pitz.ParseTex(args[0], ctx&^ctxChemical)
+	case "underset":
+		under = pitz.ParseTex(args[0], ctx&^ctxChemical)
+	case "overunderset":
+		over = pitz.ParseTex(args[0], ctx&^ctxChemical)
+		under = pitz.ParseTex(args[1], ctx&^ctxChemical)
+	case "underoverset":
+		under = pitz.ParseTex(args[0], ctx&^ctxChemical)
+		over = pitz.ParseTex(args[1], ctx&^ctxChemical)
+	}
+	var underover *MMLNode
+	switch {
+	case under != nil && over != nil:
+		underover = NewMMLNode("munderover").AppendChild(base, under, over)
+	case under != nil:
+		underover = NewMMLNode("munder").AppendChild(base, under)
+	default:
+		underover = NewMMLNode("mover").AppendChild(base, over)
 	}
-	underover := NewMMLNode(tag)
-	underover.AppendChild(base, embellishment)
+	if name == "stackrel" && !(base.Tag == "mo" && isRelation(base)) {
+		// the base loses its own spacing and the whole is padded like a relation
+		if base.Tag == "mo" {
+			base.SetAttr("lspace", "0").SetAttr("rspace", "0")
+		}
+		return NewMMLNode("mpadded").SetAttr("lspace", "0.2778em").SetAttr("width", "+0.5556em").AppendChild(underover)
+	}
+	// firefox needs the mrow to render stretchy fences around the result. As the only child of the mrow, the
+	// embellished operator is still spaced like its base.
 	n := NewMMLNode("mrow")
 	n.AppendChild(underover)
 	return n
@@ -143,12 +195,181 @@ func cmd_cancel(pitz *Pitziil, name string, star bool, ctx parseContext, args []
 	return n
 }
 
+// colorPattern matches the colors accepted by \color, \textcolor, \colorbox and \fcolorbox, which are written into
+// attributes and CSS: a color name, a hexadecimal color beginning with #, or one of the CSS functions rgb(), rgba(),
+// hsl() and hsla() with numeric arguments.
+var colorPattern = regexp.MustCompile(`^([A-Za-z]+|#([0-9A-Fa-f]{3,4}|[0-9A-Fa-f]{6}|[0-9A-Fa-f]{8})|(rgba?|hsla?)\(\s*[-+0-9.]+(%|deg)?(\s*[,/]?\s*[-+0-9.]+%?)*\s*\))$`)
+
+// validColor reports whether c is a color accepted by the color commands.
+func validColor(c string) bool {
+	return colorPattern.MatchString(c)
+}
+
+// colorArg returns the color given by the argument b of a color command, or an <merror> if it is not a valid color.
+func (pitz *Pitziil) colorArg(name string, b *TokenBuffer) (string, *MMLNode) {
+	var sb strings.Builder
+	for _, t := range b.Expr {
+		if t.Kind&tokMacroarg > 0 && t.Value != "#" {
+			// a hexadecimal color beginning with a digit is read as a macro parameter
+			sb.WriteByte('#')
+		}
+		sb.WriteString(t.Value)
+	}
+	c := strings.TrimSpace(sb.String())
+	if !validColor(c) {
+		return "", pitz.merror(DiagArgument, name, name+" expects a color name, a #hex color, or rgb(), rgba(), hsl() or hsla()")
+	}
+	return c, nil
+}
+
+// cmd_boxed draws a frame around its argument, which is math for \boxed and text for \fbox. \colorbox sets its text
+// on a colored background, and \fcolorbox does both, with the frame in the first color and the background in the
+// second.
+func cmd_boxed(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
+	content := args[len(args)-1]
+	if name != "boxed" {
+		ctx = textContext(ctx, "mbox")
+	}
+	colors := make([]string, len(args)-1)
+	for i := range colors {
+		var bad *MMLNode
+		if colors[i], bad = pitz.colorArg(name, args[i]); bad != nil {
+			return bad
+		}
+	}
+	var n *MMLNode
+	switch name {
+	case "colorbox":
+		// \fboxsep is 3pt
+		n = NewMMLNode("mpadded").SetAttr("width", "+0.6em").SetAttr("lspace", "0.3em")
+		n.SetAttr("height", "+0.3em").SetAttr("depth", "+0.3em")
+		n.SetAttr("mathbackground", colors[0])
+	case "fcolorbox":
+		n = NewMMLNode("menclose").SetAttr("notation", "box")
+		n.SetCssProp("border-color", colors[0])
+		n.SetAttr("mathbackground", colors[1])
+	default:
+		n = NewMMLNode("menclose").SetAttr("notation", "box")
+	}
+	pitz.ParseTex(content, ctx, n)
+	return n
+}
+
+// cmd_phantom takes up the space of its argument without drawing it. \hphantom keeps only the width and \vphantom
+// only the height and depth.
+func cmd_phantom(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
+	phantom := NewMMLNode("mphantom")
+	pitz.ParseTex(args[0], ctx, phantom)
+	switch name {
+	case "hphantom":
+		return NewMMLNode("mpadded").SetAttr("height", "0").SetAttr("depth", "0").AppendChild(phantom)
+	case "vphantom":
+		return NewMMLNode("mpadded").SetAttr("width", "0").AppendChild(phantom)
+	}
+	return phantom
+}
+
+// cmd_smash draws its argument as if it had no height and depth, or with [t] no height and with [b] no depth.
+func cmd_smash(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
+	n := NewMMLNode("mpadded")
+	var pos string
+	if opt != nil {
+		pos = strings.TrimSpace(StringifyTokens(opt.Expr))
+	}
+	switch pos {
+	case "t":
+		n.SetAttr("height", "0")
+	case "b":
+		n.SetAttr("depth", "0")
+	default:
+		n.SetAttr("height", "0").SetAttr("depth", "0")
+	}
+	pitz.ParseTex(args[0], ctx, n)
+	return n
+}
+
+// cmd_lap draws its argument as if it had no width, extending to the left of its position for \mathllap, to the right
+// for \mathrlap, and to both sides for \mathclap. The contents are moved left by a CSS transform, since MathML Core has
+// no lengths relative to the size of the contents.
+func cmd_lap(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
+	n := NewMMLNode("mpadded").SetAttr("width", "0")
+	var shift string
+	switch name {
+	case "mathllap":
+		shift = "-100%"
+	case "mathclap":
+		shift = "-50%"
+	default:
+		pitz.ParseTex(args[0], ctx, n)
+		return n
+	}
+	row := pitz.ParseTex(args[0], ctx, NewMMLNode("mrow"))
+	row.SetCssProp("transform", "translateX("+shift+")")
+	return n.AppendChild(row)
+}
+
 func cmd_mathop(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
 	n := NewMMLNode("mo", StringifyTokens(args[0].Expr)).SetAttr("rspace", "0")
 	n.Properties |= propLimitsunderover | propMovablelimits
 	return n
 }
 
+// cmd_operatorname sets its argument upright as the name of a function, like \sin. The starred form places limits
+// above and below the name in display style, like \lim. Runs of letters, digits, and the characters - and * (which are
+// set as text, as amsmath does) become a single identifier; anything else in the name is parsed as usual.
+func cmd_operatorname(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
+	var parts []*MMLNode
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			mi := NewMMLNode("mi", xmlEscaper.Replace(text.String()))
+			if utf8.RuneCountInString(text.String()) == 1 {
+				mi.SetAttr("mathvariant", "normal")
+			}
+			parts = append(parts, mi)
+			text.Reset()
+		}
+	}
+	toks := args[0].Expr
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch {
+		case t.Kind&(tokWhitespace|tokComment) > 0:
+		case t.Kind&(tokLetter|tokNumber) > 0, t.Kind&tokChar > 0 && (t.Value == "-" || t.Value == "*"):
+			text.WriteString(t.Value)
+		default:
+			flush()
+			// parse everything up to the next letter as a unit, keeping groups whole
+			j := i
+			for j < len(toks) && toks[j].Kind&(tokLetter|tokNumber) == 0 {
+				if toks[j].Kind&tokOpen > 0 && toks[j].MatchOffset > 0 {
+					j += toks[j].MatchOffset
+				}
+				j++
+			}
+			j = min(j, len(toks))
+			if n := pitz.ParseTex(NewTokenBuffer(toks[i:j]), ctx|ctxVarNormal); n != nil {
+				parts = append(parts, n)
+			}
+			i = j - 1
+		}
+	}
+	flush()
+	var n *MMLNode
+	if len(parts) == 1 {
+		n = parts[0]
+	} else {
+		n = NewMMLNode("mrow").AppendChild(parts...)
+	}
+	if len(parts) > 0 && parts[0].Tag == "mi" {
+		parts[0].SetAttr("lspace", "0.11111em")
+	}
+	if star {
+		n.Properties |= propMovablelimits | propLimitsunderover
+	}
+	return n
+}
+
 func cmd_mod(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
 	n := NewMMLNode("mrow")
 	if name == "pmod" {
@@ -198,14 +419,33 @@ func cmd_underOverBrace(pitz *Pitziil, name string, star bool, ctx parseContext,
 
 }
 
+func cmd_xarrow(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
+	arrow := x_arrows[name]
+	// the labels are padded so that the arrow extends past them, as the arrow stretches to the wider of the two
+	label := func(b *TokenBuffer) *MMLNode {
+		n := NewMMLNode("mrow")
+		n.AppendNew("mspace").SetAttr("width", arrow[1])
+		n.AppendChild(pitz.ParseTex(b, ctx))
+		n.AppendNew("mspace").SetAttr("width", arrow[2])
+		return n
+	}
+	n := NewMMLNode("mover").SetFalse("accent")
+	n.AppendNew("mo", arrow[0]).SetTrue("stretchy")
+	if opt != nil {
+		n.Tag = "munderover"
+		n.SetFalse("accentunder")
+		n.AppendChild(label(opt))
+	}
+	n.AppendChild(label(args[0]))
+	return n
+}
+
 //func cmd_ElsevierGlyph(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode
 //func cmd_ding(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode
-//func cmd_fbox(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode
-//func cmd_mbox(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode
 
 func cmd_not(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
 	if len(args[0].Expr) < 1 {
-		return NewMMLNode("merror", name).SetAttr("title", " requires an argument")
+		return pitz.merror(DiagArgument, name, " requires an argument")
 	} else if len(args[0].Expr) == 1 {
 		t := args[0].Expr[0]
 		sym, ok := symbolTable[t.Value]
@@ -244,10 +484,6 @@ func cmd_sqrt(pitz *Pitziil, name string, star bool, ctx parseContext, args []*T
 	return n
 }
 
-func cmd_text(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
-	return NewMMLNode("mtext", stringifyTokensHtml(args[0].Expr))
-}
-
 func cmd_frac(pitz *Pitziil, name string, star bool, ctx parseContext, args []*TokenBuffer, opt *TokenBuffer) *MMLNode {
 	// for a binomial coefficient, we need to wrap it in parentheses, so the "fraction" must
 	// be a child of parent, and parent must be an mrow.
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/bits"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -17,6 +18,9 @@ type CommandSpec struct {
 var (
 	// maps commands to number of expected arguments
 	command_args map[string]CommandSpec
+	// the forms accepted by \dv and family: an optional comma-separated list of orders, an optional function, the
+	// optional '/' and '!' modifiers, and a comma-separated list of variables.
+	derivative_args *extension
 	// Special properties of any identifiers accessed via a \command
 	command_identifiers = map[string]NodeProperties{
 		"arccos":   0,
@@ -75,6 +79,22 @@ var (
 		"mathsfsl":   ctxVarSans | ctxVarItalic,
 		"mathtt":     ctxVarMono,
 	}
+	// text commands and the font variants they select. See textContext.
+	text_commands = map[string]parseContext{
+		"text":       0,
+		"mbox":       0,
+		"hbox":       0,
+		"textnormal": 0,
+		"textrm":     0,
+		"textup":     0,
+		"textmd":     0,
+		"textbf":     ctxVarBold,
+		"textit":     ctxVarItalic,
+		"textsl":     ctxVarItalic,
+		"emph":       ctxVarItalic,
+		"textsf":     ctxVarSans,
+		"texttt":     ctxVarMono,
+	}
 	ctxSizeOffset int = bits.TrailingZeros64(uint64(ctxSize_1))
 	// TODO: Not really using context for switch commands
 	switches = map[string]parseContext{
@@ -122,41 +142,82 @@ var (
 	accents_below = map[string]rune{
 		"underline": 0x0332,
 	}
+	// extensible arrows: the arrow, and the space on either side of its labels, as given by amsmath and mathtools.
+	x_arrows = map[string][3]string{
+		"xrightarrow":      {"→", "0.2778em", "0.5em"},
+		"xleftarrow":       {"←", "0.5em", "0.2778em"},
+		"xleftrightarrow":  {"↔", "0.5em", "0.5em"},
+		"xRightarrow":      {"⇒", "0.2778em", "0.5em"},
+		"xLeftarrow":       {"⇐", "0.5em", "0.2778em"},
+		"xLeftrightarrow":  {"⇔", "0.5em", "0.5em"},
+		"xmapsto":          {"↦", "0.5em", "0.2778em"},
+		"xhookrightarrow":  {"↪", "0.2778em", "0.5em"},
+		"xhookleftarrow":   {"↩", "0.5em", "0.2778em"},
+		"xrightharpoonup":  {"⇀", "0.2778em", "0.5em"},
+		"xleftharpoonup":   {"↼", "0.5em", "0.2778em"},
+		"xrightleftarrows": {"⇄", "0.5em", "0.5em"},
+	}
 )
 
 func init() {
 	command_args = map[string]CommandSpec{
-		"multirow":    {F: cmd_multirow, argc: 3, optc: 0},
-		"multicolumn": {F: cmd_multirow, argc: 3, optc: 0},
-		"prescript":   {F: cmd_prescript, argc: 3, optc: 0},
-		"sideset":     {F: cmd_sideset, argc: 3, optc: 0},
-		"textcolor":   {F: cmd_textcolor, argc: 2, optc: 0},
-		"frac":        {F: cmd_frac, argc: 2, optc: 0},
-		"cfrac":       {F: cmd_frac, argc: 2, optc: 0},
-		"binom":       {F: cmd_frac, argc: 2, optc: 0},
-		"tbinom":      {F: cmd_frac, argc: 2, optc: 0},
-		"dfrac":       {F: cmd_frac, argc: 2, optc: 0},
-		"tfrac":       {F: cmd_frac, argc: 2, optc: 0},
-		"overset":     {F: cmd_undersetOverset, argc: 2, optc: 0},
-		"underset":    {F: cmd_undersetOverset, argc: 2, optc: 0},
-		"class":       {F: cmd_class, argc: 2, optc: 0},
-		"raisebox":    {F: cmd_raisebox, argc: 2, optc: 0},
-		"cancel":      {F: cmd_cancel, argc: 1, optc: 0},
-		"bcancel":     {F: cmd_cancel, argc: 1, optc: 0},
-		"xcancel":     {F: cmd_cancel, argc: 1, optc: 0},
-		"mathop":      {F: cmd_mathop, argc: 1, optc: 0},
-		"bmod":        {F: cmd_mod, argc: 1, optc: 0},
-		"pmod":        {F: cmd_mod, argc: 1, optc: 0},
-		"substack":    {F: cmd_substack, argc: 1, optc: 0},
-		"underbrace":  {F: cmd_underOverBrace, argc: 1, optc: 0},
-		"overbrace":   {F: cmd_underOverBrace, argc: 1, optc: 0},
+		"multirow":     {F: cmd_multirow, argc: 3, optc: 0},
+		"multicolumn":  {F: cmd_multirow, argc: 3, optc: 0},
+		"prescript":    {F: cmd_prescript, argc: 3, optc: 0},
+		"sideset":      {F: cmd_sideset, argc: 3, optc: 0},
+		"textcolor":    {F: cmd_textcolor, argc: 2, optc: 0},
+		"frac":         {F: cmd_frac, argc: 2, optc: 0},
+		"cfrac":        {F: cmd_frac, argc: 2, optc: 0},
+		"binom":        {F: cmd_frac, argc: 2, optc: 0},
+		"tbinom":       {F: cmd_frac, argc: 2, optc: 0},
+		"dfrac":        {F: cmd_frac, argc: 2, optc: 0},
+		"tfrac":        {F: cmd_frac, argc: 2, optc: 0},
+		"overset":      {F: cmd_undersetOverset, argc: 2, optc: 0},
+		"underset":     {F: cmd_undersetOverset, argc: 2, optc: 0},
+		"stackrel":     {F: cmd_undersetOverset, argc: 2, optc: 0},
+		"overunderset": {F: cmd_undersetOverset, argc: 3, optc: 0},
+		"underoverset": {F: cmd_undersetOverset, argc: 3, optc: 0},
+		"class":        {F: cmd_class, argc: 2, optc: 0},
+		"raisebox":     {F: cmd_raisebox, argc: 2, optc: 0},
+		"cancel":       {F: cmd_cancel, argc: 1, optc: 0},
+		"bcancel":      {F: cmd_cancel, argc: 1, optc: 0},
+		"xcancel":      {F: cmd_cancel, argc: 1, optc: 0},
+		"boxed":        {F: cmd_boxed, argc: 1, optc: 0},
+		"fbox":         {F: cmd_boxed, argc: 1, optc: 0},
+		"colorbox":     {F: cmd_boxed, argc: 2, optc: 0},
+		"fcolorbox":    {F: cmd_boxed, argc: 3, optc: 0},
+		"phantom":      {F: cmd_phantom, argc: 1, optc: 0},
+		"hphantom":     {F: cmd_phantom, argc: 1, optc: 0},
+		"vphantom":     {F: cmd_phantom, argc: 1, optc: 0},
+		"smash":        {F: cmd_smash, argc: 1, optc: 1},
+		"mathllap":     {F: cmd_lap, argc: 1, optc: 0},
+		"mathrlap":     {F: cmd_lap, argc: 1, optc: 0},
+		"mathclap":     {F: cmd_lap, argc: 1, optc: 0},
+		"mathop":       {F: cmd_mathop, argc: 1, optc: 0},
+		"operatorname": {F: cmd_operatorname, argc: 1, optc: 0},
+		"bmod":         {F: cmd_mod, argc: 1, optc: 0},
+		"pmod":         {F: cmd_mod, argc: 1, optc: 0},
+		"substack":     {F: cmd_substack, argc: 1, optc: 0},
+		"underbrace":   {F: cmd_underOverBrace, argc: 1, optc: 0},
+		"overbrace":    {F: cmd_underOverBrace, argc: 1, optc: 0},
 		//"ElsevierGlyph": {F: cmd_ElsevierGlyph, argc: 1, optc: 0},
 		//"ding":          {F: cmd_ding, argc: 1, optc: 0},
-		//"fbox":          {F: cmd_fbox, argc: 1, optc: 0},
-		//"mbox":          {F: cmd_mbox, argc: 1, optc: 0},
 		"not":  {F: cmd_not, argc: 1, optc: 0},
 		"sqrt": {F: cmd_sqrt, argc: 1, optc: 1},
-		"text": {F: cmd_text, argc: 1, optc: 0},
+	}
+	for name := range x_arrows {
+		command_args[name] = CommandSpec{F: cmd_xarrow, argc: 1, optc: 1}
+	}
+	derivative_args = &extension{}
+	for _, expr := range []CmdArgExpr{
+		"[,]? {} '/'? '!'? '/'? {,}",
+		"[,]? {,} '/'? '!'? '/'?",
+	} {
+		pattern, err := compileArgPattern(expr)
+		if err != nil {
+			panic(err)
+		}
+		derivative_args.patterns = append(derivative_args.patterns, pattern)
 	}
 }
 
@@ -267,10 +328,14 @@ func (pitz *Pitziil) ProcessCommand(context parseContext, tok Token, b *TokenBuf
 	name := tok.Value
 	// dv and family take a variable number of arguments so try them first
 	switch name {
-	//case "dv", "adv", "odv", "mdv", "fdv", "jdv", "pdv":
-	//	return pitz.doDerivative(name, star, context, q)
+	case "dv", "adv", "odv", "mdv", "fdv", "jdv", "pdv":
+		return pitz.doDerivative(name, star, context, b)
 	case "newcommand", "def", "renewcommand":
 		return pitz.newCommand(name, context, b)
+	case "DeclareMathOperator":
+		return pitz.declareMathOperator(star, b)
+	case "tag", "notag", "nonumber", "label", "ref", "eqref":
+		return pitz.equationLabel(name, star, b)
 	case "LaTeX":
 		return makeTexLogo(true)
 	case "TeX":
@@ -279,45 +344,44 @@ func (pitz *Pitziil) ProcessCommand(context parseContext, tok Token, b *TokenBuf
 	case "ce":
 		expr, err := b.GetNextExpr()
 		if err != nil {
-			logger.Println(err)
+			pitz.diagnose(SeverityWarning, DiagArgument, tok, "%s", err.Error())
 			return nil
 		}
 		chem, err := pitz.mhchem(expr, context)
 		if err != nil {
-			logger.Println(err)
+			pitz.diagnose(SeverityWarning, DiagSyntax, tok, "%s", err.Error())
 		}
 		return NewMMLNode("mrow").AppendChild(chem...)
 	}
-	if pitz.needMacroExpansion[name] {
-		macro := pitz.macros[name]
+	macro, ok := pitz.rc.needMacroExpansion[name]
+	if m, defined := pitz.rc.macros[name]; !ok && defined && m.Dynamic {
+		// defined with \newcommand in an earlier expression
+		macro, ok = m, true
+	}
+	if ok {
 		argc := macro.Argcount
 		args := make([]*TokenBuffer, argc)
 		var err error
 		for n := range argc {
 			args[n], err = b.GetNextExpr()
 			if err != nil {
-				n := NewMMLNode("merror", name)
-				n.SetAttr("title", "Error expanding macro")
-				logger.Println(err.Error())
-				return n
+				return pitz.merror(DiagMacro, name, "Error expanding macro: "+err.Error())
 			}
 		}
+		macro.Definition = relocate(macro.Definition, tok.start, tok.end)
 		temp, err := ExpandSingleMacro(macro, args)
 		if err != nil {
-			n := NewMMLNode("merror", name)
-			n.SetAttr("title", "Error expanding macro")
-			logger.Println(err.Error())
-			return n
+			return pitz.merror(DiagMacro, name, "Error expanding macro: "+err.Error())
 		}
 		temp, err = postProcessTokens(temp)
 		if err != nil {
-			n := NewMMLNode("merror", name)
-			n.SetAttr("title", "Error expanding macro")
-			logger.Println(err.Error())
-			return n
+			return pitz.merror(DiagMacro, name, "Error expanding macro: "+err.Error())
 		}
 		return pitz.ParseTex(NewTokenBuffer(temp), context)
 	}
+	if ext, ok := pitz.lookupExtension(name); ok {
+		return pitz.processExtension(context, tok, b, ext)
+	}
 	if prop, ok := command_identifiers[name]; ok {
 		n := NewMMLNode("mi")
 		n.Properties = prop
@@ -355,13 +419,23 @@ func (pitz *Pitziil) ProcessCommand(context parseContext, tok Token, b *TokenBuf
 			wrapper = NewMMLNode("mpadded").SetAttr("lspace", "0")
 		}
 		if err != nil {
-			logger.Printf("WARN: Expected an argument for math variant '%s'", name)
+			pitz.diagnose(SeverityWarning, DiagArgument, tok, "Expected an argument for math variant '%s'", name)
 			// treat the remainder of the buffer as argument
 			return pitz.ParseTex(b, context|variant, wrapper)
 
 		}
 		return pitz.ParseTex(nextExpr, context|variant, wrapper)
 	}
+	if _, ok := text_commands[name]; ok {
+		arg, err := b.GetNextExpr()
+		if errors.Is(err, ErrTokenBufferSingle) {
+			arg, err = b.GetNextN(1, true)
+		}
+		if err != nil {
+			return pitz.merror(DiagArgument, name, fmt.Sprintf("%s expects an argument", name))
+		}
+		return pitz.ParseTex(arg, textContext(context, name))
+	}
 	if width, ok := space_widths[name]; ok {
 		n := NewMMLNode("mspace")
 		n.Tok = tok
@@ -399,12 +473,16 @@ func (pitz *Pitziil) ProcessCommand(context parseContext, tok Token, b *TokenBuf
 		if name == "color" {
 			expr, err := switchExpressions.GetNextExpr()
 			if err == nil {
-				n.SetAttr("mathcolor", StringifyTokens(expr.Expr))
+				color, bad := pitz.colorArg(name, expr)
+				if bad != nil {
+					return bad
+				}
+				n.SetAttr("mathcolor", color)
 				pitz.ParseTex(switchExpressions, context|sw, n)
 				return n
 			}
 			b.Unget()
-			return NewMMLNode("merror", name).SetAttr("title", fmt.Sprintf("%s expects an argument", name))
+			return pitz.merror(DiagArgument, name, fmt.Sprintf("%s expects an argument", name))
 		}
 		pitz.ParseTex(switchExpressions, context|sw, n)
 		switch name {
@@ -476,10 +554,11 @@ func (pitz *Pitziil) ProcessCommand(context parseContext, tok Token, b *TokenBuf
 		n.AppendChild(base, acc)
 	} else {
 		if pitz.unknownCommandsAsOps {
-			logger.Printf("NOTE: unknown command '%s'. Treating as operator or function name.\n", name)
+			pitz.diagnose(SeverityNote, DiagUnknownCommand, tok, "unknown command '%s'. Treating as operator or function name.", name)
 			n = NewMMLNode("mo", tok.Value)
 		} else {
 			n = NewMMLNode("merror", tok.Value)
+			pitz.diagnoseNode(n, SeverityError, DiagUnknownCommand, fmt.Sprintf("unknown command '%s'", name))
 		}
 	}
 	n.Tok = tok
@@ -530,7 +609,7 @@ func makeSymbol(t symbol, tok Token, context parseContext) *MMLNode {
 func (pitz *Pitziil) processCommandArgs(context parseContext, name string, star bool, b *TokenBuffer, spec CommandSpec) *MMLNode {
 	args := make([]*TokenBuffer, 0)
 	if b.Empty() {
-		return NewMMLNode("merror", name).SetAttr("title", name+" requires one or more arguments")
+		return pitz.merror(DiagArgument, name, name+" requires one or more arguments")
 	}
 	opt, _ := b.GetOptions()
 	for !b.Empty() && len(args) < spec.argc {
@@ -545,7 +624,7 @@ func (pitz *Pitziil) processCommandArgs(context parseContext, name string, star
 		}
 	}
 	if len(args) != spec.argc {
-		return NewMMLNode("merror", name).SetAttr("title", "wrong number of arguments")
+		return pitz.merror(DiagArgument, name, "wrong number of arguments")
 	}
 	return spec.F(pitz, name, star, context, args, opt)
 }
@@ -555,9 +634,7 @@ func (pitz *Pitziil) newCommand(macroCommand string, context parseContext, b *To
 	var argcount int
 	var name string
 	makeMerror := func(msg string) *MMLNode {
-		n := NewMMLNode("merror", `\newcommand`)
-		n.SetAttr("title", msg)
-		return n
+		return pitz.merror(DiagMacro, `\newcommand`, msg)
 	}
 	t, err := b.GetNextToken()
 	if err == nil && t.Kind&tokCommand == 0 {
@@ -596,7 +673,6 @@ func (pitz *Pitziil) newCommand(macroCommand string, context parseContext, b *To
 	}
 	for _, t := range definition.Expr {
 		if t.Value == name && t.Kind&tokCommand > 0 {
-			logger.Println("Recursive macro definition detected")
 			errNode = makeMerror("Recursive macro definition detected")
 			return
 		}
@@ -610,188 +686,238 @@ func (pitz *Pitziil) newCommand(macroCommand string, context parseContext, b *To
 		Argcount:      argcount,
 		Dynamic:       true,
 	}
-	if _, ok := pitz.macros[name]; !ok || macroCommand != "newcommand" {
-		pitz.macros[name] = cmd
-		pitz.needMacroExpansion[name] = true
+	_, defined := pitz.rc.macros[name]
+	if _, ok := pitz.rc.needMacroExpansion[name]; ok {
+		defined = true
+	}
+	if !defined || macroCommand != "newcommand" {
+		pitz.rc.needMacroExpansion[name] = cmd
 	} else {
-		logger.Printf("WARN: macro %s was previously defined. The new definition will be ignored.", name)
+		pitz.diagnose(SeverityWarning, DiagMacro, t, "macro %s was previously defined. The new definition will be ignored.", name)
 	}
 	return
 }
 
+// declareMathOperator defines a command that expands to \operatorname (or \operatorname* if star is true) with the
+// given text, as \DeclareMathOperator does. Like commands defined with \newcommand, it is added to the document.
+func (pitz *Pitziil) declareMathOperator(star bool, b *TokenBuffer) *MMLNode {
+	makeMerror := func(msg string) *MMLNode {
+		return pitz.merror(DiagMacro, `\DeclareMathOperator`, msg)
+	}
+	next := func() (*TokenBuffer, error) {
+		arg, err := b.GetNextExpr()
+		if errors.Is(err, ErrTokenBufferSingle) {
+			arg, err = b.GetNextN(1, true)
+		}
+		return arg, err
+	}
+	cmd, err := next()
+	if err != nil || len(cmd.Expr) != 1 || cmd.Expr[0].Kind&tokCommand == 0 {
+		return makeMerror("DeclareMathOperator expects an argument of exactly one \\command")
+	}
+	t := cmd.Expr[0]
+	text, err := next()
+	if err != nil {
+		return makeMerror("DeclareMathOperator expects the name of the operator")
+	}
+	op := Token{Kind: tokCommand, Value: "operatorname", start: t.start, end: t.end}
+	if star {
+		op.Kind |= tokStarSuffix
+	}
+	definition := slices.Concat(
+		[]Token{op, {Kind: tokCurly | tokOpen, Value: "{", start: t.start, end: t.end}},
+		text.Expr,
+		[]Token{{Kind: tokCurly | tokClose, Value: "}", start: t.start, end: t.end}},
+	)
+	_, defined := pitz.rc.macros[t.Value]
+	if _, ok := pitz.rc.needMacroExpansion[t.Value]; ok || defined {
+		pitz.diagnose(SeverityWarning, DiagMacro, t, "macro %s was previously defined. The new definition will be ignored.", t.Value)
+		return nil
+	}
+	pitz.rc.needMacroExpansion[t.Value] = Macro{Definition: definition, Dynamic: true}
+	return nil
+}
+
 // based on https://github.com/sjelatex/derivative
-//func (pitz *Pitziil) doDerivative(name string, star bool, context parseContext, tokens []Token, index int) (*MMLNode, int) {
-//	var opts []Token
-//	arguments := make([][]Token, 0)
-//	var expr []Token
-//	var kind ExprKind
-//	var idx int
-//	var slashfrac, shorthand bool
-//	expr, idx, kind = GetNextExpr(tokens, index)
-//	switch kind {
-//	case expr_options:
-//		opts = expr
-//	case expr_group:
-//		arguments = append(arguments, expr)
-//	default:
-//		n := NewMMLNode("merror", name)
-//		n.SetAttr("title", fmt.Sprintf("%s expects an argument", name))
-//		return n, idx
-//	}
-//	n := NewMMLNode()
-//	keepConsuming := true
-//	temp := idx
-//	for keepConsuming && len(arguments) < 2 {
-//		expr, temp, kind = GetNextExpr(tokens, idx+1)
-//		switch kind {
-//		case expr_group:
-//			arguments = append(arguments, expr)
-//		case expr_single_tok:
-//			if len(arguments) < 1 {
-//				n := NewMMLNode("merror", name)
-//				n.SetAttr("title", fmt.Sprintf("%s expects an argument", name))
-//				return n, idx
-//			} else if len(arguments) > 1 {
-//				keepConsuming = false
-//			} else if len(expr) == 0 {
-//				keepConsuming = false
-//			} else {
-//				switch expr[0].Value {
-//				case "/":
-//					slashfrac = true
-//					n = NewMMLNode("mrow")
-//				case "!":
-//					shorthand = true
-//					n = NewMMLNode("mrow")
-//				default:
-//					keepConsuming = false
-//				}
-//			}
-//		default:
-//			keepConsuming = false
-//		}
-//		if keepConsuming {
-//			idx = temp
-//		}
-//	}
-//	if len(arguments) == 0 {
-//		n := NewMMLNode("merror", name)
-//		n.SetAttr("title", fmt.Sprintf("%s expects an argument", name))
-//		return n, idx
-//	}
-//	var inf string
-//	jacobian := false
-//	switch name[0] {
-//	case 'd':
-//		inf = "d"
-//		slashfrac = slashfrac || star
-//	case 'o':
-//		inf = "d"
-//	case 'p':
-//		inf = "𝜕" // U+1D715 MATHEMATICAL ITALIC PARTIAL DIFFERENTIAL
-//	case 'j':
-//		inf = "𝜕" // U+1D715 MATHEMATICAL ITALIC PARTIAL DIFFERENTIAL
-//		jacobian = true
-//	case 'm':
-//		inf = "D"
-//	case 'a':
-//		inf = "Δ"
-//	case 'f':
-//		inf = "δ"
-//	}
-//	_ = jacobian //TODO: handle jacobian
-//	isComma := func(t Token) bool { return t.Value == "," }
-//	var denominator [][]Token
-//	var numerator []Token
-//	switch len(arguments) {
-//	case 1:
-//		denominator = splitByFunc(arguments[0], isComma)
-//	case 2:
-//		numerator = arguments[0]
-//		denominator = splitByFunc(arguments[1], isComma)
-//	}
-//	options := splitByFunc(opts, isComma)
-//	makeOperator := func() *MMLNode {
-//		op := NewMMLNode("mo", inf)
-//		op.SetAttr("form", "prefix")
-//		op.SetAttr("rspace", "0.05556em")
-//		op.SetAttr("lspace", "0.11111em")
-//		return op
-//	}
-//	order := make([]Token, 0, 2*len(options))
-//	temp = 0
-//	onlyNumbers := true
-//	for _, opt := range options {
-//		for _, t := range opt {
-//			switch t.Kind {
-//			case tokNumber:
-//				val, _ := strconv.ParseInt(t.Value, 10, 32)
-//				temp += int(val)
-//			case tokCommand, tokLetter:
-//				onlyNumbers = false
-//				order = append(order, t, Token{Kind: tokChar, Value: "+"})
-//			}
-//		}
-//	}
-//	temp += len(denominator) - len(options)
-//	if onlyNumbers && temp > 1 {
-//		order = append(order, Token{Kind: tokNumber, Value: strconv.Itoa(temp)})
-//	} else if temp > 0 && len(order) > 1 {
-//		order = append(order, Token{Kind: tokNumber, Value: strconv.Itoa(temp)})
-//	} else if len(order) > 1 {
-//		order = order[:len(order)-1]
-//	}
-//	if slashfrac && shorthand {
-//		for i, v := range denominator {
-//			n.AppendChild(makeOperator())
-//			if i < len(options) {
-//				n.AppendChild(makeSuperscript(pitz.ParseTex(v, context), pitz.ParseTex(options[i], context)))
-//			} else {
-//				n.AppendChild(pitz.ParseTex(v, context))
-//			}
-//		}
-//		if len(numerator) > 0 {
-//			n.AppendChild(pitz.ParseTex(numerator, context))
-//		}
-//	} else if shorthand {
-//		for i, v := range denominator {
-//			if i < len(options) {
-//				n.AppendChild(makeSubSup(makeOperator(), pitz.ParseTex(v, context), pitz.ParseTex(options[i], context)))
-//			} else {
-//				n.AppendChild(makeSubscript(makeOperator(), pitz.ParseTex(v, context)))
-//			}
-//		}
-//		if len(numerator) > 0 {
-//			n.AppendChild(pitz.ParseTex(numerator, context))
-//		}
-//	} else {
-//		num := NewMMLNode("mrow")
-//		if len(order) > 0 {
-//			num.AppendChild(makeSuperscript(makeOperator(), pitz.ParseTex(order, context)), pitz.ParseTex(numerator, context))
-//		} else {
-//			num.AppendChild(makeOperator(), pitz.ParseTex(numerator, context))
-//		}
-//		den := NewMMLNode("mrow")
-//		for i, v := range denominator {
-//			den.AppendChild(makeOperator())
-//			if i < len(options) {
-//				den.AppendChild(makeSuperscript(pitz.ParseTex(v, context), pitz.ParseTex(options[i], context)))
-//			} else {
-//				den.AppendChild(pitz.ParseTex(v, context))
-//			}
-//		}
-//		if slashfrac {
-//			n.Tag = "mrow"
-//			slash := NewMMLNode("mo", "/")
-//			slash.SetAttr("form", "infix")
-//			n.AppendChild(num, slash, den)
-//		} else {
-//			n = doFraction(Token{}, num, den)
-//		}
-//	}
-//
-//	return n, idx
-//}
+func (pitz *Pitziil) doDerivative(name string, star bool, context parseContext, b *TokenBuffer) *MMLNode {
+	args, ok := matchExtensionArgs(b, derivative_args)
+	if !ok {
+		return pitz.merror(DiagArgument, name, fmt.Sprintf("%s expects an argument", name))
+	}
+	var options [][]Token
+	var arguments []CmdArg
+	var slashfrac, shorthand bool
+	for _, arg := range args {
+		switch {
+		case arg.Flavor&CF_OPTION > 0:
+			options = arg.Items
+		case arg.Flavor&CF_LITERAL > 0:
+			switch arg.Value[0].Value {
+			case "/":
+				slashfrac = true
+			case "!":
+				shorthand = true
+			}
+		default:
+			arguments = append(arguments, arg)
+		}
+	}
+	var inf string
+	jacobian := false
+	// in the derivative package, the starred form places the function after the fraction. \dv follows the physics
+	// package instead, where the starred form is a slash fraction.
+	trailing := star
+	switch name[0] {
+	case 'd':
+		inf = "d"
+		slashfrac = slashfrac || star
+		trailing = false
+	case 'o':
+		inf = "d"
+	case 'p':
+		inf = "𝜕" // U+1D715 MATHEMATICAL ITALIC PARTIAL DIFFERENTIAL
+	case 'j':
+		inf = "𝜕" // U+1D715 MATHEMATICAL ITALIC PARTIAL DIFFERENTIAL
+		jacobian = true
+	case 'm':
+		inf = "D"
+	case 'a':
+		inf = "Δ"
+	case 'f':
+		inf = "δ"
+	}
+	var denominator [][]Token
+	var numerator []Token
+	switch len(arguments) {
+	case 1:
+		denominator = arguments[0].Items
+	case 2:
+		numerator = arguments[0].Value
+		denominator = arguments[1].Items
+	}
+	parse := func(toks []Token) *MMLNode {
+		return pitz.ParseTex(NewTokenBuffer(toks), context)
+	}
+	makeOperator := func() *MMLNode {
+		op := NewMMLNode("mo", inf)
+		op.SetAttr("form", "prefix")
+		op.SetAttr("rspace", "0.05556em")
+		op.SetAttr("lspace", "0.11111em")
+		return op
+	}
+	n := NewMMLNode("mrow")
+	if jacobian {
+		if len(arguments) < 2 {
+			return pitz.merror(DiagArgument, name, fmt.Sprintf("%s expects two arguments", name))
+		}
+		makeList := func(items [][]Token) *MMLNode {
+			list := NewMMLNode("mrow").AppendChild(makeOperator(), NewMMLNode("mo", "(").SetAttr("form", "prefix").SetFalse("stretchy"))
+			for i, item := range items {
+				if i > 0 {
+					list.AppendNew("mo", ",")
+				}
+				list.AppendChild(parse(item))
+			}
+			list.AppendChild(NewMMLNode("mo", ")").SetAttr("form", "postfix").SetFalse("stretchy"))
+			return list
+		}
+		num := makeList(splitArgList(numerator))
+		den := makeList(denominator)
+		if slashfrac {
+			return n.AppendChild(num, NewMMLNode("mo", "/").SetAttr("form", "infix"), den)
+		}
+		return n.AppendChild(NewMMLNode("mfrac").AppendChild(num, den))
+	}
+	// the order of differentiation with respect to the ith variable, or nil for first order
+	orderOf := func(i int) []Token {
+		if i >= len(options) || len(options[i]) == 0 {
+			return nil
+		}
+		if len(options[i]) == 1 && options[i][0].Value == "1" {
+			return nil
+		}
+		return options[i]
+	}
+	// The total order is the sum of the individual orders. Numeric orders are added together, and any others are
+	// joined with '+'.
+	order := make([]Token, 0, 2*len(options))
+	total := 0
+	for i := range denominator {
+		o := orderOf(i)
+		if o == nil {
+			total++
+			continue
+		}
+		if len(o) == 1 && o[0].Kind&tokNumber > 0 {
+			val, err := strconv.Atoi(o[0].Value)
+			if err == nil {
+				total += val
+				continue
+			}
+		}
+		order = append(order, o...)
+		order = append(order, Token{Kind: tokChar, Value: "+"})
+	}
+	if len(order) > 0 {
+		if total > 0 {
+			order = append(order, Token{Kind: tokNumber, Value: strconv.Itoa(total)})
+		} else {
+			order = order[:len(order)-1]
+		}
+	} else if total > 1 {
+		order = append(order, Token{Kind: tokNumber, Value: strconv.Itoa(total)})
+	}
+	variable := func(i int) *MMLNode {
+		if o := orderOf(i); o != nil {
+			return makeSuperscript(parse(denominator[i]), parse(o))
+		}
+		return parse(denominator[i])
+	}
+	if slashfrac && shorthand {
+		for i := range denominator {
+			n.AppendChild(makeOperator(), variable(i))
+		}
+		if len(numerator) > 0 {
+			n.AppendChild(parse(numerator))
+		}
+	} else if shorthand {
+		for i, v := range denominator {
+			if o := orderOf(i); o != nil {
+				n.AppendChild(makeSubSup(makeOperator(), parse(v), parse(o)))
+			} else {
+				n.AppendChild(makeSubscript(makeOperator(), parse(v)))
+			}
+		}
+		if len(numerator) > 0 {
+			n.AppendChild(parse(numerator))
+		}
+	} else {
+		num := NewMMLNode("mrow")
+		if len(order) > 0 {
+			num.AppendChild(makeSuperscript(makeOperator(), parse(order)))
+		} else {
+			num.AppendChild(makeOperator())
+		}
+		if len(numerator) > 0 && !trailing {
+			num.AppendChild(parse(numerator))
+		}
+		den := NewMMLNode("mrow")
+		for i := range denominator {
+			den.AppendChild(makeOperator(), variable(i))
+		}
+		if slashfrac {
+			slash := NewMMLNode("mo", "/")
+			slash.SetAttr("form", "infix")
+			n.AppendChild(num, slash, den)
+		} else {
+			n.AppendChild(NewMMLNode("mfrac").AppendChild(num, den))
+		}
+		if len(numerator) > 0 && trailing {
+			n.AppendChild(parse(numerator))
+		}
+	}
+	return n
+}
 
 func makeSubSup(base, sub, sup *MMLNode) *MMLNode {
 	s := NewMMLNode("msubsup")
@@ -0,0 +1,715 @@
+package treeblood
+
+import "strings"
+
+// Content MathML describes the meaning of an expression rather than its appearance. The presentation tree produced by
+// ParseTex is converted to Content MathML by reading each row as a sequence of operands and operators and parsing it
+// with the usual precedence: relations, then addition and subtraction, then multiplication (including juxtaposition),
+// then signs, functions, and large operators. Anything that cannot be inferred is given as a <csymbol>, or, for
+// decorated identifiers such as x_i, as a <ci> holding the presentation markup. An identifier is only read as a
+// function when the tree says so, so f(x) is a juxtaposition that may be either an application or a product.
+
+// Content MathML elements for relations and operators, keyed by the text of an <mo>.
+var (
+	contentRelations = map[string]string{
+		"=": "eq", "≠": "neq", "<": "lt", ">": "gt", "≤": "leq", "≥": "geq", "≈": "approx", "≡": "equivalent",
+		"∈": "in", "∉": "notin", "⊂": "prsubset", "⊆": "subset", "⊄": "notprsubset", "⊈": "notsubset", "∣": "factorof",
+		"⇒": "implies", "⟹": "implies", "⇔": "equivalent", "⟺": "equivalent",
+	}
+	contentAdditive = map[string]string{
+		"+": "plus", "−": "minus", "-": "minus", "∪": "union", "∨": "or",
+	}
+	contentMultiplicative = map[string]string{
+		"×": "times", "⋅": "times", "·": "times", "∗": "times", "*": "times", "/": "divide", "÷": "divide",
+		"∩": "intersect", "∧": "and", "∘": "compose", "∖": "setdiff",
+	}
+	// functions that apply to the operand following them, keyed by the text of an <mi>
+	contentFunctions = map[string]string{
+		"sin": "sin", "cos": "cos", "tan": "tan", "sec": "sec", "csc": "csc", "cot": "cot", "sinh": "sinh",
+		"cosh": "cosh", "tanh": "tanh", "sech": "sech", "csch": "csch", "coth": "coth", "arcsin": "arcsin",
+		"arccos": "arccos", "arctan": "arctan", "ln": "ln", "log": "log", "exp": "exp", "det": "determinant",
+		"gcd": "gcd", "lcm": "lcm", "max": "max", "min": "min", "arg": "arg", "Re": "real", "Im": "imaginary",
+		"¬": "not", "∇": "grad",
+	}
+	// identifiers with a Content MathML element of their own
+	contentConstants = map[string]string{
+		"π": "pi", "∞": "infinity", "∅": "emptyset", "ℝ": "reals", "ℕ": "naturalnumbers", "ℤ": "integers",
+		"ℚ": "rationals", "ℂ": "complexes", "ℙ": "primes",
+	}
+	// large operators that bind a variable, keyed by the text of the <mo>
+	contentLargeops = map[string]string{
+		"∑": "sum", "∏": "product", "∫": "int", "⋃": "union", "⋂": "intersect",
+	}
+	contentPrimes = map[string]int{"′": 1, "″": 2, "‴": 3}
+)
+
+// contentAnnotation returns an <annotation-xml> holding the Content MathML for the presentation tree n.
+func contentAnnotation(n *MMLNode) *MMLNode {
+	annotation := NewMMLNode("annotation-xml")
+	annotation.SetAttr("encoding", "MathML-Content")
+	if c := contentOf(n); c != nil {
+		annotation.AppendChild(c)
+	}
+	return annotation
+}
+
+func capply(head *MMLNode, args ...*MMLNode) *MMLNode {
+	n := NewMMLNode("apply")
+	n.AppendChild(head)
+	for _, arg := range args {
+		if arg != nil {
+			n.AppendChild(arg)
+		}
+	}
+	return n
+}
+
+// cwrap returns a qualifier such as <bvar> or <lowlimit> holding n.
+func cwrap(tag string, n *MMLNode) *MMLNode {
+	return NewMMLNode(tag).AppendChild(n)
+}
+
+// csymbolOf returns a <csymbol> for the presentation node n, using its text if it has any.
+func csymbolOf(n *MMLNode) *MMLNode {
+	if n.Text != "" {
+		return NewMMLNode("csymbol", n.Text)
+	}
+	return NewMMLNode("csymbol", n.Tag)
+}
+
+// ciOf returns a <ci> for the presentation node n. Identifiers with scripts or accents keep their presentation markup.
+func ciOf(n *MMLNode) *MMLNode {
+	if n.Tag == "mi" {
+		return NewMMLNode("ci", n.Text)
+	}
+	return NewMMLNode("ci").AppendChild(n)
+}
+
+// contentOf returns the Content MathML for the presentation node n, or nil if n has no content, e.g. a space.
+func contentOf(n *MMLNode) *MMLNode {
+	if n == nil || n.Properties&propNonprint > 0 {
+		return nil
+	}
+	switch n.Tag {
+	case "mi":
+		text := nodeText(n)
+		if name, ok := contentConstants[text]; ok {
+			return NewMMLNode(name)
+		}
+		return ciOf(n)
+	case "mn":
+		return NewMMLNode("cn", n.Text)
+	case "mtext", "ms":
+		return NewMMLNode("cs", n.Text)
+	case "mo":
+		if name, ok := contentRelations[nodeText(n)]; ok {
+			return NewMMLNode(name)
+		}
+		return csymbolOf(n)
+	case "mfrac":
+		if len(n.Children) != 2 {
+			break
+		}
+		if n.Attrib["linethickness"] == "0" {
+			return capply(NewMMLNode("csymbol", "binomial").SetAttr("cd", "combinat1"),
+				contentOf(n.Children[0]), contentOf(n.Children[1]))
+		}
+		return capply(NewMMLNode("divide"), contentOf(n.Children[0]), contentOf(n.Children[1]))
+	case "msqrt":
+		return capply(NewMMLNode("root"), contentRow(n.Children))
+	case "mroot":
+		if len(n.Children) != 2 {
+			break
+		}
+		return capply(NewMMLNode("root"), cwrap("degree", contentOf(n.Children[1])), contentOf(n.Children[0]))
+	case "msup":
+		if len(n.Children) != 2 {
+			break
+		}
+		return capply(NewMMLNode("power"), contentOf(n.Children[0]), contentOf(n.Children[1]))
+	case "msub":
+		return ciOf(n)
+	case "msubsup":
+		if len(n.Children) != 3 {
+			break
+		}
+		base := NewMMLNode("msub").AppendChild(n.Children[0], n.Children[1])
+		return capply(NewMMLNode("power"), ciOf(base), contentOf(n.Children[2]))
+	case "munder", "mover", "munderover":
+		if n.Attrib["accent"] == "true" || n.Attrib["accentunder"] == "true" {
+			return ciOf(n)
+		}
+	case "mtable":
+		return contentTable(n, "", "")
+	case "mspace", "mphantom", "none", "annotation", "annotation-xml":
+		return nil
+	case "mrow", "mstyle", "mpadded", "menclose", "semantics", "math", "mtd":
+		return contentRow(n.Children)
+	}
+	// structures that cannot be inferred, such as an operator with limits that are not understood
+	head := NewMMLNode("csymbol", n.Tag)
+	var args []*MMLNode
+	for _, child := range n.Children {
+		args = append(args, contentOf(child))
+	}
+	return capply(head, args...)
+}
+
+// A contentItem is an operand or operator in a row being parsed.
+type contentItem struct {
+	op   string   // the text of an operator, or "" for an operand
+	node *MMLNode // the presentation node
+	args []*MMLNode
+	// true for an operand that was enclosed in parentheses, which are read as the arguments of a preceding function
+	paren bool
+}
+
+// contentRow parses a sequence of sibling presentation nodes.
+func contentRow(nodes []*MMLNode) *MMLNode {
+	items := contentItems(nodes)
+	if len(items) == 0 {
+		return nil
+	}
+	p := contentParser{items: items}
+	return p.sequence()
+}
+
+// contentItems groups nodes into operands and operators, replacing fenced groups with their contents.
+func contentItems(nodes []*MMLNode) []contentItem {
+	nodes = trimNonprint(nodes)
+	var items []contentItem
+	for i := 0; i < len(nodes); i++ {
+		n := nodes[i]
+		switch n.Tag {
+		case "mphantom", "none":
+			continue
+		case "mo":
+		case "mi":
+			if nodeText(n) == "|" {
+				// |x| without \left and \right
+				if end := contentMatch(nodes, i, "|", "|"); end > i {
+					items = append(items, contentItem{node: n, args: []*MMLNode{
+						capply(NewMMLNode("abs"), contentRow(nodes[i+1:end])),
+					}})
+					i = end
+					continue
+				}
+			}
+			items = append(items, contentItem{node: n})
+			continue
+		default:
+			items = append(items, contentItem{node: n})
+			continue
+		}
+		text := nodeText(n)
+		if close, ok := contentFences[text]; ok {
+			if end := contentMatch(nodes, i, text, close); end > i {
+				inner := nodes[i+1 : end]
+				item := contentItem{node: n, paren: text == "("}
+				switch {
+				case len(inner) == 1 && inner[0].Tag == "mtable":
+					item.args = []*MMLNode{contentTable(inner[0], text, close)}
+				case len(inner) == 1 && inner[0].Tag == "mfrac" && inner[0].Attrib["linethickness"] == "0":
+					item.args = []*MMLNode{contentOf(inner[0])}
+					item.paren = false
+				case text == "|" && close == "|":
+					item.args = []*MMLNode{capply(NewMMLNode("abs"), contentRow(inner))}
+					item.paren = false
+				case text == "⌊":
+					item.args = []*MMLNode{capply(NewMMLNode("floor"), contentRow(inner))}
+				case text == "⌈":
+					item.args = []*MMLNode{capply(NewMMLNode("ceiling"), contentRow(inner))}
+				case text == "{":
+					item.args = []*MMLNode{NewMMLNode("set").AppendChild(contentArguments(inner)...)}
+				case text == "[" && len(contentArguments(inner)) == 2:
+					interval := NewMMLNode("interval").SetAttr("closure", "closed")
+					item.args = []*MMLNode{interval.AppendChild(contentArguments(inner)...)}
+				case text == "(":
+					item.args = contentArguments(inner)
+				default:
+					item.args = []*MMLNode{contentRow(inner)}
+				}
+				items = append(items, item)
+				i = end
+				continue
+			}
+			if text == "{" && i == len(nodes)-2 && nodes[i+1].Tag == "mtable" {
+				// cases
+				items = append(items, contentItem{node: n, args: []*MMLNode{contentTable(nodes[i+1], "{", "")}})
+				i++
+				continue
+			}
+		}
+		items = append(items, contentItem{op: text, node: n})
+	}
+	return items
+}
+
+var contentFences = map[string]string{"(": ")", "[": "]", "{": "}", "|": "|", "‖": "‖", "⟨": "⟩", "⌊": "⌋", "⌈": "⌉"}
+
+// contentMatch returns the index of the fence closing the one at nodes[start], or -1.
+func contentMatch(nodes []*MMLNode, start int, open, close string) int {
+	depth := 0
+	for i := start + 1; i < len(nodes); i++ {
+		if nodes[i].Tag != "mo" && nodes[i].Tag != "mi" {
+			continue
+		}
+		switch text := nodeText(nodes[i]); {
+		case text == close && depth == 0:
+			return i
+		case text == close:
+			depth--
+		case text == open:
+			depth++
+		}
+	}
+	return -1
+}
+
+// contentArguments parses nodes as a comma-separated list.
+func contentArguments(nodes []*MMLNode) []*MMLNode {
+	var args []*MMLNode
+	start := 0
+	for i, n := range nodes {
+		if n.Tag == "mo" && nodeText(n) == "," {
+			args = append(args, contentRow(nodes[start:i]))
+			start = i + 1
+		}
+	}
+	return append(args, contentRow(nodes[start:]))
+}
+
+// contentTable returns a matrix, a piecewise definition (for cases), or a list of rows for a table enclosed by the
+// fences open and close.
+func contentTable(n *MMLNode, open, close string) *MMLNode {
+	var rows [][]*MMLNode
+	for _, row := range n.Children {
+		if row == nil || (row.Tag != "mtr" && row.Tag != "mlabeledtr") {
+			continue
+		}
+		cells := row.Children
+		if row.Tag == "mlabeledtr" && len(cells) > 0 {
+			cells = cells[1:]
+		}
+		rows = append(rows, cells)
+	}
+	switch {
+	case open == "{" && close == "":
+		piecewise := NewMMLNode("piecewise")
+		for _, cells := range rows {
+			if len(cells) < 2 {
+				continue
+			}
+			value := contentOf(cells[0])
+			condition := &MMLNode{Tag: "mrow", Children: cells[1].Children}
+			if leaf := speechLeaf(condition); leaf != nil && leaf.Tag == "mtext" && strings.TrimSpace(nodeText(leaf)) == "otherwise" {
+				piecewise.AppendNew("otherwise").AppendChild(value)
+				continue
+			}
+			piecewise.AppendNew("piece").AppendChild(value, contentOf(cells[1]))
+		}
+		return piecewise
+	case open != "" && open != "{":
+		matrix := NewMMLNode("matrix")
+		for _, cells := range rows {
+			row := matrix.AppendNew("matrixrow")
+			for _, cell := range cells {
+				row.AppendChild(contentOf(cell))
+			}
+		}
+		if open == "|" {
+			return capply(NewMMLNode("determinant"), matrix)
+		}
+		return matrix
+	}
+	// aligned equations and the like, whose cells together form a single expression per row
+	list := NewMMLNode("list")
+	for _, cells := range rows {
+		var nodes []*MMLNode
+		for _, cell := range cells {
+			nodes = append(nodes, cell.Children...)
+		}
+		if c := contentRow(nodes); c != nil {
+			list.AppendChild(c)
+		}
+	}
+	if len(list.Children) == 1 {
+		return list.Children[0]
+	}
+	return list
+}
+
+// contentParser parses a row of contentItems by precedence.
+type contentParser struct {
+	items []contentItem
+	pos   int
+}
+
+func (p *contentParser) peek() *contentItem {
+	if p.pos >= len(p.items) {
+		return nil
+	}
+	return &p.items[p.pos]
+}
+
+// sequence parses a comma-separated list, which is returned as a <list> if it has more than one element.
+func (p *contentParser) sequence() *MMLNode {
+	var elements []*MMLNode
+	for {
+		if e := p.relation(); e != nil {
+			elements = append(elements, e)
+		}
+		it := p.peek()
+		if it == nil {
+			break
+		}
+		if it.op == "," || it.op == ";" {
+			p.pos++
+			continue
+		}
+		// an operator that cannot be parsed here, e.g. a stray closing fence
+		p.pos++
+		elements = append(elements, csymbolOf(it.node))
+	}
+	switch len(elements) {
+	case 0:
+		return nil
+	case 1:
+		return elements[0]
+	}
+	return NewMMLNode("list").AppendChild(elements...)
+}
+
+// relation parses a chain of relations such as a = b = c. A chain of one relation is n-ary; a mixed chain such as
+// a < b ≤ c is the conjunction of each pair.
+func (p *contentParser) relation() *MMLNode {
+	operands := []*MMLNode{p.additive()}
+	var ops []*contentItem
+	for {
+		it := p.peek()
+		if it == nil || it.op == "" {
+			break
+		}
+		if _, ok := contentRelations[it.op]; !ok && !textOperators()[it.op] || contentAdditive[it.op] != "" ||
+			contentMultiplicative[it.op] != "" || it.op == "±" || it.op == "∓" {
+			break
+		}
+		p.pos++
+		ops = append(ops, it)
+		operands = append(operands, p.additive())
+	}
+	if len(ops) == 0 {
+		return operands[0]
+	}
+	head := func(it *contentItem) *MMLNode {
+		if name, ok := contentRelations[it.op]; ok {
+			return NewMMLNode(name)
+		}
+		return csymbolOf(it.node)
+	}
+	same := true
+	for _, op := range ops {
+		same = same && op.op == ops[0].op
+	}
+	if same {
+		return capply(head(ops[0]), operands...)
+	}
+	and := capply(NewMMLNode("and"))
+	for i, op := range ops {
+		and.AppendChild(capply(head(op), operands[i], operands[i+1]))
+	}
+	return and
+}
+
+// additive parses a sum or difference. Sums are n-ary; differences are binary and associate to the left.
+func (p *contentParser) additive() *MMLNode {
+	left := p.multiplicative()
+	for {
+		it := p.peek()
+		if it == nil || it.op == "" {
+			return left
+		}
+		name, ok := contentAdditive[it.op]
+		if !ok && it.op != "±" && it.op != "∓" {
+			return left
+		}
+		p.pos++
+		right := p.multiplicative()
+		if !ok {
+			left = capply(csymbolOf(it.node), left, right)
+			continue
+		}
+		if left == nil {
+			// a leading sign
+			left = capply(NewMMLNode(name), right)
+			continue
+		}
+		if name != "minus" && left.Tag == "apply" && len(left.Children) > 0 && left.Children[0].Tag == name {
+			left.AppendChild(right)
+			continue
+		}
+		left = capply(NewMMLNode(name), left, right)
+	}
+}
+
+// multiplicative parses a product or quotient, including juxtaposed factors such as 2ab.
+func (p *contentParser) multiplicative() *MMLNode {
+	var factors []*MMLNode
+	var left *MMLNode
+	flush := func() {
+		if len(factors) == 1 {
+			left = factors[0]
+		} else if len(factors) > 1 {
+			left = capply(NewMMLNode("times"), factors...)
+		}
+	}
+	for {
+		it := p.peek()
+		if it == nil {
+			break
+		}
+		if it.op != "" {
+			if name, ok := contentMultiplicative[it.op]; ok && len(factors) > 0 {
+				p.pos++
+				right := p.unary()
+				if name == "times" {
+					factors = append(factors, right)
+					continue
+				}
+				flush()
+				factors = []*MMLNode{capply(NewMMLNode(name), left, right)}
+				continue
+			}
+			if len(factors) > 0 || contentAdditive[it.op] != "" || it.op == "±" || it.op == "∓" {
+				break
+			}
+			if _, ok := contentRelations[it.op]; ok || it.op == "," || it.op == ";" {
+				break
+			}
+		}
+		f := p.unary()
+		if f == nil {
+			break
+		}
+		factors = append(factors, f)
+	}
+	flush()
+	return left
+}
+
+// unary parses a single factor, with any function, large operator, or postfix operator applied to it.
+func (p *contentParser) unary() *MMLNode {
+	it := p.peek()
+	if it == nil {
+		return nil
+	}
+	if it.op != "" {
+		switch {
+		case it.op == "¬" || it.op == "∇":
+			p.pos++
+			return capply(NewMMLNode(contentFunctions[it.op]), p.unary())
+		case contentAdditive[it.op] == "minus" || it.op == "+":
+			return nil
+		}
+		if op, sub, sup, _ := ommlNary(it.node); op != nil {
+			p.pos++
+			return p.largeop(op, sub, sup)
+		}
+		// an operator that cannot be inferred
+		p.pos++
+		return p.postfix(csymbolOf(it.node))
+	}
+	p.pos++
+	if it.args != nil && !it.paren {
+		return p.postfix(it.args[0])
+	}
+	if it.args != nil {
+		if len(it.args) == 1 {
+			return p.postfix(it.args[0])
+		}
+		return p.postfix(NewMMLNode("vector").AppendChild(it.args...))
+	}
+	n := it.node
+	if op, sub, sup, _ := ommlNary(n); op != nil {
+		return p.largeop(op, sub, sup)
+	}
+	if leaf := speechLeaf(n); leaf != nil && leaf.Tag == "mi" {
+		text := nodeText(leaf)
+		if name, ok := contentFunctions[text]; ok {
+			return p.apply(NewMMLNode(name))
+		}
+		if next := p.peek(); next != nil && next.op == "\u2061" {
+			// an identifier marked as a function by an explicit function application, as in f⁡(x)
+			return p.apply(ciOf(leaf))
+		}
+		// a derivative such as f'(x), whose primes show that f is a function
+		head := ciOf(leaf)
+		primes := 0
+		for next := p.peek(); next != nil && contentPrimes[next.op] > 0; next = p.peek() {
+			for range contentPrimes[next.op] {
+				head = capply(NewMMLNode("diff"), head)
+			}
+			primes++
+			p.pos++
+		}
+		if next := p.peek(); next != nil && next.paren && primes > 0 {
+			return p.apply(head)
+		}
+		p.pos -= primes
+		if next := p.peek(); next != nil && next.paren && next.args != nil && contentConstants[text] == "" {
+			// f(x) may be a function applied to x or a product, so the juxtaposition is left uninterpreted
+			p.pos++
+			return p.postfix(capply(NewMMLNode("csymbol", "juxtaposition"), append([]*MMLNode{ciOf(leaf)}, next.args...)...))
+		}
+	}
+	if head, qualifiers := contentLimit(n); head != nil {
+		return capply(head, append(qualifiers, p.unary())...)
+	}
+	if n.Tag == "msup" && len(n.Children) == 2 {
+		// powers of functions, as in sin^2 x
+		if leaf := speechLeaf(n.Children[0]); leaf != nil && leaf.Tag == "mi" {
+			if name, ok := contentFunctions[nodeText(leaf)]; ok {
+				return capply(NewMMLNode("power"), p.apply(NewMMLNode(name)), contentOf(n.Children[1]))
+			}
+		}
+	}
+	return p.postfix(contentOf(n))
+}
+
+// apply applies the function head to the argument that follows it: a parenthesized list, or else a single factor.
+func (p *contentParser) apply(head *MMLNode) *MMLNode {
+	if next := p.peek(); next != nil && next.op == "\u2061" {
+		p.pos++
+	}
+	next := p.peek()
+	if next != nil && next.paren && next.args != nil {
+		p.pos++
+		return p.postfix(capply(head, next.args...))
+	}
+	return capply(head, p.unary())
+}
+
+// postfix applies any factorials and primes following the operand n.
+func (p *contentParser) postfix(n *MMLNode) *MMLNode {
+	for {
+		it := p.peek()
+		if it == nil {
+			return n
+		}
+		switch it.op {
+		case "!":
+			n = capply(NewMMLNode("factorial"), n)
+		case "′", "″", "‴":
+			for range contentPrimes[it.op] {
+				n = capply(NewMMLNode("diff"), n)
+			}
+		default:
+			return n
+		}
+		p.pos++
+	}
+}
+
+// largeop parses a sum, product, or integral with the limits sub and sup. The summand extends to the next relation,
+// sum, or difference. The variable of an integral is taken from a trailing differential such as dx; that of a sum
+// or product from a lower limit such as i=1, or from a subscript that is a single identifier such as i.
+func (p *contentParser) largeop(op, sub, sup *MMLNode) *MMLNode {
+	text := nodeText(op)
+	name, ok := contentLargeops[text]
+	var head *MMLNode
+	if ok {
+		head = NewMMLNode(name)
+	} else {
+		head = csymbolOf(op)
+	}
+	start := p.pos
+	end := start
+	for end < len(p.items) {
+		it := p.items[end]
+		if it.op != "" && (contentAdditive[it.op] == "minus" || it.op == "+" || contentRelations[it.op] != "" || it.op == ",") {
+			break
+		}
+		end++
+	}
+	body := p.items[start:end]
+	p.pos = end
+	var qualifiers []*MMLNode
+	if name == "int" && len(body) >= 2 {
+		d, v := body[len(body)-2], body[len(body)-1]
+		if d.op == "" && d.node.Tag == "mi" && nodeText(d.node) == "d" && v.op == "" && v.node.Tag == "mi" {
+			qualifiers = append(qualifiers, cwrap("bvar", ciOf(v.node)))
+			body = body[:len(body)-2]
+		}
+	}
+	if leaf := speechLeaf(sub); leaf != nil && leaf.Tag == "mi" && (name == "sum" || name == "product") {
+		// a sum or product over a single variable, such as \sum_i, has no lower limit
+		qualifiers = append(qualifiers, cwrap("bvar", ciOf(leaf)))
+		sub = nil
+	}
+	if sub != nil {
+		bvar, low := contentBound(sub)
+		if bvar != nil && len(qualifiers) == 0 {
+			qualifiers = append(qualifiers, cwrap("bvar", bvar))
+		}
+		if low != nil {
+			qualifiers = append(qualifiers, cwrap("lowlimit", low))
+		} else if sup == nil {
+			qualifiers = append(qualifiers, cwrap("condition", contentOf(sub)))
+		}
+	}
+	if sup != nil {
+		qualifiers = append(qualifiers, cwrap("uplimit", contentOf(sup)))
+	}
+	inner := contentParser{items: body}
+	return capply(head, append(qualifiers, inner.sequence())...)
+}
+
+// contentBound splits a lower limit such as i=1 into its variable and value. If sub is not of that form, the value
+// is the content of sub if it has a value, e.g. the 0 of an integral from 0.
+func contentBound(sub *MMLNode) (bvar, value *MMLNode) {
+	nodes := []*MMLNode{sub}
+	if sub.Tag == "mrow" {
+		nodes = trimNonprint(sub.Children)
+	}
+	for i, n := range nodes {
+		if n.Tag == "mo" && (nodeText(n) == "=" || nodeText(n) == "→") && i > 0 {
+			return contentRow(nodes[:i]), contentRow(nodes[i+1:])
+		}
+	}
+	if len(nodes) == 1 {
+		return nil, contentOf(sub)
+	}
+	return nil, nil
+}
+
+// contentLimit returns the head and qualifiers of a limit such as \lim_{x \to 0}, whose argument follows it.
+func contentLimit(n *MMLNode) (head *MMLNode, qualifiers []*MMLNode) {
+	if n.Tag == "mrow" && len(n.Children) == 1 {
+		n = n.Children[0]
+	}
+	if n.Tag != "munder" || len(n.Children) != 2 {
+		return nil, nil
+	}
+	leaf := speechLeaf(n.Children[0])
+	if leaf == nil || leaf.Tag != "mi" {
+		return nil, nil
+	}
+	switch nodeText(leaf) {
+	case "lim":
+		head = NewMMLNode("limit")
+	case "max", "min", "sup", "inf":
+		head = NewMMLNode(nodeText(leaf))
+	default:
+		return nil, nil
+	}
+	bvar, value := contentBound(n.Children[1])
+	switch {
+	case bvar != nil && value != nil && head.Tag == "limit":
+		qualifiers = append(qualifiers, cwrap("bvar", bvar), cwrap("lowlimit", value))
+	case bvar != nil:
+		qualifiers = append(qualifiers, cwrap("bvar", bvar))
+	default:
+		qualifiers = append(qualifiers, cwrap("condition", contentOf(n.Children[1])))
+	}
+	return head, qualifiers
+}
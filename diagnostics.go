@@ -0,0 +1,196 @@
+package treeblood
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Severity indicates how serious a Diagnostic is.
+type Severity int
+
+const (
+	SeverityError   Severity = iota // the input could not be rendered; an <merror> was produced in its place
+	SeverityWarning                 // the input was rendered, but probably not as intended
+	SeverityNote                    // the input was rendered, but relied on a guess or fallback
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Codes identifying the kind of problem described by a Diagnostic.
+const (
+	DiagSyntax         = "syntax"          // mismatched braces or environments
+	DiagDelimiter      = "delimiter"       // a closing delimiter with no matching opening delimiter
+	DiagUnknownCommand = "unknown-command" // a \command that TreeBlood does not recognize
+	DiagArgument       = "argument"        // a command or environment is missing an argument or has the wrong number
+	DiagMacro          = "macro"           // a macro could not be defined or expanded
+	DiagEnvironment    = "environment"     // an environment was used incorrectly
+	DiagLabel          = "label"           // an unresolved reference or a label defined more than once
+	DiagExtension      = "extension"       // a command registered with RegisterExtension reported an error
+	DiagInternal       = "internal"        // TreeBlood encountered an unexpected error
+)
+
+// A Diagnostic describes a problem encountered while rendering an expression. Start and End are rune offsets into the
+// TeX source delimiting the offending input; both are zero if the problem cannot be attributed to a location.
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Message  string
+	Start    int
+	End      int
+}
+
+func (d Diagnostic) String() string {
+	if d.Start == 0 && d.End == 0 {
+		return fmt.Sprintf("%s[%s]: %s", d.Severity, d.Code, d.Message)
+	}
+	return fmt.Sprintf("%s[%s] %d:%d: %s", d.Severity, d.Code, d.Start, d.End, d.Message)
+}
+
+// RenderResult is the output of Pitziil.Render.
+type RenderResult struct {
+	MathML      string // the rendered equation, which is HTML rather than MathML if HTMLOutput is set
+	Diagnostics []Diagnostic
+}
+
+// Render renders tex in display style (if display is true) or text style, returning the MathML together with any
+// problems encountered along the way. The output is identical to that returned by DisplayStyle or TextStyle.
+func (pitz *Pitziil) Render(tex string, display bool) (RenderResult, error) {
+	var result RenderResult
+	var indent int
+	if pitz.PrintOneLine {
+		indent = -1
+	}
+	ast, rc, err := pitz.renderAST(tex, display)
+	result.Diagnostics = rc.diagnostics
+	if ast == nil {
+		return result, err
+	}
+	result.Diagnostics = append(result.Diagnostics, pitz.resolveLabels(rc.pending)...)
+	pitz.speakMath(ast)
+	var builder strings.Builder
+	builder.WriteRune('\n')
+	if werr := pitz.writeMath(&builder, ast, indent); werr != nil {
+		result.Diagnostics = append(result.Diagnostics, Diagnostic{Severity: SeverityError, Code: DiagInternal, Message: werr.Error()})
+		err = werr
+	}
+	builder.WriteRune('\n')
+	result.MathML = builder.String()
+	return result, err
+}
+
+// log sends d to the LogHandler of the Pitziil, if there is one.
+func (pitz *Pitziil) log(d Diagnostic) {
+	if pitz.LogHandler == nil {
+		return
+	}
+	var level slog.Level
+	switch d.Severity {
+	case SeverityError:
+		level = slog.LevelError
+	case SeverityWarning:
+		level = slog.LevelWarn
+	default:
+		level = slog.LevelInfo
+	}
+	ctx := context.Background()
+	if !pitz.LogHandler.Enabled(ctx, level) {
+		return
+	}
+	record := slog.NewRecord(time.Now(), level, d.Message, 0)
+	record.AddAttrs(slog.String("code", d.Code))
+	if d.Start != 0 || d.End != 0 {
+		record.AddAttrs(slog.Int("start", d.Start), slog.Int("end", d.End))
+	}
+	if pitz.rc != nil {
+		record.AddAttrs(slog.String("tex", string(pitz.rc.expr)))
+	}
+	pitz.LogHandler.Handle(ctx, record)
+}
+
+// diagnose records a Diagnostic for the current render located at tok, and logs it.
+func (pitz *Pitziil) diagnose(severity Severity, code string, tok Token, format string, args ...any) {
+	d := Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Start:    tok.start,
+		End:      tok.end,
+	}
+	pitz.rc.diagnostics = append(pitz.rc.diagnostics, d)
+	pitz.log(d)
+}
+
+// diagnoseNode records a Diagnostic for the current render located at n. Since a node does not know where it came
+// from until ParseTex assigns its token, the diagnostic is located and logged by finishDiagnostics once parsing is
+// finished.
+func (pitz *Pitziil) diagnoseNode(n *MMLNode, severity Severity, code string, message string) {
+	if pitz.rc.diagnosticNodes == nil {
+		pitz.rc.diagnosticNodes = make(map[*MMLNode]int)
+	}
+	pitz.rc.diagnosticNodes[n] = len(pitz.rc.diagnostics)
+	pitz.rc.diagnostics = append(pitz.rc.diagnostics, Diagnostic{Severity: severity, Code: code, Message: message})
+}
+
+// merror creates an <merror> displaying text with message as its title, and records a Diagnostic for it.
+func (pitz *Pitziil) merror(code string, text string, message string) *MMLNode {
+	n := NewMMLNode("merror", text).SetAttr("title", message)
+	pitz.diagnoseNode(n, SeverityError, code, message)
+	return n
+}
+
+// locateDiagnostics sets the location of each Diagnostic recorded by diagnoseNode to that of the token from which its
+// node, or the nearest ancestor of its node, was created.
+func (rc *renderContext) locateDiagnostics(n *MMLNode, start, end int) {
+	if n == nil || len(rc.diagnosticNodes) == 0 {
+		return
+	}
+	if n.Tok.end > n.Tok.start {
+		start, end = n.Tok.start, n.Tok.end
+	}
+	if i, ok := rc.diagnosticNodes[n]; ok {
+		rc.diagnostics[i].Start = start
+		rc.diagnostics[i].End = end
+	}
+	for _, child := range n.Children {
+		rc.locateDiagnostics(child, start, end)
+	}
+}
+
+// finishDiagnostics locates the diagnostics recorded by diagnoseNode within ast and logs them.
+func (pitz *Pitziil) finishDiagnostics(ast *MMLNode) {
+	if len(pitz.rc.diagnosticNodes) == 0 {
+		return
+	}
+	pitz.rc.locateDiagnostics(ast, 0, 0)
+	indices := slices.Sorted(maps.Values(pitz.rc.diagnosticNodes))
+	for _, i := range indices {
+		pitz.log(pitz.rc.diagnostics[i])
+	}
+	pitz.rc.diagnosticNodes = nil
+}
+
+// diagnoseError records a Diagnostic for an error that prevented the current expression from being parsed at all.
+func (pitz *Pitziil) diagnoseError(code string, err error) {
+	var mismatched MismatchedBraceError
+	if errors.As(err, &mismatched) {
+		pitz.diagnose(SeverityError, DiagSyntax, mismatched.tok, "mismatched %s", mismatched.kind)
+		return
+	}
+	pitz.diagnose(SeverityError, code, Token{}, "%s", err.Error())
+}
@@ -19,9 +19,9 @@ func setEnvironmentContext(envBegin Token, context parseContext) parseContext {
 			context |= ctxEnvHasArg
 		}
 		return context | ctxTable
-	case "array", "subarray":
+	case "array", "subarray", "alignat", "alignedat":
 		return context | ctxTable | ctxEnvHasArg
-	case "table", "align", "aligned", "cases":
+	case "table", "align", "aligned", "cases", "gather", "gathered", "multline", "split", "flalign":
 		return context | ctxTable
 	}
 	return context
@@ -256,7 +256,8 @@ func setAlignmentStyle(node *MMLNode) {
 	recurse(node, strings.Split(node.Attrib["columnalign"], " ")...)
 }
 
-func processEnv(node *MMLNode, env string, ctx parseContext) *MMLNode {
+func (pitz *Pitziil) processEnv(node *MMLNode, tok Token, ctx parseContext) *MMLNode {
+	env := tok.Value
 	switch {
 	case ctx&ctxTable > 0:
 		processTable(node)
@@ -283,12 +284,27 @@ func processEnv(node *MMLNode, env string, ctx parseContext) *MMLNode {
 	case "cases":
 		left = strechyOP("{")
 		attrib["columnalign"] = "left"
-	case "align", "align*", "aligned":
+	case "align", "align*", "aligned", "alignat", "alignat*", "alignedat", "flalign", "flalign*", "split":
 		attrib["displaystyle"] = "true"
-		//attrib["columnalign"] = "left"
+		// columns come in pairs, the first of each pair flush right and the second flush left.
 		flipflop := []string{"right", "left"}
 		if node != nil {
-			//node.CSS["text-align"] = "left"
+			if strings.HasPrefix(env, "flalign") {
+				node.CSS["width"] = "100%"
+			}
+			if env == "alignat" || env == "alignat*" || env == "alignedat" {
+				// alignat{n} has exactly n pairs of columns
+				if n, err := strconv.Atoi(strings.TrimSpace(node.Option)); err != nil || n < 1 {
+					pitz.diagnose(SeverityWarning, DiagEnvironment, tok, "%s expects a positive number of column pairs, got '%s'", env, node.Option)
+				} else {
+					for _, row := range node.Children {
+						if row != nil && len(row.Children) > 2*n {
+							pitz.diagnose(SeverityWarning, DiagEnvironment, tok, "%s{%d} has more than %d columns", env, n, 2*n)
+							break
+						}
+					}
+				}
+			}
 			for _, row := range node.Children {
 				if row == nil || len(row.Children) == 0 {
 					continue
@@ -301,8 +317,36 @@ func processEnv(node *MMLNode, env string, ctx parseContext) *MMLNode {
 				}
 			}
 		}
+	case "gather", "gather*", "gathered":
+		attrib["displaystyle"] = "true"
+	case "multline", "multline*":
+		attrib["displaystyle"] = "true"
+		// the first line is set flush left, the last flush right, and any others centered.
+		if node != nil {
+			node.CSS["width"] = "100%"
+			for r, row := range node.Children {
+				align := "center"
+				switch {
+				case len(node.Children) == 1:
+				case r == 0:
+					align = "left"
+				case r == len(node.Children)-1:
+					align = "right"
+				}
+				for _, col := range row.Children {
+					if col != nil && col.Tag == "mtd" {
+						col.Attrib["columnalign"] = align
+					}
+				}
+			}
+		}
 	case "subarray":
 		attrib["displaystyle"] = "false"
+	case "equation":
+		return node
+	case "equation*":
+		pitz.rc.eq.noNumber = true
+		return node
 	default:
 		return node
 	}
@@ -312,6 +356,11 @@ func processEnv(node *MMLNode, env string, ctx parseContext) *MMLNode {
 		}
 	}
 	setAlignmentStyle(node)
+	switch env {
+	case "align", "align*", "alignat", "alignat*", "flalign", "flalign*", "gather", "gather*", "multline", "multline*":
+		// numbering must come last so the label cells do not disturb the column alignment
+		pitz.numberRows(node, env)
+	}
 	row.Children = append(row.Children, left, node, right)
 	return row
 }
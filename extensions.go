@@ -0,0 +1,386 @@
+package treeblood
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CmdFlavor describes what kind of argument a CmdArg is.
+type CmdFlavor uint64
+
+const (
+	CF_LITERAL   CmdFlavor = 1 << iota // a literal token such as '/' or '!'
+	CF_GROUPED                         // an argument enclosed in {curly braces}
+	CF_TOKEN                           // a single token given in place of a {grouped} argument
+	CF_OPTION                          // an argument enclosed in [square brackets]
+	CF_COMMA_SEP                       // the argument is a comma-separated list. See CmdArg.Items
+)
+
+// CmdArg is a single argument consumed by an extension.
+type CmdArg struct {
+	Flavor CmdFlavor
+	Value  []Token   // the tokens of the argument, without the enclosing braces or brackets
+	Items  [][]Token // if Flavor has CF_COMMA_SEP, Value split at each top-level comma
+}
+
+// CmdArgExpr is a pattern describing the arguments an extension accepts. A pattern is a sequence of the following
+// elements, optionally separated by whitespace:
+//
+//	{}    a mandatory argument in curly braces. A single token is also accepted, as with \frac12
+//	[]    an argument in square brackets
+//	'x'   the literal token x. Commands are written with their leading backslash, e.g. '\to'
+//
+// A comma inside the braces or brackets, as in {,} or [,], marks the argument as a comma-separated list. Each element
+// may be followed by a quantifier: ? (zero or one), * (zero or more), or + (one or more). Quantified arguments must be
+// enclosed in braces or brackets. For example, the \dv family of commands could be described with
+//
+//	[,]?{}?'/'?'!'?{,}
+type CmdArgExpr string
+
+// ExtFunc renders an extension command. n is an empty <mrow> to be filled in (its Tag may be changed), ctx describes
+// where the command occurs, and args holds the arguments matched by one of the command's patterns, in order. If an
+// error is returned, an <merror> is emitted in place of n.
+type ExtFunc func(n *MMLNode, ctx ExtContext, args []CmdArg) error
+
+// ExtContext exposes the state of the parser to an ExtFunc.
+type ExtContext struct {
+	pitz    *Pitziil
+	ctx     parseContext
+	command string
+	star    bool
+}
+
+type argElement struct {
+	flavor  CmdFlavor
+	literal Token
+	min     int
+	max     int // a negative value means unbounded
+}
+
+type extension struct {
+	f        ExtFunc
+	patterns [][]argElement
+}
+
+var (
+	// extensions available to every Pitziil
+	extensions = make(map[string]*extension)
+
+	ErrExtensionPattern = errors.New("malformed extension pattern")
+)
+
+// Command returns the name of the command being processed, without the leading backslash or any star.
+func (c ExtContext) Command() string {
+	return c.command
+}
+
+// Star reports whether the command was given a star suffix, as in \foo*
+func (c ExtContext) Star() bool {
+	return c.star
+}
+
+// Display reports whether the command is being rendered in display style.
+func (c ExtContext) Display() bool {
+	if c.ctx&ctxDisplay > 0 {
+		return true
+	}
+	if c.ctx&(ctxInline|ctxScript|ctxScriptscript) > 0 {
+		return false
+	}
+	return c.pitz.rc.display
+}
+
+// ScriptLevel returns 0 for normal math, 1 under \scriptstyle, and 2 under \scriptscriptstyle.
+func (c ExtContext) ScriptLevel() int {
+	switch {
+	case c.ctx&ctxScriptscript > 0:
+		return 2
+	case c.ctx&ctxScript > 0:
+		return 1
+	}
+	return 0
+}
+
+// MathVariant returns the value of the mathvariant attribute in effect (e.g. "bold" inside \mathbf), or the empty
+// string if there is none.
+func (c ExtContext) MathVariant() string {
+	return mathvariantFromContext(c.ctx)
+}
+
+// InTable reports whether the command occurs within a table-like environment.
+func (c ExtContext) InTable() bool {
+	return c.ctx&ctxTable > 0
+}
+
+// Parse renders a list of tokens, such as the Value of a CmdArg, in the same context as the command.
+func (c ExtContext) Parse(toks []Token) *MMLNode {
+	return c.pitz.ParseTex(NewTokenBuffer(toks), c.ctx)
+}
+
+// RegisterExtension associates all commands provided in the slice with the function f for every Pitziil. The
+// 'consumes' argument lists the patterns of arguments the commands accept; the first one that matches is used. If
+// consumes is empty, the commands take no arguments. Extensions registered on a Pitziil take precedence over those
+// registered here. RegisterExtension is not safe to call while expressions are being rendered.
+func RegisterExtension(commands []string, f ExtFunc, consumes []CmdArgExpr) error {
+	ext, err := compileExtension(f, consumes)
+	if err != nil {
+		return err
+	}
+	for _, cmd := range commands {
+		extensions[strings.TrimPrefix(cmd, `\`)] = ext
+	}
+	return nil
+}
+
+// RegisterExtension associates all commands provided in the slice with the function f for this Pitziil only. See the
+// package-level RegisterExtension.
+func (pitz *Pitziil) RegisterExtension(commands []string, f ExtFunc, consumes []CmdArgExpr) error {
+	ext, err := compileExtension(f, consumes)
+	if err != nil {
+		return err
+	}
+	for _, cmd := range commands {
+		pitz.extensions[strings.TrimPrefix(cmd, `\`)] = ext
+	}
+	return nil
+}
+
+func compileExtension(f ExtFunc, consumes []CmdArgExpr) (*extension, error) {
+	if f == nil {
+		return nil, fmt.Errorf("%w: nil ExtFunc", ErrExtensionPattern)
+	}
+	ext := &extension{f: f, patterns: make([][]argElement, 0, len(consumes))}
+	for _, expr := range consumes {
+		pattern, err := compileArgPattern(expr)
+		if err != nil {
+			return nil, err
+		}
+		ext.patterns = append(ext.patterns, pattern)
+	}
+	if len(ext.patterns) == 0 {
+		ext.patterns = append(ext.patterns, nil)
+	}
+	return ext, nil
+}
+
+func compileArgPattern(expr CmdArgExpr) ([]argElement, error) {
+	pattern := make([]argElement, 0)
+	str := []rune(string(expr))
+	fail := func(pos int, msg string) ([]argElement, error) {
+		return nil, fmt.Errorf("%w: %s at position %d of %q", ErrExtensionPattern, msg, pos, string(expr))
+	}
+	i := 0
+	for i < len(str) {
+		var elem argElement
+		switch str[i] {
+		case ' ', '\t', '\n':
+			i++
+			continue
+		case '{', '[':
+			closing := '}'
+			elem.flavor = CF_GROUPED
+			if str[i] == '[' {
+				closing = ']'
+				elem.flavor = CF_OPTION
+			}
+			i++
+			if i < len(str) && str[i] == ',' {
+				elem.flavor |= CF_COMMA_SEP
+				i++
+			}
+			if i >= len(str) || str[i] != closing {
+				return fail(i, "expected '"+string(closing)+"'")
+			}
+			i++
+		case '\'':
+			end := i + 1
+			for end < len(str) && str[end] != '\'' {
+				end++
+			}
+			if end >= len(str) {
+				return fail(i, "unterminated literal")
+			}
+			if end == i+1 {
+				return fail(i, "empty literal")
+			}
+			elem.flavor = CF_LITERAL
+			lit := string(str[i+1 : end])
+			if strings.HasPrefix(lit, `\`) && len(lit) > 1 {
+				elem.literal = Token{Kind: tokCommand, Value: lit[1:]}
+			} else {
+				elem.literal = Token{Value: lit}
+			}
+			i = end + 1
+		default:
+			return fail(i, "unexpected character '"+string(str[i])+"'")
+		}
+		elem.min, elem.max = 1, 1
+		if i < len(str) {
+			switch str[i] {
+			case '?':
+				elem.min, elem.max = 0, 1
+				i++
+			case '*':
+				elem.min, elem.max = 0, -1
+				i++
+			case '+':
+				elem.min, elem.max = 1, -1
+				i++
+			}
+		}
+		pattern = append(pattern, elem)
+	}
+	return pattern, nil
+}
+
+func (pitz *Pitziil) lookupExtension(name string) (*extension, bool) {
+	if ext, ok := pitz.extensions[name]; ok {
+		return ext, true
+	}
+	ext, ok := extensions[name]
+	return ext, ok
+}
+
+// splitArgList splits toks at each comma that is not nested within braces or brackets, trimming surrounding whitespace.
+func splitArgList(toks []Token) [][]Token {
+	out := make([][]Token, 0)
+	start := 0
+	trimmed := func(t []Token) []Token {
+		for len(t) > 0 && t[0].Kind&(tokWhitespace|tokComment) > 0 {
+			t = t[1:]
+		}
+		for len(t) > 0 && t[len(t)-1].Kind&(tokWhitespace|tokComment) > 0 {
+			t = t[:len(t)-1]
+		}
+		return t
+	}
+	for i := 0; i < len(toks); i++ {
+		if toks[i].MatchOffset > 0 {
+			i += toks[i].MatchOffset
+			continue
+		}
+		if toks[i].Value == "," && toks[i].Kind&tokCommand == 0 {
+			out = append(out, trimmed(toks[start:i]))
+			start = i + 1
+		}
+	}
+	if start < len(toks) || len(out) > 0 {
+		out = append(out, trimmed(toks[start:]))
+	}
+	return out
+}
+
+// readArg attempts to read a single argument described by elem from b. On failure, b is left unchanged.
+func readArg(b *TokenBuffer, elem argElement, allowSingle bool) (CmdArg, bool) {
+	start := b.idx
+	var arg CmdArg
+	switch {
+	case elem.flavor&CF_LITERAL > 0:
+		t, err := b.GetNextToken()
+		if err != nil || t.Value != elem.literal.Value || (t.Kind&tokCommand) != elem.literal.Kind&tokCommand {
+			b.idx = start
+			return arg, false
+		}
+		arg.Flavor = CF_LITERAL
+		arg.Value = []Token{t}
+		return arg, true
+	case elem.flavor&CF_OPTION > 0:
+		opt, err := b.GetOptions()
+		if err != nil {
+			b.idx = start
+			return arg, false
+		}
+		arg.Flavor = elem.flavor
+		arg.Value = opt.Expr
+	case elem.flavor&CF_GROUPED > 0:
+		expr, err := b.GetNextExpr()
+		if err == nil {
+			arg.Flavor = elem.flavor
+			arg.Value = expr.Expr
+			break
+		}
+		if !allowSingle || !errors.Is(err, ErrTokenBufferSingle) {
+			b.idx = start
+			return arg, false
+		}
+		t, err := b.GetNextToken()
+		if err != nil || t.Kind&(tokClose|tokSubsup|tokReserved|tokInfix) > 0 {
+			b.idx = start
+			return arg, false
+		}
+		arg.Flavor = elem.flavor&^CF_GROUPED | CF_TOKEN
+		arg.Value = []Token{t}
+	}
+	if arg.Flavor&CF_COMMA_SEP > 0 {
+		arg.Items = splitArgList(arg.Value)
+	}
+	return arg, true
+}
+
+// matchArgPattern consumes arguments from b according to pattern, backtracking over quantified elements as needed. If
+// allowSingle is false, mandatory arguments must be enclosed in braces. On failure, b is left unchanged.
+func matchArgPattern(b *TokenBuffer, pattern []argElement, allowSingle bool) ([]CmdArg, bool) {
+	var try func(e, n int) ([]CmdArg, bool)
+	try = func(e, n int) ([]CmdArg, bool) {
+		if e == len(pattern) {
+			return nil, true
+		}
+		elem := pattern[e]
+		start := b.idx
+		if elem.max < 0 || n < elem.max {
+			single := allowSingle && elem.min == 1 && elem.max == 1
+			if arg, ok := readArg(b, elem, single); ok && b.idx > start {
+				if rest, ok := try(e, n+1); ok {
+					return append([]CmdArg{arg}, rest...), true
+				}
+			}
+			b.idx = start
+		}
+		if n >= elem.min {
+			return try(e+1, 0)
+		}
+		return nil, false
+	}
+	start := b.idx
+	args, ok := try(0, 0)
+	if !ok {
+		b.idx = start
+		return nil, false
+	}
+	b.jump = b.idx - start
+	return args, true
+}
+
+// matchExtensionArgs tries each of the patterns of ext in order, first requiring all arguments to be enclosed in braces
+// and then permitting single tokens.
+func matchExtensionArgs(b *TokenBuffer, ext *extension) ([]CmdArg, bool) {
+	for _, allowSingle := range []bool{false, true} {
+		for _, pattern := range ext.patterns {
+			if args, ok := matchArgPattern(b, pattern, allowSingle); ok {
+				return args, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (pitz *Pitziil) processExtension(context parseContext, tok Token, b *TokenBuffer, ext *extension) *MMLNode {
+	name := tok.Value
+	args, ok := matchExtensionArgs(b, ext)
+	if !ok {
+		return pitz.merror(DiagArgument, name, name+": arguments do not match any accepted pattern")
+	}
+	ctx := ExtContext{
+		pitz:    pitz,
+		ctx:     context,
+		command: name,
+		star:    tok.Kind&tokStarSuffix > 0,
+	}
+	n := NewMMLNode("mrow")
+	if err := ext.f(n, ctx, args); err != nil {
+		return pitz.merror(DiagExtension, name, err.Error())
+	}
+	n.Tok = tok
+	return n
+}
@@ -0,0 +1,951 @@
+package treeblood
+
+import (
+	_ "embed"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// HTMLStylesheet is the CSS for the HTML written when HTMLOutput is set. It must be included in any page showing such
+// equations, either in a <style> element or as a stylesheet of its own.
+//
+//go:embed treeblood.css
+var HTMLStylesheet string
+
+// WriteHTML writes the HTML for n and its children to w, for browsers whose MathML support falls short. The markup is
+// made of <span> elements whose classes are styled by HTMLStylesheet. See Pitziil.HTMLOutput.
+func (n *MMLNode) WriteHTML(w *strings.Builder) {
+	h := htmlWriter{w: w}
+	h.math(n)
+}
+
+// An htmlWriter writes a tree of MMLNodes as HTML and CSS. Fractions, scripts and limits are built from inline blocks,
+// while stretchy fences and radicals are drawn as the cells of an inline table, so that they grow to the height of
+// their contents.
+type htmlWriter struct {
+	w       mmlWriter
+	display bool // the current node is in display style
+	level   int  // the script level of the current node
+}
+
+// The classes of the operators that are drawn with CSS so that they can stretch. Vertical operators stretch to the
+// height of the row enclosing them, and horizontal ones to the width of an under- or overscript.
+var (
+	htmlVerticalOps = map[string]string{
+		"(": "tb-lparen", ")": "tb-rparen", "[": "tb-lbrack", "]": "tb-rbrack", "{": "tb-lbrace", "}": "tb-rbrace",
+		"|": "tb-vert", "∣": "tb-vert", "‖": "tb-dvert", "∥": "tb-dvert", "⟨": "tb-langle", "〈": "tb-langle",
+		"⟩": "tb-rangle", "〉": "tb-rangle", "⌊": "tb-lfloor", "⌋": "tb-rfloor", "⌈": "tb-lceil", "⌉": "tb-rceil",
+		"↑": "tb-uarr", "↓": "tb-darr", "↕": "tb-udarr", "⇑": "tb-uArr", "⇓": "tb-dArr", "⇕": "tb-udArr",
+	}
+	htmlHorizontalOps = map[string]string{
+		"→": "tb-rarr", "⟶": "tb-rarr", "⃗": "tb-rarr", "←": "tb-larr", "⟵": "tb-larr", "⃖": "tb-larr",
+		"↔": "tb-lrarr", "⟷": "tb-lrarr", "⇒": "tb-rArr", "⟹": "tb-rArr", "⇐": "tb-lArr", "⟸": "tb-lArr",
+		"⇔": "tb-lrArr", "⟺": "tb-lrArr", "↦": "tb-mapsto", "⟼": "tb-mapsto", "↪": "tb-rarr", "↩": "tb-larr",
+		"‾": "tb-hbar", "¯": "tb-hbar", "_": "tb-hbar", "̲": "tb-hbar", "̅": "tb-hbar", "―": "tb-hbar",
+		"^": "tb-hat", "ˆ": "tb-hat", "̂": "tb-hat", "~": "tb-tilde", "˜": "tb-tilde", "̃": "tb-tilde",
+		"⏞": "tb-overbrace", "⏟": "tb-underbrace", "⏜": "tb-overparen", "⏝": "tb-underparen",
+		"⎴": "tb-overbrack", "⎵": "tb-underbrack",
+	}
+	htmlVariants = map[string]string{
+		"normal": "tb-upright", "bold": "tb-bold tb-upright", "italic": "tb-italic", "bold-italic": "tb-bold tb-italic",
+		"sans-serif": "tb-sans tb-upright", "monospace": "tb-mono tb-upright",
+	}
+	htmlEnclosures = map[string]bool{
+		"box": true, "roundedbox": true, "circle": true, "left": true, "right": true, "top": true, "bottom": true,
+		"updiagonalstrike": true, "downdiagonalstrike": true, "horizontalstrike": true, "verticalstrike": true,
+		"longdiv": true, "actuarial": true, "madruwb": true,
+	}
+	htmlLengthPattern = regexp.MustCompile(`^-?(\d+\.?\d*|\.\d+)(em|ex|px|pt|pc|in|cm|mm|%)?$`)
+	htmlNamedSpaces   = map[string]float64{
+		"veryverythinmathspace": 1, "verythinmathspace": 2, "thinmathspace": 3, "mediummathspace": 4,
+		"thickmathspace": 5, "verythickmathspace": 6, "veryverythickmathspace": 7,
+	}
+)
+
+// htmlOperatorClasses maps the text of an <mo> to the class giving it the spacing of a relation, binary operator, or
+// punctuation in TeX.
+var htmlOperatorClasses = sync.OnceValue(func() map[string]string {
+	classes := map[string]string{
+		"=": "tb-rel", "<": "tb-rel", ">": "tb-rel", "+": "tb-bin", "-": "tb-bin", "−": "tb-bin", "*": "tb-bin",
+	}
+	for _, sym := range symbolTable {
+		if sym.char == "" {
+			continue
+		}
+		switch sym.kind {
+		case sym_relation:
+			classes[sym.char] = "tb-rel"
+		case sym_binaryop:
+			classes[sym.char] = "tb-bin"
+		}
+	}
+	classes[","] = "tb-punct"
+	classes[";"] = "tb-punct"
+	return classes
+})
+
+// htmlLength converts the MathML length v to CSS, or returns false if it has no CSS equivalent, such as the relative
+// lengths of <mpadded>.
+func htmlLength(v string) (string, bool) {
+	v = strings.TrimSpace(v)
+	if mu, ok := strings.CutSuffix(v, "mu"); ok {
+		f, err := strconv.ParseFloat(mu, 64)
+		if err != nil {
+			return "", false
+		}
+		return strconv.FormatFloat(f/18, 'f', -1, 64) + "em", true
+	}
+	if size, ok := htmlNamedSpaces[strings.TrimPrefix(v, "negative")]; ok {
+		if strings.HasPrefix(v, "negative") {
+			size = -size
+		}
+		return strconv.FormatFloat(math.Round(size/18*1e4)/1e4, 'f', -1, 64) + "em", true
+	}
+	if !htmlLengthPattern.MatchString(v) {
+		return "", false
+	}
+	return v, true
+}
+
+func (h *htmlWriter) text(s string) {
+	h.w.WriteString(xmlEscaper.Replace(s))
+}
+
+// open writes the start tag of a <span> with the given classes and inline style.
+func (h *htmlWriter) open(class, style string) {
+	h.w.WriteString(`<span`)
+	if class = strings.TrimSpace(class); class != "" {
+		h.w.WriteString(` class="` + class + `"`)
+	}
+	if style != "" {
+		h.w.WriteString(` style="`)
+		h.text(style)
+		h.w.WriteByte('"')
+	}
+	h.w.WriteByte('>')
+}
+
+func (h *htmlWriter) close() {
+	h.w.WriteString("</span>")
+}
+
+// style returns the inline style of n: its colors, size, and any CSS of its own.
+func (h *htmlWriter) style(n *MMLNode) string {
+	var sb strings.Builder
+	prop := func(key, val string) {
+		sb.WriteString(key)
+		sb.WriteByte(':')
+		sb.WriteString(val)
+		sb.WriteByte(';')
+	}
+	// colors are checked again here, since a color that is harmless in an attribute could add properties to the CSS
+	if c := n.Attrib["mathcolor"]; validColor(c) {
+		prop("color", c)
+	}
+	if c := n.Attrib["mathbackground"]; validColor(c) {
+		prop("background-color", c)
+	}
+	if size, ok := htmlLength(n.Attrib["mathsize"]); ok {
+		prop("font-size", size)
+	}
+	if level, err := strconv.Atoi(n.Attrib["scriptlevel"]); err == nil && level != 0 {
+		// each script level is 71% of the size of the one before it
+		prop("font-size", strconv.FormatFloat(math.Round(math.Pow(0.71, float64(level))*1000)/10, 'f', -1, 64)+"%")
+	}
+	var keybuf [8]string
+	for _, key := range sortedKeys(n.CSS, keybuf[:0]) {
+		prop(key, n.CSS[key])
+	}
+	if s := strings.TrimSpace(n.Attrib["style"]); s != "" && n.Tag != "math" {
+		sb.WriteString(s)
+		if !strings.HasSuffix(s, ";") {
+			sb.WriteByte(';')
+		}
+	}
+	return sb.String()
+}
+
+// restyle updates the display style and script level from the attributes of n.
+func (h *htmlWriter) restyle(n *MMLNode) {
+	switch n.Attrib["displaystyle"] {
+	case "true":
+		h.display = true
+	case "false":
+		h.display = false
+	}
+	if level := n.Attrib["scriptlevel"]; level != "" {
+		l, err := strconv.Atoi(level)
+		switch {
+		case err != nil:
+		case level[0] == '+' || level[0] == '-':
+			h.level = max(0, h.level+l)
+		default:
+			h.level = l
+		}
+	}
+}
+
+// scriptLevel raises the script level by steps and returns the class that shrinks the text to match. As in TeX, text
+// is not shrunk beyond the second level.
+func (h *htmlWriter) scriptLevel(steps int) string {
+	old := h.level
+	h.level += steps
+	switch min(h.level, 2) - min(old, 2) {
+	case 1:
+		return " tb-small"
+	case 2:
+		return " tb-smaller"
+	}
+	return ""
+}
+
+// math writes the <math> element n as a <span>, which is a block if n is a display equation. An equation number is
+// set at the right margin.
+func (h *htmlWriter) math(n *MMLNode) {
+	if n == nil {
+		return
+	}
+	if n.Tag != "math" {
+		h.node(n, "")
+		return
+	}
+	class := "tb-math"
+	if n.Attrib["display"] == "block" {
+		class += " tb-block"
+	}
+	h.display = n.Attrib["displaystyle"] == "true"
+	h.w.WriteString(`<span class="` + class + `" role="math"`)
+	label := n.Attrib["aria-label"]
+	if label == "" {
+		label = n.Speech()
+	}
+	if label != "" {
+		h.w.WriteString(` aria-label="`)
+		h.text(label)
+		h.w.WriteByte('"')
+	}
+	h.w.WriteByte('>')
+	body := n.Children
+	if len(body) == 1 && body[0] != nil && body[0].Tag == "semantics" {
+		body = body[0].Children
+	}
+	if len(body) > 0 && isNumberedEquation(body[0]) {
+		row := body[0].Children[0]
+		h.open("tb-eqno", "")
+		h.row(row.Children[0].Children)
+		h.close()
+		body = slices.Concat(row.Children[1].Children, body[1:])
+	}
+	h.row(body)
+	h.close()
+}
+
+// isNumberedEquation reports whether n is the table that wrapInMathTag uses to number an equation.
+func isNumberedEquation(n *MMLNode) bool {
+	return n != nil && n.Tag == "mtable" && len(n.Children) == 1 && n.Children[0] != nil &&
+		n.Children[0].Tag == "mlabeledtr" && len(n.Children[0].Children) == 2
+}
+
+func (h *htmlWriter) node(n *MMLNode, class string) {
+	if n == nil || n.Properties&propNonprint > 0 {
+		return
+	}
+	defer func(display bool, level int) {
+		h.display, h.level = display, level
+	}(h.display, h.level)
+	switch n.Tag {
+	case "annotation", "annotation-xml", "none", "mprescripts", "":
+		return
+	case "mtable":
+		h.table(n)
+		return
+	}
+	h.restyle(n)
+	switch n.Tag {
+	case "mi", "mn", "mo", "mtext", "ms":
+		h.token(n, class)
+	case "mspace":
+		h.space(n)
+	case "mfrac":
+		h.fraction(n)
+	case "msqrt", "mroot":
+		h.radical(n)
+	case "msub", "msup", "msubsup", "munder", "mover", "munderover":
+		h.scripts(n, class)
+	case "mmultiscripts":
+		h.multiscripts(n)
+	case "mpadded":
+		h.padded(n)
+	case "mphantom":
+		h.open("tb-mphantom", h.style(n))
+		h.row(n.Children)
+		h.close()
+	case "menclose":
+		h.enclose(n)
+	case "merror":
+		h.open("tb-merror", h.style(n))
+		if len(n.Children) == 0 {
+			h.text(nodeText(n))
+		}
+		h.row(n.Children)
+		h.close()
+	case "semantics":
+		if len(n.Children) > 0 {
+			h.node(n.Children[0], class)
+		}
+	default:
+		if len(n.Children) == 0 && n.Text != "" {
+			h.token(n, class)
+			return
+		}
+		h.group(n, class)
+	}
+}
+
+// group writes the children of a row-like element such as <mrow> or <mstyle>. The children are only wrapped in a
+// <span> if n has a style of its own, or if they include stretchy fences, which make the row an inline table.
+func (h *htmlWriter) group(n *MMLNode, class string) {
+	style := h.style(n)
+	if h.hasFences(n.Children) {
+		h.fenced(n.Children, class, style)
+		return
+	}
+	if class == "" && style == "" {
+		h.row(n.Children)
+		return
+	}
+	h.open(class, style)
+	if class != "" && len(n.Children) == 1 {
+		// an embellished operator already spaced by class
+		h.node(n.Children[0], "")
+	} else {
+		h.row(n.Children)
+	}
+	h.close()
+}
+
+// row writes a sequence of sibling nodes, spacing the operators among them.
+func (h *htmlWriter) row(nodes []*MMLNode) {
+	if h.hasFences(nodes) {
+		h.fenced(nodes, "", "")
+		return
+	}
+	for i, n := range nodes {
+		h.node(n, h.spacing(nodes, i))
+	}
+}
+
+// fenceClass returns the classes of n if it is a stretchy fence such as those of \left and \right, or "" otherwise.
+func fenceClass(n *MMLNode) string {
+	if n == nil || n.Tag != "mo" || (n.Attrib["stretchy"] != "true" && n.Attrib["strechy"] != "true") {
+		return ""
+	}
+	if class, ok := htmlVerticalOps[nodeText(n)]; ok {
+		return "tb-fence " + class
+	}
+	if nodeText(n) == "" {
+		// the empty fence of \left. or \right.
+		return "tb-fence"
+	}
+	return ""
+}
+
+func (h *htmlWriter) hasFences(nodes []*MMLNode) bool {
+	for _, n := range nodes {
+		if fenceClass(n) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// fenced writes nodes as the cells of an inline table, with each stretchy fence in a cell of its own so that it spans
+// the height of the row.
+func (h *htmlWriter) fenced(nodes []*MMLNode, class, style string) {
+	h.open("tb-fenced "+class, style)
+	inCell := false
+	for i, n := range nodes {
+		if fence := fenceClass(n); fence != "" {
+			if inCell {
+				h.close()
+				inCell = false
+			}
+			var height string
+			if size, ok := htmlLength(n.Attrib["minsize"]); ok {
+				height = "height:" + size + ";"
+			}
+			h.open(fence, height+h.style(n))
+			h.text(nodeText(n))
+			h.close()
+			continue
+		}
+		if n == nil || n.Properties&propNonprint > 0 {
+			continue
+		}
+		if !inCell {
+			h.open("tb-cell", "")
+			inCell = true
+		}
+		h.node(n, h.spacing(nodes, i))
+	}
+	if inCell {
+		h.close()
+	}
+	h.close()
+}
+
+// spacing returns the classes that space nodes[i] according to its neighbors, following TeX: relations, binary
+// operators and punctuation are spaced in display and text style but not in scripts, and a binary operator with no
+// operand before it is a sign. A function name such as sin is followed by a thin space.
+func (h *htmlWriter) spacing(nodes []*MMLNode, i int) string {
+	n := nodes[i]
+	if n == nil || h.level > 0 {
+		return ""
+	}
+	var prev, next *MMLNode
+	for j := i - 1; j >= 0 && prev == nil; j-- {
+		if nodes[j] != nil && nodes[j].Properties&propNonprint == 0 {
+			prev = nodes[j]
+		}
+	}
+	for j := i + 1; j < len(nodes) && next == nil; j++ {
+		if nodes[j] != nil && nodes[j].Properties&propNonprint == 0 {
+			next = nodes[j]
+		}
+	}
+	if op := coreOperator(n); op != nil {
+		class := htmlOperatorClasses()[nodeText(op)]
+		if class != "tb-bin" {
+			return class
+		}
+		form := op.Attrib["form"]
+		if form == "prefix" || form == "postfix" || prev == nil || next == nil {
+			return ""
+		}
+		if p := coreOperator(prev); p != nil && !strings.ContainsAny(nodeText(p), ")]}|⟩⌋⌉!") {
+			return ""
+		}
+		return class
+	}
+	if n.Tag == "mi" && utf8.RuneCountInString(nodeText(n)) > 1 && next != nil && next.Tag != "mo" && fenceClass(next) == "" {
+		return "tb-fn"
+	}
+	return ""
+}
+
+// coreOperator returns the <mo> at the core of n if n is an embellished operator, such as a relation with something
+// set over it, or nil otherwise. Unlike embellishedOp, this looks through scripts and limits to their base.
+func coreOperator(n *MMLNode) *MMLNode {
+	for n != nil {
+		switch n.Tag {
+		case "mo":
+			return n
+		case "msub", "msup", "msubsup", "munder", "mover", "munderover":
+			if len(n.Children) == 0 {
+				return nil
+			}
+		case "mrow", "mstyle":
+			if len(n.Children) != 1 {
+				return nil
+			}
+		default:
+			return nil
+		}
+		n = n.Children[0]
+	}
+	return nil
+}
+
+// token writes a token element such as <mi> or <mo>. Single letters in an <mi> are italic, as in TeX.
+func (h *htmlWriter) token(n *MMLNode, class string) {
+	text := nodeText(n)
+	classes := "tb-" + n.Tag
+	switch n.Tag {
+	case "mi":
+		if r, size := utf8.DecodeRuneInString(text); size != len(text) || !unicode.IsLetter(r) {
+			classes += " tb-upright"
+		}
+	case "mo":
+		if n.Attrib["largeop"] == "true" {
+			classes += " tb-largeop"
+			if h.display {
+				classes += " tb-displayop"
+			}
+		}
+	}
+	if variant := htmlVariants[n.Attrib["mathvariant"]]; variant != "" {
+		classes += " " + variant
+	}
+	style := h.style(n)
+	if l, ok := htmlLength(n.Attrib["lspace"]); ok {
+		style = "margin-left:" + l + ";" + style
+	}
+	if r, ok := htmlLength(n.Attrib["rspace"]); ok {
+		style = "margin-right:" + r + ";" + style
+	}
+	h.open(classes+" "+class, style)
+	h.text(text)
+	h.close()
+}
+
+// space writes an <mspace> as an empty inline block. A negative width is written as a negative margin.
+func (h *htmlWriter) space(n *MMLNode) {
+	if n.Attrib["linebreak"] == "newline" {
+		h.w.WriteString("<br>")
+		return
+	}
+	style := h.style(n)
+	if w, ok := htmlLength(n.Attrib["width"]); ok {
+		switch {
+		case strings.HasPrefix(w, "-"):
+			if !strings.Contains(style, "margin-left") {
+				style = "margin-left:" + w + ";" + style
+			}
+		default:
+			style = "width:" + w + ";" + style
+		}
+	}
+	height, hasHeight := htmlLength(n.Attrib["height"])
+	depth, hasDepth := htmlLength(n.Attrib["depth"])
+	switch {
+	case hasHeight && hasDepth:
+		style = "height:calc(" + height + " + " + depth + ");vertical-align:-" + depth + ";" + style
+	case hasHeight:
+		style = "height:" + height + ";" + style
+	case hasDepth:
+		style = "height:" + depth + ";vertical-align:-" + depth + ";" + style
+	}
+	h.open("tb-mspace", style)
+	h.close()
+}
+
+// fraction writes an <mfrac> as a numerator and denominator stacked in an inline block. In text style, they are set
+// at the size of scripts.
+func (h *htmlWriter) fraction(n *MMLNode) {
+	if len(n.Children) != 2 {
+		h.group(n, "")
+		return
+	}
+	class := "tb-mfrac"
+	if !h.display {
+		class += h.scriptLevel(1)
+	}
+	if t := n.Attrib["linethickness"]; t == "0" || t == "0em" || t == "0pt" {
+		class += " tb-nobar"
+	}
+	h.display = false
+	h.open(class, h.style(n))
+	h.open("tb-num", "")
+	h.node(n.Children[0], "")
+	h.close()
+	h.open("tb-den", "")
+	h.node(n.Children[1], "")
+	h.close()
+	h.close()
+}
+
+// radical writes an <msqrt> or <mroot> as an inline table, with the radical sign drawn in a cell of its own beside
+// the radicand. The index of an <mroot> is set before the sign.
+func (h *htmlWriter) radical(n *MMLNode) {
+	radicand := n.Children
+	var index *MMLNode
+	if n.Tag == "mroot" {
+		if len(n.Children) != 2 {
+			h.group(n, "")
+			return
+		}
+		radicand, index = n.Children[:1], n.Children[1]
+	}
+	h.open("tb-"+n.Tag, h.style(n))
+	if index != nil {
+		display, level := h.display, h.level
+		h.display = false
+		h.open("tb-index"+h.scriptLevel(2), "")
+		h.node(index, "")
+		h.close()
+		h.display, h.level = display, level
+	}
+	h.open("tb-surd", "")
+	h.w.WriteString("√")
+	h.close()
+	h.open("tb-radicand", "")
+	h.row(radicand)
+	h.close()
+	h.close()
+}
+
+// isMovable reports whether the limits of n are set as scripts outside display style, as for \sum and \lim.
+func isMovable(n *MMLNode) bool {
+	for n != nil && (n.Tag == "mrow" || n.Tag == "mstyle") && len(n.Children) == 1 {
+		n = n.Children[0]
+	}
+	return n != nil && (n.Attrib["movablelimits"] == "true" || n.Properties&propMovablelimits > 0)
+}
+
+// scripts writes the script elements. Subscripts and superscripts are raised and lowered inline blocks, while
+// underscripts and overscripts are stacked with the base, so that the base remains on the baseline. Accents are
+// written with combining characters where possible.
+func (h *htmlWriter) scripts(n *MMLNode, class string) {
+	var sub, sup *MMLNode
+	children := n.Children
+	switch {
+	case (n.Tag == "msub" || n.Tag == "munder") && len(children) == 2:
+		sub = children[1]
+	case (n.Tag == "msup" || n.Tag == "mover") && len(children) == 2:
+		sup = children[1]
+	case len(children) == 3:
+		sub, sup = children[1], children[2]
+	default:
+		h.group(n, class)
+		return
+	}
+	base := children[0]
+	underOver := strings.HasPrefix(n.Tag, "mu") || strings.HasPrefix(n.Tag, "mo")
+	if underOver && !h.display && isMovable(base) {
+		underOver = false
+	}
+	style := h.style(n)
+	if !underOver {
+		h.open("tb-"+n.Tag+" "+class, style)
+		h.node(base, "")
+		h.display = false
+		small := h.scriptLevel(1)
+		switch {
+		case sub != nil && sup != nil:
+			h.open("tb-subsup"+small, "")
+			h.script("tb-sup", sup)
+			h.script("tb-sub", sub)
+			h.close()
+		case sup != nil:
+			h.script("tb-sup"+small, sup)
+		default:
+			h.script("tb-sub"+small, sub)
+		}
+		h.close()
+		return
+	}
+	overAccent := n.Attrib["accent"] == "true"
+	underAccent := n.Attrib["accentunder"] == "true" || (n.Tag == "munder" && overAccent)
+	if sub == nil && overAccent || sup == nil && underAccent {
+		accent := sup
+		if accent == nil {
+			accent = sub
+		}
+		if h.combiningAccent(base, accent, style, class) {
+			return
+		}
+	}
+	h.open("tb-"+n.Tag+" "+class, style)
+	display, level := h.display, h.level
+	if sup != nil {
+		h.display = false
+		class := "tb-over"
+		if !overAccent {
+			class += h.scriptLevel(1)
+		}
+		h.limit(class, sup, overAccent)
+		h.display, h.level = display, level
+	}
+	if sub != nil {
+		h.open("tb-stack", "")
+	}
+	h.open("tb-base", "")
+	if op := h.stretchOp(base); op != "" {
+		h.open("tb-hstretch "+op, "")
+		h.text(nodeText(embellishedOp(base)))
+		h.close()
+	} else {
+		h.node(base, "")
+	}
+	h.close()
+	if sub != nil {
+		h.display = false
+		class := "tb-under"
+		if !underAccent {
+			class += h.scriptLevel(1)
+		}
+		h.limit(class, sub, underAccent)
+		h.close()
+	}
+	h.close()
+}
+
+// script writes a subscript or superscript. An empty script is given a zero-width space so that it keeps its height.
+func (h *htmlWriter) script(class string, n *MMLNode) {
+	h.open(class, "")
+	if n == nil || n.Tag == "none" {
+		h.w.WriteString("​")
+	} else {
+		h.node(n, "")
+	}
+	h.close()
+}
+
+// limit writes an underscript or overscript. A stretchy operator such as a brace or arrow is stretched to the width
+// of the stack.
+func (h *htmlWriter) limit(class string, n *MMLNode, accent bool) {
+	if accent {
+		class += " tb-accent"
+	}
+	if op := h.stretchOp(n); op != "" {
+		h.open(class+" tb-hstretch "+op, h.style(n))
+		h.text(nodeText(embellishedOp(n)))
+		h.close()
+		return
+	}
+	h.open(class, "")
+	h.node(n, "")
+	h.close()
+}
+
+// embellishedOp returns the <mo> at the core of n, looking through single-child rows, or nil if there is none.
+func embellishedOp(n *MMLNode) *MMLNode {
+	for n != nil && (n.Tag == "mrow" || n.Tag == "mstyle") && len(n.Children) == 1 {
+		n = n.Children[0]
+	}
+	if n == nil || n.Tag != "mo" {
+		return nil
+	}
+	return n
+}
+
+// stretchOp returns the class of n if it is an operator that stretches horizontally, or "" otherwise.
+func (h *htmlWriter) stretchOp(n *MMLNode) string {
+	op := embellishedOp(n)
+	if op == nil || (op.Attrib["stretchy"] == "false") {
+		return ""
+	}
+	if op.Attrib["stretchy"] != "true" && !strings.ContainsAny(nodeText(op), "⏞⏟⏜⏝⎴⎵") {
+		return ""
+	}
+	return htmlHorizontalOps[nodeText(op)]
+}
+
+// combiningAccent writes base with the accent as a combining character, and reports whether it could do so. Only
+// single characters can be accented this way; the accents of longer bases are stretched over them instead.
+func (h *htmlWriter) combiningAccent(base, accent *MMLNode, style, class string) bool {
+	leaf, op := speechLeaf(base), speechLeaf(accent)
+	if leaf == nil || op == nil || op.Tag != "mo" || leaf != base {
+		return false
+	}
+	mark, ok := combiningAccents[nodeText(op)]
+	text := nodeText(leaf)
+	if !ok || utf8.RuneCountInString(text) != 1 {
+		return false
+	}
+	accented := *leaf
+	accented.Text = xmlEscaper.Replace(text + mark)
+	if style != "" {
+		h.open(class, style)
+		h.node(&accented, "")
+		h.close()
+		return true
+	}
+	h.node(&accented, class)
+	return true
+}
+
+// multiscripts writes an <mmultiscripts> with its prescripts and postscripts as stacks of subscripts and
+// superscripts on either side of the base.
+func (h *htmlWriter) multiscripts(n *MMLNode) {
+	if len(n.Children) == 0 {
+		return
+	}
+	var post, pre []*MMLNode
+	inPre := false
+	for _, child := range n.Children[1:] {
+		switch {
+		case child != nil && child.Tag == "mprescripts":
+			inPre = true
+		case inPre:
+			pre = append(pre, child)
+		default:
+			post = append(post, child)
+		}
+	}
+	h.open("tb-mmultiscripts", h.style(n))
+	stacks := func(scripts []*MMLNode) {
+		display, level := h.display, h.level
+		h.display = false
+		small := h.scriptLevel(1)
+		for i := 0; i+1 < len(scripts); i += 2 {
+			h.open("tb-subsup"+small, "")
+			h.script("tb-sup", scripts[i+1])
+			h.script("tb-sub", scripts[i])
+			h.close()
+		}
+		h.display, h.level = display, level
+	}
+	stacks(pre)
+	h.node(n.Children[0], "")
+	stacks(post)
+	h.close()
+}
+
+// padded writes an <mpadded> as an inline block. Its width and left space are written when they are plain lengths,
+// and a vertical offset moves the contents without moving the box.
+func (h *htmlWriter) padded(n *MMLNode) {
+	style := h.style(n)
+	if w, ok := htmlLength(n.Attrib["width"]); ok {
+		style = "width:" + w + ";" + style
+	} else if w, ok := htmlLength(strings.TrimPrefix(n.Attrib["width"], "+")); ok && strings.HasPrefix(n.Attrib["width"], "+") {
+		style = "padding-right:" + w + ";" + style
+	}
+	if l, ok := htmlLength(n.Attrib["lspace"]); ok && l != "0" {
+		if strings.HasPrefix(l, "-") {
+			style = "margin-left:" + l + ";" + style
+		} else {
+			style = "padding-left:" + l + ";" + style
+		}
+	}
+	if v, ok := htmlLength(n.Attrib["voffset"]); ok && v != "0" {
+		style = "position:relative;top:calc(-1 * " + v + ");" + style
+	}
+	// contents moved by a transform of their own, as with \mathllap and \mathclap, must be a flex item for the
+	// transform to apply to them
+	if len(n.Children) == 1 && n.Children[0] != nil && n.Children[0].CSS["transform"] != "" {
+		style = "display:inline-flex;" + style
+	}
+	h.open("tb-mpadded", style)
+	h.row(n.Children)
+	h.close()
+}
+
+// enclose writes an <menclose>, with a class for each of its notations.
+func (h *htmlWriter) enclose(n *MMLNode) {
+	class := "tb-menclose"
+	notation := strings.Fields(n.Attrib["notation"])
+	if len(notation) == 0 {
+		notation = []string{"longdiv"}
+	}
+	for _, note := range notation {
+		if htmlEnclosures[note] {
+			class += " tb-" + note
+		}
+	}
+	h.open(class, h.style(n))
+	h.row(n.Children)
+	h.close()
+}
+
+// table writes an <mtable> as an inline grid. Each cell is placed in its row and column explicitly, so that the cells
+// spanning several rows or columns, and the rows with fewer cells than others, are laid out as in MathML. The lines
+// between rows and columns are drawn as borders of the cells. The labels of numbered rows are set in a column of
+// their own.
+func (h *htmlWriter) table(n *MMLNode) {
+	h.display = false
+	h.restyle(n)
+	display, level := h.display, h.level
+	var rows []*MMLNode
+	for _, row := range n.Children {
+		if row != nil && (row.Tag == "mtr" || row.Tag == "mlabeledtr") {
+			rows = append(rows, row)
+		}
+	}
+	// find the column of each cell, skipping those covered by cells from rows above
+	type cell struct {
+		n                        *MMLNode
+		col, rowspan, columnspan int
+	}
+	cells := make([][]cell, len(rows))
+	covered := make(map[[2]int]bool)
+	cols := 0
+	for r, row := range rows {
+		tds := row.Children
+		if row.Tag == "mlabeledtr" && len(tds) > 0 {
+			tds = tds[1:]
+		}
+		col := 0
+		for _, td := range tds {
+			if td == nil {
+				continue
+			}
+			for covered[[2]int{r, col}] {
+				col++
+			}
+			c := cell{n: td, col: col, rowspan: 1, columnspan: 1}
+			if span, err := strconv.Atoi(td.Attrib["rowspan"]); err == nil && span > 1 {
+				c.rowspan = span
+			}
+			if span, err := strconv.Atoi(td.Attrib["columnspan"]); err == nil && span > 1 {
+				c.columnspan = span
+			}
+			for i := range c.rowspan {
+				for j := range c.columnspan {
+					covered[[2]int{r + i, col + j}] = true
+				}
+			}
+			cells[r] = append(cells[r], c)
+			col += c.columnspan
+		}
+		cols = max(cols, col)
+	}
+	nth := func(list []string, i int) string {
+		if len(list) == 0 {
+			return ""
+		}
+		return list[min(i, len(list)-1)]
+	}
+	align := strings.Fields(n.Attrib["columnalign"])
+	columnlines := strings.Fields(n.Attrib["columnlines"])
+	rowlines := strings.Fields(n.Attrib["rowlines"])
+	rowspacing := strings.Fields(n.Attrib["rowspacing"])
+	class := "tb-mtable"
+	if f := n.Attrib["frame"]; f == "solid" || f == "dashed" {
+		class += " tb-frame"
+	}
+	h.open(class, h.style(n))
+	for r, row := range rows {
+		h.open("tb-mtr", "")
+		for _, c := range cells[r] {
+			var style strings.Builder
+			style.WriteString("grid-row:" + strconv.Itoa(r+1))
+			if c.rowspan > 1 {
+				style.WriteString("/span " + strconv.Itoa(c.rowspan) + ";align-self:center")
+			}
+			style.WriteString(";grid-column:" + strconv.Itoa(c.col+1))
+			if c.columnspan > 1 {
+				style.WriteString("/span " + strconv.Itoa(c.columnspan))
+			}
+			style.WriteByte(';')
+			if a := c.n.Attrib["columnalign"]; a != "" && c.n.CSS["text-align"] == "" {
+				style.WriteString("text-align:" + a + ";")
+			} else if a := nth(align, c.col); a != "" && a != "center" && c.n.CSS["text-align"] == "" {
+				style.WriteString("text-align:" + a + ";")
+			}
+			if line := nth(columnlines, c.col+c.columnspan-1); line != "" && line != "none" && c.col+c.columnspan < cols {
+				style.WriteString("border-right:0.06em " + line + ";")
+			}
+			last := r + c.rowspan - 1
+			if line := nth(rowlines, last); line != "" && line != "none" && last+1 < len(rows) {
+				style.WriteString("border-bottom:0.06em " + line + ";")
+			}
+			if r > 0 {
+				if s := nth(rowspacing, r-1); s != "" && s != "1.0ex" && s != "1ex" {
+					style.WriteString("padding-top:calc(" + s + " / 2);")
+				}
+			}
+			if s := nth(rowspacing, last); last+1 < len(rows) && s != "" && s != "1.0ex" && s != "1ex" {
+				style.WriteString("padding-bottom:calc(" + s + " / 2);")
+			}
+			h.open("tb-mtd", style.String()+h.style(c.n))
+			h.restyle(c.n)
+			h.row(c.n.Children)
+			h.close()
+			h.display, h.level = display, level
+		}
+		if row.Tag == "mlabeledtr" && len(row.Children) > 0 {
+			h.open("tb-mlabel", "grid-row:"+strconv.Itoa(r+1)+";grid-column:"+strconv.Itoa(cols+1)+";")
+			h.node(row.Children[0], "")
+			h.close()
+		}
+		h.close()
+	}
+	h.close()
+}
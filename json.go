@@ -0,0 +1,126 @@
+package treeblood
+
+import (
+	"encoding/json"
+	"html"
+	"io"
+	"strings"
+)
+
+// jsonNode is the JSON encoding of an MMLNode. For example, the MathML <mi mathvariant="normal">x</mi> created from
+// the TeX \mathrm{x} is encoded as
+//
+//	{"tag":"mi","text":"x","attributes":{"mathvariant":"normal"},"span":[8,9]}
+//
+// The text is given as plain Unicode, with any XML entities (such as &lt;) replaced by the characters they stand for.
+// The keys of "attributes" (the XML attributes) and "css" (the inline style properties) are written in sorted order.
+// "span" holds the start and end rune offsets of the TeX from which the node was created (or, for nodes such as <msup>
+// that are not created from a single token, the extent of their children), and is only present if requested when
+// encoding. Empty fields are omitted. Nodes that do not appear in the MathML output, such as those left by \label, are
+// not encoded.
+type jsonNode struct {
+	Tag        string            `json:"tag"`
+	Text       string            `json:"text,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	CSS        map[string]string `json:"css,omitempty"`
+	Children   []*jsonNode       `json:"children,omitempty"`
+	Span       *[2]int           `json:"span,omitempty"`
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (n *MMLNode) toJSON(spans bool) *jsonNode {
+	out := &jsonNode{
+		Tag:  n.Tag,
+		Text: html.UnescapeString(n.Text),
+	}
+	if len(n.Attrib) > 0 {
+		out.Attributes = n.Attrib
+	}
+	if len(n.CSS) > 0 {
+		out.CSS = n.CSS
+	}
+	if spans && n.Tok.end > n.Tok.start {
+		out.Span = &[2]int{n.Tok.start, n.Tok.end}
+	}
+	for _, child := range n.Children {
+		if child == nil || child.Properties&propNonprint > 0 || child.Tag == "" {
+			continue
+		}
+		c := child.toJSON(spans)
+		out.Children = append(out.Children, c)
+		if spans && c.Span != nil && n.Tok.end <= n.Tok.start {
+			// nodes such as <msup> that do not come from a single token span their children
+			if out.Span == nil {
+				out.Span = &[2]int{c.Span[0], c.Span[1]}
+			}
+			out.Span[0] = min(out.Span[0], c.Span[0])
+			out.Span[1] = max(out.Span[1], c.Span[1])
+		}
+	}
+	return out
+}
+
+func (j *jsonNode) toMML() *MMLNode {
+	n := NewMMLNode(j.Tag, textEscaper.Replace(j.Text))
+	for k, v := range j.Attributes {
+		n.Attrib[k] = v
+	}
+	for k, v := range j.CSS {
+		n.CSS[k] = v
+	}
+	if j.Span != nil {
+		n.Tok.start, n.Tok.end = j.Span[0], j.Span[1]
+	}
+	for _, child := range j.Children {
+		if child != nil {
+			n.Children = append(n.Children, child.toMML())
+		}
+	}
+	return n
+}
+
+// MarshalJSON encodes the tree rooted at n as JSON, without source spans. See EncodeJSON.
+func (n *MMLNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.toJSON(false))
+}
+
+// UnmarshalJSON decodes a tree encoded by MarshalJSON or EncodeJSON into n. Any source spans are restored, so that the
+// tree may be re-encoded with the same spans.
+func (n *MMLNode) UnmarshalJSON(data []byte) error {
+	var j jsonNode
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*n = *j.toMML()
+	return nil
+}
+
+// EncodeJSON writes the tree rooted at n to w as JSON. Each node is an object with the keys "tag", "text",
+// "attributes", "css", "children", and, if spans is set, "span": the start and end rune offsets of the TeX from which
+// the node was created. For example, the <mrow> for `x^2` is encoded as
+//
+//	{"tag":"mrow","children":[{"tag":"msup","children":[{"tag":"mi","text":"x","span":[0,1]},
+//		{"tag":"mn","text":"2","span":[2,3]}],"span":[0,3]}],"span":[0,3]}
+//
+// The tree can be decoded with json.Unmarshal into an MMLNode.
+func (n *MMLNode) EncodeJSON(w io.Writer, spans bool) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(n.toJSON(spans))
+}
+
+// RenderJSON writes the tree of the <math> element for tex to w as JSON, as described by MMLNode.EncodeJSON. The tree
+// is the same as that written by RenderTo.
+func (pitz *Pitziil) RenderJSON(w io.Writer, tex string, display, spans bool) error {
+	ast, rc, err := pitz.renderAST(tex, display)
+	if ast == nil {
+		return err
+	}
+	pitz.resolveLabels(rc.pending)
+	pitz.speakMath(ast)
+	if jerr := ast.EncodeJSON(w, spans); jerr != nil {
+		return jerr
+	}
+	return err
+}
@@ -0,0 +1,275 @@
+package treeblood
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// pendingLabel is an equation number or reference whose text cannot be known until the equations before it in the
+// document have been numbered. The text of node is filled in by resolveLabels.
+type pendingLabel struct {
+	node  *MMLNode    // the <mtext> to receive the text
+	eq    equationTag // for equation numbers, the \tag and \label commands belonging to the equation
+	ref   string      // for references, the key of the label
+	eqref bool        // true for \eqref, which is displayed in parentheses
+}
+
+// equationTag collects the \tag, \notag, and \label commands encountered while parsing a single equation.
+type equationTag struct {
+	tag      string     // the text of \tag{...}, which is also the value of its labels
+	tagNode  *MMLNode   // the argument of \tag{...}, set as text
+	hasTag   bool       // true if \tag was given
+	star     bool       // true for \tag*{...}, which is displayed without parentheses
+	noNumber bool       // true if \notag or \nonumber was given
+	labels   []*MMLNode // the placeholders of any \label{...} commands, holding the key as their Option
+	// true if an environment such as align has numbered its own rows, in which case the equation as a whole is not
+	// numbered.
+	envNumbered bool
+}
+
+// Labels returns a copy of the table of \label keys and the equation numbers (or tags) assigned to them so far.
+func (pitz *Pitziil) Labels() map[string]string {
+	pitz.mu.Lock()
+	defer pitz.mu.Unlock()
+	out := make(map[string]string, len(pitz.labels))
+	for k, v := range pitz.labels {
+		out[k] = v
+	}
+	return out
+}
+
+// UnresolvedRefs returns the sorted keys of any \ref or \eqref commands that could not be resolved when they were
+// rendered, either because the label is defined later in the document or not at all.
+func (pitz *Pitziil) UnresolvedRefs() []string {
+	pitz.mu.Lock()
+	defer pitz.mu.Unlock()
+	out := make([]string, 0, len(pitz.unresolvedRefs))
+	for k := range pitz.unresolvedRefs {
+		out = append(out, k)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// equationLabel processes \tag, \notag, \nonumber, \label, \ref, and \eqref.
+func (pitz *Pitziil) equationLabel(name string, star bool, b *TokenBuffer) *MMLNode {
+	// placeholder for commands that only modify the state of the current equation. The placeholder remembers the
+	// command and its argument so that numbered environments can find the labels belonging to each row.
+	nonprint := NewMMLNode().SetProps(propNonprint)
+	nonprint.Text = name
+	if star {
+		nonprint.Text += "*"
+	}
+	switch name {
+	case "notag", "nonumber":
+		pitz.rc.eq.noNumber = true
+		return nonprint
+	}
+	buf, err := b.GetNextExpr()
+	if errors.Is(err, ErrTokenBufferSingle) {
+		buf, err = b.GetNextN(1, true)
+	}
+	if err != nil {
+		return pitz.merror(DiagArgument, name, fmt.Sprintf("%s expects an argument", name))
+	}
+	arg := StringifyTokens(buf.Expr)
+	nonprint.Option = arg
+	switch name {
+	case "tag":
+		// the tag is set as text, as with \text. The placeholder holds it for collectEquationTag.
+		tag := pitz.parseText(buf, textContext(0, "text"))
+		if tag.Tag == "mtext" && len(tag.Children) == 0 {
+			arg = tag.Text
+			nonprint.Option = arg
+		}
+		nonprint.AppendChild(tag)
+		pitz.rc.eq.tag = arg
+		pitz.rc.eq.tagNode = tag
+		pitz.rc.eq.hasTag = true
+		pitz.rc.eq.star = star
+		return nonprint
+	case "label":
+		pitz.rc.eq.labels = append(pitz.rc.eq.labels, nonprint)
+		return nonprint
+	}
+	n := NewMMLNode("mtext")
+	pitz.rc.pending = append(pitz.rc.pending, pendingLabel{node: n, ref: arg, eqref: name == "eqref"})
+	return n
+}
+
+// nextEquationTag returns an <mtext> to hold the label of the current equation. The boolean result is false if the
+// equation should not be labelled. The text of the label is filled in by resolveLabels.
+func (pitz *Pitziil) nextEquationTag() (*MMLNode, bool) {
+	eq := pitz.rc.eq
+	pitz.rc.eq = equationTag{}
+	if !pitz.rc.display || eq.envNumbered {
+		return nil, false
+	}
+	return pitz.equationTagNode(eq, pitz.DoNumbering)
+}
+
+// equationTagNode returns an <mtext> to hold the label for eq if it has a \tag, or if autonumber is set and eq has no
+// \notag. The boolean result is false if the equation should not be labelled.
+func (pitz *Pitziil) equationTagNode(eq equationTag, autonumber bool) (*MMLNode, bool) {
+	if !eq.hasTag && (eq.noNumber || !autonumber) {
+		return nil, false
+	}
+	n := NewMMLNode("mtext")
+	pitz.rc.pending = append(pitz.rc.pending, pendingLabel{node: n, eq: eq})
+	return n, true
+}
+
+// resolveLabels fills in the text of pending equation numbers and references in the order given, stepping EQCount for
+// each automatically numbered equation and assigning any \label keys. Unresolved references and labels that are
+// defined more than once are reported in the returned diagnostics.
+func (pitz *Pitziil) resolveLabels(pending []pendingLabel) (diagnostics []Diagnostic) {
+	if len(pending) == 0 {
+		return nil
+	}
+	pitz.mu.Lock()
+	defer pitz.mu.Unlock()
+	for _, p := range pending {
+		if p.ref != "" {
+			value, ok := pitz.labels[p.ref]
+			if !ok {
+				pitz.unresolvedRefs[p.ref] = true
+				value = "??"
+				p.node.SetAttr("title", "unresolved reference: "+p.ref)
+				d := Diagnostic{
+					Severity: SeverityWarning,
+					Code:     DiagLabel,
+					Message:  "unresolved reference: " + p.ref,
+					Start:    p.node.Tok.start,
+					End:      p.node.Tok.end,
+				}
+				pitz.log(d)
+				diagnostics = append(diagnostics, d)
+			}
+			if p.eqref {
+				value = "(" + value + ")"
+			}
+			p.node.Text = value
+			continue
+		}
+		var value string
+		if p.eq.hasTag {
+			value = p.eq.tag
+			setTag(p.node, p.eq)
+		} else {
+			pitz.EQCount++
+			value = strconv.Itoa(pitz.EQCount)
+			p.node.Text = "(" + value + ")"
+		}
+		for _, label := range p.eq.labels {
+			key := label.Option
+			if _, ok := pitz.labels[key]; ok {
+				d := Diagnostic{
+					Severity: SeverityWarning,
+					Code:     DiagLabel,
+					Message:  fmt.Sprintf("label '%s' multiply defined", key),
+					Start:    label.Tok.start,
+					End:      label.Tok.end,
+				}
+				pitz.log(d)
+				diagnostics = append(diagnostics, d)
+			}
+			pitz.labels[key] = value
+		}
+	}
+	return diagnostics
+}
+
+// setTag sets the <mtext> n to the \tag of eq, in parentheses unless the tag is starred. A tag that is not plain text,
+// such as one containing math, turns n into an <mrow>.
+func setTag(n *MMLNode, eq equationTag) {
+	open, close := "(", ")"
+	if eq.star {
+		open, close = "", ""
+	}
+	tag := eq.tagNode
+	if tag == nil || tag.Tag == "mtext" && len(tag.Children) == 0 {
+		n.Text = open + eq.tag + close
+		if tag != nil {
+			maps.Copy(n.Attrib, tag.Attrib)
+			maps.Copy(n.CSS, tag.CSS)
+		}
+		return
+	}
+	n.Tag = "mrow"
+	if open != "" {
+		n.AppendNew("mtext", open)
+	}
+	n.AppendChild(tag)
+	if close != "" {
+		n.AppendNew("mtext", close)
+	}
+}
+
+// collectEquationTag gathers the \tag, \notag, and \label placeholders left by equationLabel within n, not descending
+// into nested tables.
+func collectEquationTag(n *MMLNode, eq *equationTag) {
+	for _, child := range n.Children {
+		if child == nil {
+			continue
+		}
+		if child.Properties&propNonprint > 0 {
+			switch child.Text {
+			case "tag", "tag*":
+				eq.tag = child.Option
+				if len(child.Children) > 0 {
+					eq.tagNode = child.Children[0]
+				}
+				eq.hasTag = true
+				eq.star = child.Text == "tag*"
+			case "notag", "nonumber", "notag*", "nonumber*":
+				eq.noNumber = true
+			case "label", "label*":
+				eq.labels = append(eq.labels, child)
+			}
+			continue
+		}
+		if child.Tag == "mtable" {
+			continue
+		}
+		collectEquationTag(child, eq)
+	}
+}
+
+// numberRows gives the rows of a display environment such as align their own equation numbers, turning each numbered
+// <mtr> into an <mlabeledtr>. The unstarred environments are numbered automatically when DoNumbering is set; \tag is
+// honored in either form. multline receives a single number on its last row.
+func (pitz *Pitziil) numberRows(table *MMLNode, env string) {
+	if table == nil || !pitz.rc.display {
+		return
+	}
+	pitz.rc.eq.envNumbered = true
+	autonumber := pitz.DoNumbering && !strings.HasSuffix(env, "*")
+	label := func(row *MMLNode, text *MMLNode) {
+		cell := NewMMLNode("mtd")
+		cell.AppendChild(text)
+		row.Tag = "mlabeledtr"
+		row.Children = append([]*MMLNode{cell}, row.Children...)
+	}
+	if strings.TrimSuffix(env, "*") == "multline" {
+		var eq equationTag
+		collectEquationTag(table, &eq)
+		if text, ok := pitz.equationTagNode(eq, autonumber); ok && len(table.Children) > 0 {
+			label(table.Children[len(table.Children)-1], text)
+		}
+		return
+	}
+	for _, row := range table.Children {
+		if row == nil || row.Tag != "mtr" {
+			continue
+		}
+		var eq equationTag
+		collectEquationTag(row, &eq)
+		if text, ok := pitz.equationTagNode(eq, autonumber); ok {
+			label(row, text)
+		}
+	}
+}
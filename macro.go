@@ -1,6 +1,7 @@
 package treeblood
 
 import (
+	"fmt"
 	"strconv"
 )
 
@@ -28,9 +29,8 @@ func topological_sort(graph [][]bool, sources *stack[int]) ([]int, error) {
 	cycle_free := make(map[int]bool)
 	for _, row := range graph {
 		for i, edge := range row {
-			if edge {
-				logger.Println("WARN: cyclic or recursive macro definition")
-			} else {
+			// macros left with incoming edges are cyclic or recursive. PrepareMacros reports them.
+			if !edge {
 				cycle_free[i] = true
 			}
 		}
@@ -83,10 +83,7 @@ func resolve_dependency_graph(macros map[string][]Token) []string {
 			sources.Push(i)
 		}
 	}
-	process_order, err := topological_sort(graph, sources)
-	if err != nil {
-		logger.Println(err.Error())
-	}
+	process_order, _ := topological_sort(graph, sources)
 	result := make([]string, 0, len(macros))
 	for _, idx := range process_order {
 		// we don't need to care about "stand alone" macros for flattening
@@ -116,14 +113,31 @@ func ExpandSingleMacro(m Macro, args []*TokenBuffer) ([]Token, error) {
 	return result, nil
 }
 
+// PrepareMacros compiles macros, given as key-value pairs of a command name (without a leading backslash) and its
+// definition, for use with ExpandMacros. Macros that cannot be compiled are replaced with an error.
 func PrepareMacros(macros map[string]string) map[string]Macro {
+	prepared, _ := prepareMacros(macros)
+	return prepared
+}
+
+// prepareMacros compiles macros as PrepareMacros does, additionally returning a Diagnostic for each macro that could
+// not be compiled.
+func prepareMacros(macros map[string]string) (map[string]Macro, []Diagnostic) {
+	var diagnostics []Diagnostic
+	report := func(format string, args ...any) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     DiagMacro,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
 	tokenized_macros := make(map[string][]Token)
 	info := make(map[string]Macro)
 	argcounts := make(map[string]int)
 	for macro, def := range macros {
 		toks, err := tokenize([]rune(def))
 		if err != nil {
-			logger.Println(err.Error())
+			report("could not compile macro '%s': %s", macro, err.Error())
 			continue
 		}
 		argcounts[macro] = 0
@@ -141,7 +155,7 @@ func PrepareMacros(macros map[string]string) map[string]Macro {
 		toks := tokenized_macros[macro]
 		result, err := ExpandMacros(toks, info)
 		if err != nil {
-			logger.Printf("could not flatten macro '%s': %s\n", macro, err.Error())
+			report("could not flatten macro '%s': %s", macro, err.Error())
 		} else {
 			flattened[macro] = Macro{Definition: result, Argcount: argcounts[macro]}
 			tokenized_macros[macro] = result
@@ -155,13 +169,24 @@ func PrepareMacros(macros map[string]string) map[string]Macro {
 	}
 	for macro := range tokenized_macros {
 		if _, ok := flattened[macro]; !ok {
+			report("cyclic or recursive macro definition: '%s'", macro)
 			flattened[macro] = Macro{
 				Definition: []Token{{Value: macro, Kind: tokBadmacro}},
 				Argcount:   0,
 			}
 		}
 	}
-	return flattened
+	return flattened, diagnostics
+}
+
+// relocate returns a copy of toks with the location of every token set to start and end.
+func relocate(toks []Token, start, end int) []Token {
+	out := make([]Token, len(toks))
+	for i, t := range toks {
+		t.start, t.end = start, end
+		out[i] = t
+	}
+	return out
 }
 
 func ExpandMacros(toks []Token, macros map[string]Macro) ([]Token, error) {
@@ -182,6 +207,8 @@ func ExpandMacros(toks []Token, macros map[string]Macro) ([]Token, error) {
 					temp, i, _ = GetNextExpr(toks, i+1)
 					args[n] = NewTokenBuffer(temp)
 				}
+				// tokens from the definition take the location of the macro invocation
+				def.Definition = relocate(def.Definition, t.start, toks[min(i, len(toks)-1)].end)
 				temp, err := ExpandSingleMacro(def, args)
 				if err != nil {
 					return nil, err
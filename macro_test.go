@@ -23,4 +23,12 @@ func TestMacroExpansion(t *testing.T) {
 		`\mutuallydependentA{\pi}`,
 		`\mutuallydependentB{\phi}`,
 	}
+	doc := NewDocument(macros, false)
+	for _, expr := range tex {
+		res, err := doc.DisplayStyle(expr)
+		if err != nil {
+			t.Errorf("%s: %s", expr, err.Error())
+		}
+		f.WriteString(res)
+	}
 }
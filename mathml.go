@@ -0,0 +1,183 @@
+package treeblood
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	// named character references such as &InvisibleTimes;, which are common in MathML but unknown to encoding/xml
+	namedEntity = regexp.MustCompile(`&[A-Za-z][A-Za-z0-9]*;`)
+	// encodings of the <annotation> holding the TeX source of an equation
+	texEncodings = map[string]bool{
+		"application/x-tex":   true,
+		"application/x-latex": true,
+		"TeX":                 true,
+		"LaTeX":               true,
+	}
+	// escapes the text of an element as TreeBlood writes it
+	mathmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\u00a0", "&nbsp;")
+	// the elements of MathML, which are the only ones accepted as the root of a tree by ParseMathML
+	mathmlElements = map[string]bool{
+		"math": true, "semantics": true, "annotation": true, "annotation-xml": true,
+		"mi": true, "mn": true, "mo": true, "mtext": true, "ms": true, "mspace": true, "mglyph": true,
+		"mrow": true, "mfrac": true, "msqrt": true, "mroot": true, "mstyle": true, "merror": true, "mpadded": true,
+		"mphantom": true, "mfenced": true, "menclose": true, "maction": true,
+		"msub": true, "msup": true, "msubsup": true, "munder": true, "mover": true, "munderover": true,
+		"mmultiscripts": true, "mprescripts": true, "none": true,
+		"mtable": true, "mtr": true, "mlabeledtr": true, "mtd": true, "maligngroup": true, "malignmark": true,
+		"mstack": true, "mlongdiv": true, "msgroup": true, "msrow": true, "mscarries": true, "mscarry": true,
+		"msline": true,
+	}
+	// elements whose text is not subject to the whitespace rules of MathML token elements
+	verbatimTags = map[string]bool{
+		"annotation": true,
+		"ms":         true,
+	}
+)
+
+// ParseMathML reads a MathML element, usually <math>, from r and returns it as a tree of MMLNodes, as if it had been
+// created by TreeBlood. A root that is not a MathML element, such as the HTML written when HTMLOutput is set, is an
+// error. Named character references from HTML, such as &InvisibleTimes;, are accepted, as is a bare & in an
+// annotation. Leading and trailing whitespace in token elements is removed and other runs of whitespace are collapsed,
+// following the MathML specification. Namespace prefixes on elements are dropped. The TeX from which the MathML was
+// created, if it is given in an annotation, is available from the returned tree with TeX.
+func ParseMathML(r io.Reader) (*MMLNode, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	src = namedEntity.ReplaceAllFunc(src, func(ref []byte) []byte {
+		switch string(ref) {
+		case "&amp;", "&lt;", "&gt;", "&quot;", "&apos;":
+			return ref
+		}
+		if text := html.UnescapeString(string(ref)); text != string(ref) {
+			return []byte(xmlEscaper.Replace(text))
+		}
+		return ref
+	})
+	dec := xml.NewDecoder(bytes.NewReader(src))
+	dec.Strict = false
+	var root *MMLNode
+	stack := newStack[*MMLNode]()
+	var text strings.Builder
+	for {
+		// the raw tokens are used so that mismatched tags are reported rather than closed automatically
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := NewMMLNode(t.Name.Local)
+			for _, attr := range t.Attr {
+				key := attr.Name.Local
+				if attr.Name.Space == "xmlns" {
+					key = "xmlns:" + key
+				}
+				n.Attrib[key] = xmlEscaper.Replace(attr.Value)
+			}
+			n.propertiesFromAttribs()
+			if stack.empty() {
+				if !mathmlElements[n.Tag] {
+					return nil, errors.New("<" + t.Name.Local + "> is not a MathML element")
+				}
+				root = n
+			} else {
+				stack.Peek().AppendChild(n)
+			}
+			stack.Push(n)
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if stack.empty() {
+				return nil, errors.New("unexpected closing tag </" + t.Name.Local + ">")
+			}
+			n := stack.Pop()
+			if t.Name.Local != n.Tag {
+				return nil, errors.New("mismatched closing tag </" + t.Name.Local + "> for <" + n.Tag + ">")
+			}
+			if len(n.Children) == 0 {
+				if verbatimTags[n.Tag] {
+					n.Text = mathmlEscaper.Replace(text.String())
+				} else {
+					n.Text = mathmlEscaper.Replace(collapseSpace(text.String()))
+				}
+			}
+			text.Reset()
+			if stack.empty() {
+				return root, nil
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no MathML element found")
+	}
+	return nil, errors.New("unexpected end of input in <" + stack.Peek().Tag + ">")
+}
+
+// collapseSpace removes leading and trailing whitespace from s and replaces each run of whitespace within s by a single
+// space. Only the XML whitespace characters are considered, so that non-breaking spaces are kept.
+func collapseSpace(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}), " ")
+}
+
+// propertiesFromAttribs sets the Properties of n implied by its attributes. It is the inverse of
+// setAttribsFromProperties.
+func (n *MMLNode) propertiesFromAttribs() {
+	if n.Attrib["largeop"] == "true" {
+		n.Properties |= propLargeop
+	}
+	if n.Attrib["movablelimits"] == "true" {
+		n.Properties |= propMovablelimits
+	}
+	if n.Attrib["stretchy"] == "true" {
+		n.Properties |= propStretchy
+	}
+}
+
+// TeX returns the TeX source recorded in an <annotation> of the <semantics> element in the tree rooted at n, as written
+// by TreeBlood and many other tools, and whether one was found.
+func (n *MMLNode) TeX() (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	if n.Tag == "annotation" && texEncodings[n.Attrib["encoding"]] {
+		return html.UnescapeString(n.Text), true
+	}
+	for _, child := range n.Children {
+		if tex, ok := child.TeX(); ok {
+			return tex, true
+		}
+	}
+	return "", false
+}
+
+// PostProcess applies the clean-up that TeX input receives after parsing, such as replacing hyphens with minus signs
+// and combining primes, to every row of the tree rooted at n. It is intended for trees read with ParseMathML.
+func (n *MMLNode) PostProcess() {
+	if n == nil || len(n.Children) == 0 || n.Tag == "annotation" || n.Tag == "annotation-xml" {
+		return
+	}
+	for _, child := range n.Children {
+		child.PostProcess()
+	}
+	n.doPostProcess()
+}
+
+// Speech returns a description of the tree rooted at n in spoken English, as given by Pitziil.Speech.
+func (n *MMLNode) Speech() string {
+	return speak(n)
+}
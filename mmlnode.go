@@ -1,8 +1,11 @@
 package treeblood
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
 )
 
 // An MMLNode is the representation of a MathML tag or tree.
@@ -112,21 +115,116 @@ func (n *MMLNode) AppendNew(opt ...string) *MMLNode {
 	return newnode
 }
 
-func (n *MMLNode) printAST(depth int) {
+// printAST writes a description of the tree rooted at n to w for debugging.
+func (n *MMLNode) printAST(w io.Writer, depth int) {
 	if n == nil {
-		fmt.Println(strings.Repeat("  ", depth), "NIL")
+		fmt.Fprintln(w, strings.Repeat("  ", depth), "NIL")
 		return
 	}
-	fmt.Println(strings.Repeat("  ", depth), n.Tok.Value, n.Tag, n.Text, n)
+	fmt.Fprintln(w, strings.Repeat("  ", depth), n.Tok.Value, n.Tag, n.Text, n)
 	for k, v := range n.Attrib {
-		fmt.Println(strings.Repeat("  ", depth), k, v)
+		fmt.Fprintln(w, strings.Repeat("  ", depth), k, v)
 	}
 	for _, child := range n.Children {
-		child.printAST(depth + 1)
+		child.printAST(w, depth+1)
 	}
 }
 
+// xmlEscaper escapes text for use in XML content or attribute values.
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// mmlWriter is satisfied by both *strings.Builder and *bufio.Writer, so that the same serialization code can build a
+// string or stream to an io.Writer.
+type mmlWriter interface {
+	io.Writer
+	io.StringWriter
+	io.ByteWriter
+	WriteRune(r rune) (int, error)
+}
+
+// countingWriter records the number of bytes passed through to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// pooledWriter is a reusable buffered writer. Pooling these keeps streaming output from allocating a new buffer for
+// every equation.
+type pooledWriter struct {
+	count countingWriter
+	buf   *bufio.Writer
+}
+
+var writerPool = sync.Pool{
+	New: func() any {
+		pw := &pooledWriter{}
+		pw.buf = bufio.NewWriterSize(&pw.count, 4096)
+		return pw
+	},
+}
+
+func getPooledWriter(w io.Writer) *pooledWriter {
+	pw := writerPool.Get().(*pooledWriter)
+	pw.count = countingWriter{w: w}
+	pw.buf.Reset(&pw.count)
+	return pw
+}
+
+func putPooledWriter(pw *pooledWriter) {
+	pw.count.w = nil
+	writerPool.Put(pw)
+}
+
+// sortedKeys appends the keys of m to buf in sorted order. Nodes rarely have more than a handful of attributes, so an
+// insertion sort into a caller-provided buffer is cheaper than allocating and sorting a new slice.
+func sortedKeys(m map[string]string, buf []string) []string {
+	for key := range m {
+		i := len(buf)
+		buf = append(buf, key)
+		for ; i > 0 && buf[i-1] > key; i-- {
+			buf[i] = buf[i-1]
+		}
+		buf[i] = key
+	}
+	return buf
+}
+
+// Write the MathML for n and its children to w. If indent is negative, the output is printed on one line; otherwise
+// each element is printed on its own line, indented to the given depth.
 func (n *MMLNode) Write(w *strings.Builder, indent int) {
+	n.write(w, indent)
+}
+
+// WriteTo streams the MathML for n and its children to w on a single line. It implements io.WriterTo.
+func (n *MMLNode) WriteTo(w io.Writer) (int64, error) {
+	pw := getPooledWriter(w)
+	defer putPooledWriter(pw)
+	n.write(pw.buf, -1)
+	err := pw.buf.Flush()
+	return pw.count.n, err
+}
+
+// prune removes the descendants of n that are not written, such as the nil children left by the parser and the
+// placeholders of \label, so that the tree matches its MathML.
+func (n *MMLNode) prune() {
+	kept := n.Children[:0]
+	for _, child := range n.Children {
+		if child == nil || child.Properties&propNonprint > 0 || child.Tag == "" {
+			continue
+		}
+		child.prune()
+		kept = append(kept, child)
+	}
+	n.Children = kept
+}
+
+func (n *MMLNode) write(w mmlWriter, indent int) {
 	if n == nil {
 		return
 	}
@@ -137,7 +235,7 @@ func (n *MMLNode) Write(w *strings.Builder, indent int) {
 	if len(n.Tag) > 0 {
 		tag = n.Tag
 	} else {
-		logger.Println("WARN: Unknown tag. Ignoring.")
+		// Unknown tag. Ignoring.
 		return
 	}
 	var padding string
@@ -147,29 +245,21 @@ func (n *MMLNode) Write(w *strings.Builder, indent int) {
 	}
 	w.WriteRune('<')
 	w.WriteString(tag)
-	//var keys []string
-	//if len(n.Attrib) > 0 {
-	//	keys = make([]string, 0, len(n.Attrib))
-	//	for key := range n.Attrib {
-	//		keys = append(keys, key)
-	//	}
-	//	sort.Strings(keys)
-	//}
-	//for _, key := range keys {
-	//	val := n.Attrib[key]
-	for key, val := range n.Attrib {
+	// Attributes and style properties are written in sorted order so that the output is reproducible.
+	var keybuf [8]string
+	for _, key := range sortedKeys(n.Attrib, keybuf[:0]) {
 		w.WriteRune(' ')
 		w.WriteString(key)
 		w.WriteString(`="`)
-		w.WriteString(val)
+		w.WriteString(n.Attrib[key])
 		w.WriteRune('"')
 	}
 	if len(n.CSS) > 0 {
 		w.WriteString(` style="`)
-		for key, val := range n.CSS {
+		for _, key := range sortedKeys(n.CSS, keybuf[:0]) {
 			w.WriteString(key)
 			w.WriteRune(':')
-			w.WriteString(val)
+			w.WriteString(n.CSS[key])
 			w.WriteRune(';')
 		}
 		w.WriteRune('"')
@@ -185,7 +275,7 @@ func (n *MMLNode) Write(w *strings.Builder, indent int) {
 				nextIndent++
 			}
 			for _, child := range n.Children {
-				child.Write(w, nextIndent)
+				child.write(w, nextIndent)
 				if child != nil && child.Properties&propNonprint == 0 && indent >= 0 {
 					w.WriteRune('\n')
 				}
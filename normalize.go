@@ -0,0 +1,284 @@
+package treeblood
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// symbolAliases maps alternative spellings of a command to the spelling written by Normalize. Each alias produces the
+// same symbol in symbolTable as its replacement, so that normalizing never changes the output. Some aliases, such as
+// \le, are synonyms in LaTeX too; others, such as \larr and \sube, come from MathJax and KaTeX and are not defined
+// in LaTeX at all, so normalizing them also makes the TeX portable.
+var symbolAliases = map[string]string{
+	"le":           "leq",
+	"ge":           "geq",
+	"ne":           "neq",
+	"gets":         "leftarrow",
+	"larr":         "leftarrow",
+	"rarr":         "rightarrow",
+	"harr":         "leftrightarrow",
+	"lrarr":        "leftrightarrow",
+	"uarr":         "uparrow",
+	"darr":         "downarrow",
+	"Larr":         "Leftarrow",
+	"lArr":         "Leftarrow",
+	"Rarr":         "Rightarrow",
+	"rArr":         "Rightarrow",
+	"Harr":         "Leftrightarrow",
+	"hArr":         "Leftrightarrow",
+	"Lrarr":        "Leftrightarrow",
+	"lrArr":        "Leftrightarrow",
+	"Uarr":         "Uparrow",
+	"uArr":         "Uparrow",
+	"Darr":         "Downarrow",
+	"dArr":         "Downarrow",
+	"land":         "wedge",
+	"lor":          "vee",
+	"lnot":         "neg",
+	"isin":         "in",
+	"owns":         "ni",
+	"exist":        "exists",
+	"infin":        "infty",
+	"plusmn":       "pm",
+	"empty":        "emptyset",
+	"alef":         "aleph",
+	"alefsym":      "aleph",
+	"weierp":       "wp",
+	"sdot":         "cdot",
+	"dag":          "dagger",
+	"ddag":         "ddagger",
+	"sub":          "subset",
+	"sube":         "subseteq",
+	"supe":         "supseteq",
+	"sect":         "S",
+	"clubs":        "clubsuit",
+	"diamonds":     "diamondsuit",
+	"hearts":       "heartsuit",
+	"spades":       "spadesuit",
+	"doublecap":    "Cap",
+	"doublecup":    "Cup",
+	"gggtr":        "ggg",
+	"llless":       "lll",
+	"bigcupplus":   "biguplus",
+	"Box":          "square",
+	"dotproduct":   "cdot",
+	"crossproduct": "times",
+}
+
+// Normalize rewrites tex in a canonical form, so that equivalent TeX is written the same way. The document macros are
+// expanded, comments are removed, runs of whitespace become a single space, every argument of a command such as \frac
+// or \sqrt is enclosed in braces (so that \frac12 becomes \frac{1}{2}), and commands with several spellings, such as
+// \le and \leq, are written with one of them. Each row of an environment is placed on its own line. Macros defined
+// with \newcommand are left as written.
+func (pitz *Pitziil) Normalize(tex string) (string, error) {
+	r := pitz.newRender(tex, false)
+	toks, err := r.lex()
+	if err != nil {
+		return "", err
+	}
+	var n texNormalizer
+	n.tokens(toks)
+	return strings.TrimSpace(n.sb.String()), nil
+}
+
+type texNormalizer struct {
+	sb      strings.Builder
+	command bool // the last thing written was a command name ending in a letter
+}
+
+func (n *texNormalizer) write(s string) {
+	if s == "" {
+		return
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	if n.command && unicode.IsLetter(r) {
+		n.sb.WriteByte(' ')
+	}
+	n.sb.WriteString(s)
+	n.command = false
+}
+
+func (n *texNormalizer) writeCommand(name string) {
+	n.write(`\`)
+	n.sb.WriteString(name)
+	r, _ := utf8.DecodeLastRuneInString(name)
+	n.command = unicode.IsLetter(r)
+}
+
+// space writes a single space, unless the output is empty or already ends in whitespace.
+func (n *texNormalizer) space() {
+	if n.sb.Len() == 0 {
+		return
+	}
+	if r, _ := utf8.DecodeLastRuneInString(n.sb.String()); unicode.IsSpace(r) {
+		return
+	}
+	n.sb.WriteByte(' ')
+	n.command = false
+}
+
+// newline ends the current line, dropping any whitespace at the end of it.
+func (n *texNormalizer) newline() {
+	s := strings.TrimRight(n.sb.String(), " ")
+	n.sb.Reset()
+	n.sb.WriteString(s)
+	n.sb.WriteByte('\n')
+	n.command = false
+}
+
+// skipSpace returns the index of the first token at or after i that is neither whitespace nor a comment.
+func skipSpace(toks []Token, i int) int {
+	for i < len(toks) && toks[i].Kind&(tokWhitespace|tokComment) > 0 {
+		i++
+	}
+	return i
+}
+
+func (n *texNormalizer) tokens(toks []Token) {
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch {
+		case t.Kind&tokComment > 0:
+			continue
+		case t.Kind&tokWhitespace > 0:
+			n.space()
+			continue
+		}
+		n.token(t)
+		switch {
+		case t.Value == `\` && t.Kind&tokEscaped > 0, t.Value == "cr" && t.Kind&tokCommand > 0:
+			if j := skipSpace(toks, i+1); j < len(toks) && toks[j].Value == "[" && toks[j].MatchOffset > 0 {
+				// the row spacing, as in \\[1em]
+				n.group(toks[j+1:j+toks[j].MatchOffset], "[", "]")
+				i = j + toks[j].MatchOffset
+			}
+			n.newline()
+			i = skipSpace(toks, i+1) - 1
+		case t.Kind&tokCommand == 0 || t.Kind&tokFence > 0 || t.Value == "not":
+		default:
+			i = n.arguments(t.Value, toks, i+1) - 1
+		}
+	}
+}
+
+// token writes the TeX for a single token.
+func (n *texNormalizer) token(t Token) {
+	switch {
+	case t.Kind&tokEnv > 0:
+		if t.Kind&tokOpen > 0 {
+			n.writeCommand("begin")
+		} else {
+			n.writeCommand("end")
+		}
+		n.write("{" + t.Value + "}")
+		return
+	case t.Kind&tokLeftRight > 0:
+		switch {
+		case t.Kind&tokOpen > 0:
+			n.writeCommand("left")
+		case t.Kind&tokClose > 0:
+			n.writeCommand("right")
+		default:
+			n.writeCommand("middle")
+		}
+		if t.Value == "" {
+			n.write(".")
+			return
+		}
+	case t.Kind&(tokBigness1|tokBigness2|tokBigness3|tokBigness4) > 0:
+		var big string
+		switch t.Kind & (tokBigness1 | tokBigness2 | tokBigness3 | tokBigness4) {
+		case tokBigness1:
+			big = "big"
+		case tokBigness2:
+			big = "Big"
+		case tokBigness3:
+			big = "bigg"
+		default:
+			big = "Bigg"
+		}
+		switch {
+		case t.Kind&tokOpen > 0:
+			big += "l"
+		case t.Kind&tokClose > 0:
+			big += "r"
+		}
+		n.writeCommand(big)
+	}
+	switch {
+	case t.Kind&tokCommand > 0:
+		name := t.Value
+		if alias, ok := symbolAliases[name]; ok {
+			name = alias
+		}
+		if t.Kind&tokStarSuffix > 0 {
+			name += "*"
+		}
+		n.writeCommand(name)
+	case t.Kind&(tokEscaped|tokBadmacro) > 0:
+		n.writeCommand(t.Value)
+	case t.Kind&tokMacroarg > 0:
+		n.write("#" + t.Value)
+	default:
+		n.write(t.Value)
+	}
+}
+
+// group writes toks enclosed in the given brackets.
+func (n *texNormalizer) group(toks []Token, open, close string) {
+	n.write(open)
+	n.tokens(toks)
+	n.write(close)
+}
+
+// arguments writes the arguments of the command name, which begin at toks[i], enclosing each in braces. The index of
+// the first token after the arguments is returned. Commands whose arguments are not known are left as they are.
+func (n *texNormalizer) arguments(name string, toks []Token, i int) int {
+	var argc int
+	options := false
+	if spec, ok := command_args[name]; ok {
+		// processCommandArgs takes options for every command, so they are kept wherever they are found
+		argc, options = spec.argc, true
+	} else if _, ok := accents[name]; ok {
+		argc = 1
+	} else if _, ok := accents_below[name]; ok {
+		argc = 1
+	} else if _, ok := math_variants[name]; ok {
+		argc = 1
+	} else if _, ok := text_commands[name]; ok {
+		argc = 1
+	}
+	if argc == 0 {
+		return i
+	}
+	if j := skipSpace(toks, i); options && j < len(toks) && toks[j].Value == "[" && toks[j].Kind&tokEscaped == 0 && toks[j].MatchOffset > 0 {
+		n.group(toks[j+1:j+toks[j].MatchOffset], "[", "]")
+		i = j + toks[j].MatchOffset + 1
+	}
+	for range argc {
+		j := skipSpace(toks, i)
+		if j >= len(toks) {
+			return i
+		}
+		t := toks[j]
+		switch {
+		case t.Kind&(tokCurly|tokOpen) == tokCurly|tokOpen && t.MatchOffset > 0:
+			n.group(toks[j+1:j+t.MatchOffset], "{", "}")
+			i = j + t.MatchOffset + 1
+		case t.Kind&tokClose > 0 || t.Kind&(tokFence|tokOpen) == tokFence|tokOpen || t.Kind&tokEnv > 0:
+			// not something that can be enclosed in braces on its own
+			return i
+		case t.Kind&tokNumber > 0 && utf8.RuneCountInString(t.Value) > 1:
+			// TeX takes a single digit as the argument, so \frac12 is \frac{1}{2}
+			_, size := utf8.DecodeRuneInString(t.Value)
+			n.write("{" + t.Value[:size] + "}")
+			toks[j].Value = t.Value[size:]
+			i = j
+		default:
+			n.group(toks[j:j+1], "{", "}")
+			i = j + 1
+		}
+	}
+	return i
+}
@@ -0,0 +1,479 @@
+package treeblood
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const ommlNamespace = "http://schemas.openxmlformats.org/officeDocument/2006/math"
+
+// OMML renders tex as Office Math Markup Language, the format used for equations in Word documents. The result is an
+// <m:oMath> element, wrapped in an <m:oMathPara> if display is true, that may be inserted into the paragraphs of a
+// .docx file. Equation numbers are omitted, since Word numbers equations with fields of its own. As with Speech, macros
+// defined in tex are not added to the document.
+func (pitz *Pitziil) OMML(tex string, display bool) (string, error) {
+	ast, err := pitz.parseStandalone(tex)
+	if err != nil {
+		return "", err
+	}
+	var o ommlWriter
+	if display {
+		o.b.WriteString(`<m:oMathPara xmlns:m="` + ommlNamespace + `"><m:oMath>`)
+	} else {
+		o.b.WriteString(`<m:oMath xmlns:m="` + ommlNamespace + `">`)
+	}
+	o.node(ast)
+	if display {
+		o.b.WriteString(`</m:oMath></m:oMathPara>`)
+	} else {
+		o.b.WriteString(`</m:oMath>`)
+	}
+	return o.b.String(), nil
+}
+
+// An ommlWriter accumulates the OMML representation of a tree of MMLNodes.
+type ommlWriter struct {
+	b strings.Builder
+}
+
+// run writes text as an OMML run. If upright is set, the text is set in a roman font; if plain is set, it is set as
+// ordinary (non-math) text, as for \text.
+func (o *ommlWriter) run(text string, upright, plain bool) {
+	if text == "" {
+		return
+	}
+	o.b.WriteString("<m:r>")
+	switch {
+	case plain:
+		o.b.WriteString("<m:rPr><m:nor/></m:rPr>")
+	case upright:
+		o.b.WriteString(`<m:rPr><m:sty m:val="p"/></m:rPr>`)
+	}
+	if strings.TrimSpace(text) != text {
+		o.b.WriteString(`<m:t xml:space="preserve">`)
+	} else {
+		o.b.WriteString("<m:t>")
+	}
+	o.b.WriteString(xmlEscaper.Replace(text))
+	o.b.WriteString("</m:t></m:r>")
+}
+
+// prop writes an empty property element such as <m:chr m:val="∑"/>.
+func (o *ommlWriter) prop(name, val string) {
+	o.b.WriteString("<m:" + name + ` m:val="` + xmlEscaper.Replace(val) + `"/>`)
+}
+
+// arg writes the nodes as the contents of the OMML element name, e.g. <m:e>...</m:e>.
+func (o *ommlWriter) arg(name string, nodes ...*MMLNode) {
+	o.b.WriteString("<m:" + name + ">")
+	o.row(nodes)
+	o.b.WriteString("</m:" + name + ">")
+}
+
+func (o *ommlWriter) node(n *MMLNode) {
+	if n == nil || n.Properties&propNonprint > 0 {
+		return
+	}
+	switch n.Tag {
+	case "annotation", "annotation-xml", "none", "mprescripts":
+	case "mspace":
+		if w := n.Attrib["width"]; w != "" && !strings.HasPrefix(w, "-") && w != "0" && w != "0em" {
+			o.run(" ", false, false)
+		}
+	case "mi":
+		text := nodeText(n)
+		o.run(text, utf8.RuneCountInString(text) > 1 || n.Attrib["mathvariant"] == "normal", false)
+	case "mn", "mo":
+		o.run(nodeText(n), false, false)
+	case "mtext", "ms":
+		o.run(strings.ReplaceAll(nodeText(n), "\u00a0", " "), false, true)
+	case "merror":
+		o.run(nodeText(n), false, true)
+		o.row(n.Children)
+	case "mfrac":
+		if len(n.Children) != 2 {
+			o.row(n.Children)
+			return
+		}
+		o.b.WriteString("<m:f>")
+		if n.Attrib["linethickness"] == "0" {
+			o.b.WriteString("<m:fPr>")
+			o.prop("type", "noBar")
+			o.b.WriteString("</m:fPr>")
+		}
+		o.arg("num", n.Children[0])
+		o.arg("den", n.Children[1])
+		o.b.WriteString("</m:f>")
+	case "msqrt":
+		o.b.WriteString("<m:rad><m:radPr>")
+		o.prop("degHide", "1")
+		o.b.WriteString("</m:radPr><m:deg/>")
+		o.arg("e", n.Children...)
+		o.b.WriteString("</m:rad>")
+	case "mroot":
+		if len(n.Children) != 2 {
+			o.row(n.Children)
+			return
+		}
+		o.b.WriteString("<m:rad>")
+		o.arg("deg", n.Children[1])
+		o.arg("e", n.Children[0])
+		o.b.WriteString("</m:rad>")
+	case "msub", "msup", "msubsup", "munder", "mover", "munderover":
+		o.scripts(n)
+	case "mmultiscripts":
+		o.multiscripts(n)
+	case "mtable":
+		o.table(n)
+	case "mphantom":
+		o.b.WriteString("<m:phant>")
+		o.arg("e", n.Children...)
+		o.b.WriteString("</m:phant>")
+	case "menclose":
+		o.enclose(n)
+	case "mrow":
+		if !o.fenced(n) {
+			o.row(n.Children)
+		}
+	default:
+		o.row(n.Children)
+	}
+}
+
+// row writes a sequence of sibling nodes. A large operator such as ∑ takes the terms that follow it, up to the next
+// relation or binary operator, as its argument.
+func (o *ommlWriter) row(nodes []*MMLNode) {
+	for i := 0; i < len(nodes); i++ {
+		op, sub, sup, limLoc := ommlNary(nodes[i])
+		if op == nil {
+			o.node(nodes[i])
+			continue
+		}
+		end := i + 1
+		for ; end < len(nodes); end++ {
+			if next := nodes[end]; next != nil && next.Tag == "mo" && textOperators()[nodeText(next)] {
+				break
+			}
+		}
+		o.nary(op, sub, sup, limLoc, nodes[i+1:end])
+		i = end - 1
+	}
+}
+
+// nary writes the large operator op with its limits and the summand or integrand body.
+func (o *ommlWriter) nary(op, sub, sup *MMLNode, limLoc string, body []*MMLNode) {
+	o.b.WriteString("<m:nary><m:naryPr>")
+	o.prop("chr", nodeText(op))
+	o.prop("limLoc", limLoc)
+	if sub == nil {
+		o.prop("subHide", "1")
+	}
+	if sup == nil {
+		o.prop("supHide", "1")
+	}
+	o.b.WriteString("</m:naryPr>")
+	o.arg("sub", sub)
+	o.arg("sup", sup)
+	o.arg("e", body...)
+	o.b.WriteString("</m:nary>")
+}
+
+// ommlNary returns the operator and limits of n if it is a large operator such as ∑ or ∫, possibly with limits, along
+// with the placement of the limits: "undOvr" for limits above and below, or "subSup" for scripts.
+func ommlNary(n *MMLNode) (op, sub, sup *MMLNode, limLoc string) {
+	for n != nil && n.Tag == "mrow" && len(n.Children) == 1 {
+		n = n.Children[0]
+	}
+	if n == nil {
+		return
+	}
+	isLargeop := func(n *MMLNode) bool {
+		return n != nil && n.Tag == "mo" && n.Attrib["largeop"] == "true"
+	}
+	if isLargeop(n) {
+		return n, nil, nil, "subSup"
+	}
+	if len(n.Children) < 2 || !isLargeop(n.Children[0]) {
+		return nil, nil, nil, ""
+	}
+	op = n.Children[0]
+	switch n.Tag {
+	case "msub", "msup", "msubsup":
+		limLoc = "subSup"
+	case "munder", "mover", "munderover":
+		limLoc = "undOvr"
+	default:
+		return nil, nil, nil, ""
+	}
+	switch n.Tag {
+	case "msub", "munder":
+		sub = n.Children[1]
+	case "msup", "mover":
+		sup = n.Children[1]
+	default:
+		if len(n.Children) == 3 {
+			sub, sup = n.Children[1], n.Children[2]
+		}
+	}
+	return op, sub, sup, limLoc
+}
+
+// fenced writes n as an OMML delimiter if it is enclosed in fences, as with \left and \right, and reports whether it
+// did so.
+func (o *ommlWriter) fenced(n *MMLNode) bool {
+	nodes := trimNonprint(n.Children)
+	if len(nodes) < 2 {
+		return false
+	}
+	first, last := nodes[0], nodes[len(nodes)-1]
+	isFence := func(n *MMLNode) bool {
+		return n.Tag == "mo" && n.Attrib["fence"] == "true"
+	}
+	if !isFence(first) {
+		return false
+	}
+	inner := nodes[1:]
+	endChr := ""
+	if isFence(last) {
+		inner = nodes[1 : len(nodes)-1]
+		endChr = nodeText(last)
+	}
+	o.b.WriteString("<m:d><m:dPr>")
+	o.prop("begChr", nodeText(first))
+	o.prop("endChr", endChr)
+	o.b.WriteString("</m:dPr>")
+	o.arg("e", inner...)
+	o.b.WriteString("</m:d>")
+	return true
+}
+
+func (o *ommlWriter) scripts(n *MMLNode) {
+	var sub, sup *MMLNode
+	children := n.Children
+	switch {
+	case (n.Tag == "msub" || n.Tag == "munder") && len(children) == 2:
+		sub = children[1]
+	case (n.Tag == "msup" || n.Tag == "mover") && len(children) == 2:
+		sup = children[1]
+	case len(children) == 3:
+		sub, sup = children[1], children[2]
+	default:
+		o.row(children)
+		return
+	}
+	base := children[0]
+	if op, sub, sup, limLoc := ommlNary(n); op != nil {
+		// a large operator without a summand, e.g. at the end of a row
+		o.nary(op, sub, sup, limLoc, nil)
+		return
+	}
+	switch n.Tag {
+	case "msub":
+		o.b.WriteString("<m:sSub>")
+		o.arg("e", base)
+		o.arg("sub", sub)
+		o.b.WriteString("</m:sSub>")
+	case "msup":
+		o.b.WriteString("<m:sSup>")
+		o.arg("e", base)
+		o.arg("sup", sup)
+		o.b.WriteString("</m:sSup>")
+	case "msubsup":
+		o.b.WriteString("<m:sSubSup>")
+		o.arg("e", base)
+		o.arg("sub", sub)
+		o.arg("sup", sup)
+		o.b.WriteString("</m:sSubSup>")
+	case "munder", "mover":
+		script, top := sub, false
+		if n.Tag == "mover" {
+			script, top = sup, true
+		}
+		if leaf := speechLeaf(script); leaf != nil && leaf.Tag == "mo" && o.accent(base, nodeText(leaf), top) {
+			return
+		}
+		if top {
+			o.b.WriteString("<m:limUpp>")
+			o.arg("e", base)
+			o.arg("lim", sup)
+			o.b.WriteString("</m:limUpp>")
+		} else {
+			o.b.WriteString("<m:limLow>")
+			o.arg("e", base)
+			o.arg("lim", sub)
+			o.b.WriteString("</m:limLow>")
+		}
+	case "munderover":
+		o.b.WriteString("<m:limUpp><m:e><m:limLow>")
+		o.arg("e", base)
+		o.arg("lim", sub)
+		o.b.WriteString("</m:limLow></m:e>")
+		o.arg("lim", sup)
+		o.b.WriteString("</m:limUpp>")
+	}
+}
+
+// accent writes base with the accent or decoration char above it (if top is set) or below it, and reports whether
+// char could be expressed in OMML.
+func (o *ommlWriter) accent(base *MMLNode, char string, top bool) bool {
+	pos := "bot"
+	if top {
+		pos = "top"
+	}
+	switch char {
+	case "‾", "¯", "_", "̲":
+		if char == "¯" && !top {
+			return false
+		}
+		o.b.WriteString("<m:bar><m:barPr>")
+		o.prop("pos", pos)
+		o.b.WriteString("</m:barPr>")
+		o.arg("e", base)
+		o.b.WriteString("</m:bar>")
+		return true
+	case "⏞", "⏟", "⏜", "⏝", "⎴", "⎵":
+		vertJc := "bot"
+		if top {
+			vertJc = "top"
+		}
+		o.b.WriteString("<m:groupChr><m:groupChrPr>")
+		o.prop("chr", char)
+		o.prop("pos", pos)
+		o.prop("vertJc", vertJc)
+		o.b.WriteString("</m:groupChrPr>")
+		o.arg("e", base)
+		o.b.WriteString("</m:groupChr>")
+		return true
+	}
+	if !top {
+		return false
+	}
+	mark, ok := combiningAccents[char]
+	if !ok {
+		r, _ := utf8.DecodeRuneInString(char)
+		if !unicode.Is(unicode.Mn, r) {
+			return false
+		}
+		mark = char
+	}
+	o.b.WriteString("<m:acc><m:accPr>")
+	o.prop("chr", mark)
+	o.b.WriteString("</m:accPr>")
+	o.arg("e", base)
+	o.b.WriteString("</m:acc>")
+	return true
+}
+
+// multiscripts writes an <mmultiscripts> as OMML pre-scripts. OMML allows only one subscript and superscript on
+// either side of the base, so any others are dropped.
+func (o *ommlWriter) multiscripts(n *MMLNode) {
+	if len(n.Children) == 0 {
+		return
+	}
+	var post, pre []*MMLNode
+	inPre := false
+	for _, child := range n.Children[1:] {
+		switch {
+		case child != nil && child.Tag == "mprescripts":
+			inPre = true
+		case inPre:
+			pre = append(pre, child)
+		default:
+			post = append(post, child)
+		}
+	}
+	base := n.Children[0]
+	if len(post) >= 2 && (post[0].Tag != "none" || post[1].Tag != "none") {
+		base = NewMMLNode("msubsup").AppendChild(base, post[0], post[1])
+	}
+	if len(pre) < 2 {
+		o.node(base)
+		return
+	}
+	o.b.WriteString("<m:sPre>")
+	o.arg("sub", pre[0])
+	o.arg("sup", pre[1])
+	o.arg("e", base)
+	o.b.WriteString("</m:sPre>")
+}
+
+// table writes an <mtable> as an OMML matrix if it has several columns, or as an equation array otherwise. The
+// cells of an aligned environment such as align are joined into a single line per row, since their alignment cannot
+// be expressed in OMML. Equation numbers are omitted.
+func (o *ommlWriter) table(n *MMLNode) {
+	var rows [][]*MMLNode
+	cols := 0
+	for _, row := range n.Children {
+		if row == nil || (row.Tag != "mtr" && row.Tag != "mlabeledtr") {
+			continue
+		}
+		cells := row.Children
+		if row.Tag == "mlabeledtr" && len(cells) > 0 {
+			cells = cells[1:]
+		}
+		rows = append(rows, cells)
+		cols = max(cols, len(cells))
+	}
+	aligned := false
+	for _, row := range rows {
+		for _, cell := range row {
+			if cell != nil && cell.Attrib["columnalign"] != "" {
+				aligned = true
+			}
+		}
+	}
+	if len(rows) == 1 && (cols == 1 || aligned) {
+		o.row(rows[0])
+		return
+	}
+	if cols == 1 || aligned {
+		o.b.WriteString("<m:eqArr>")
+		for _, cells := range rows {
+			o.arg("e", cells...)
+		}
+		o.b.WriteString("</m:eqArr>")
+		return
+	}
+	o.b.WriteString("<m:m>")
+	for _, cells := range rows {
+		o.b.WriteString("<m:mr>")
+		for _, cell := range cells {
+			o.arg("e", cell)
+		}
+		for range cols - len(cells) {
+			o.b.WriteString("<m:e/>")
+		}
+		o.b.WriteString("</m:mr>")
+	}
+	o.b.WriteString("</m:m>")
+}
+
+// enclose writes an <menclose> as an OMML border box, with diagonal strikes for \cancel and the like.
+func (o *ommlWriter) enclose(n *MMLNode) {
+	notation := strings.Fields(n.Attrib["notation"])
+	o.b.WriteString("<m:borderBox>")
+	if len(notation) > 0 && !slices.Contains(notation, "box") {
+		o.b.WriteString("<m:borderBoxPr>")
+		o.prop("hideTop", "1")
+		o.prop("hideBot", "1")
+		o.prop("hideLeft", "1")
+		o.prop("hideRight", "1")
+		for _, note := range notation {
+			switch note {
+			case "updiagonalstrike":
+				o.prop("strikeBLTR", "1")
+			case "downdiagonalstrike":
+				o.prop("strikeTLBR", "1")
+			case "horizontalstrike":
+				o.prop("strikeH", "1")
+			case "verticalstrike":
+				o.prop("strikeV", "1")
+			}
+		}
+		o.b.WriteString("</m:borderBoxPr>")
+	}
+	o.arg("e", n.Children...)
+	o.b.WriteString("</m:borderBox>")
+}
@@ -0,0 +1,100 @@
+package treeblood
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// An Equation is a single TeX expression to be rendered by RenderParallel.
+type Equation struct {
+	Tex     string // the string of math to render, without delimiters
+	Display bool   // render in display style, as with DisplayStyle, rather than TextStyle
+}
+
+// RenderParallel renders each of the equations using up to workers goroutines, or runtime.GOMAXPROCS(0) if workers is
+// less than one. The results are the same as those of rendering the equations one after another with DisplayStyle and
+// TextStyle: equations are numbered and references resolved in the order given, and macros defined with \newcommand
+// apply to all equations that follow. The ith result and error belong to the ith equation.
+func (pitz *Pitziil) RenderParallel(eqs []Equation, workers int) ([]RenderResult, []error) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	asts := make([]*MMLNode, len(eqs))
+	contexts := make([]*renderContext, len(eqs))
+	results := make([]RenderResult, len(eqs))
+	errs := make([]error, len(eqs))
+	// run f(i) for start <= i < end on at most workers goroutines
+	each := func(start, end int, f func(i int)) {
+		var wg sync.WaitGroup
+		next := make(chan int)
+		for range min(workers, end-start) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					f(i)
+				}
+			}()
+		}
+		for i := start; i < end; i++ {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+	}
+	parse := func(i int) {
+		asts[i], contexts[i], errs[i] = pitz.renderAST(eqs[i].Tex, eqs[i].Display)
+	}
+	// An equation that defines macros must be parsed before any equation after it, so such equations divide the
+	// document into runs that may be parsed concurrently.
+	start := 0
+	for i, eq := range eqs {
+		if definesMacros(eq.Tex) {
+			each(start, i, parse)
+			parse(i)
+			start = i + 1
+		}
+	}
+	each(start, len(eqs), parse)
+	for i := range eqs {
+		results[i].Diagnostics = append(contexts[i].diagnostics, pitz.resolveLabels(contexts[i].pending)...)
+	}
+	var indent int
+	if pitz.PrintOneLine {
+		indent = -1
+	}
+	each(0, len(eqs), func(i int) {
+		if asts[i] == nil {
+			return
+		}
+		pitz.speakMath(asts[i])
+		var builder strings.Builder
+		builder.WriteRune('\n')
+		if werr := pitz.writeMath(&builder, asts[i], indent); werr != nil {
+			results[i].Diagnostics = append(results[i].Diagnostics, Diagnostic{Severity: SeverityError, Code: DiagInternal, Message: werr.Error()})
+			errs[i] = werr
+		}
+		builder.WriteRune('\n')
+		results[i].MathML = builder.String()
+	})
+	return results, errs
+}
+
+// definesMacros reports whether tex contains a command that adds a macro to the document.
+func definesMacros(tex string) bool {
+	tokens, err := tokenize([]rune(tex))
+	if err != nil {
+		return false
+	}
+	for _, t := range tokens {
+		if t.Kind&tokCommand == 0 {
+			continue
+		}
+		switch t.Value {
+		case "newcommand", "renewcommand", "def", "DeclareMathOperator":
+			return true
+		}
+	}
+	return false
+}
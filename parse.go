@@ -3,7 +3,6 @@ package treeblood
 import (
 	"errors"
 	"fmt"
-	"log"
 )
 
 type NodeClass uint64
@@ -63,7 +62,6 @@ const (
 )
 
 var (
-	logger            *log.Logger
 	self_closing_tags = map[string]bool{
 		"malignmark":  true,
 		"maligngroup": true,
@@ -79,11 +77,25 @@ func (pitz *Pitziil) OriginalString(b *TokenBuffer) string {
 	}
 	start := b.Expr[0].start
 	end := b.Expr[len(b.Expr)-1].end
-	return string(pitz.currentExpr[start:end])
+	if pitz.rc == nil || end > len(pitz.rc.expr) {
+		return StringifyTokens(b.Expr)
+	}
+	return string(pitz.rc.expr[start:end])
 }
 
 // Parse a list of TeX tokens into a MathML node tree
 func (pitz *Pitziil) ParseTex(b *TokenBuffer, context parseContext, parent ...*MMLNode) *MMLNode {
+	if pitz.rc == nil {
+		// called directly on a document rather than through DisplayStyle etc.
+		r := pitz.newRender("", context&ctxDisplay > 0)
+		node := r.ParseTex(b, context, parent...)
+		pitz.commitMacros(r.rc.needMacroExpansion)
+		pitz.resolveLabels(r.rc.pending)
+		return node
+	}
+	if context&ctxText > 0 {
+		return pitz.parseText(b, context, parent...)
+	}
 	var node *MMLNode
 	siblings := make([]*MMLNode, 0)
 	var optionString string
@@ -94,7 +106,11 @@ func (pitz *Pitziil) ParseTex(b *TokenBuffer, context parseContext, parent ...*M
 			optionString = StringifyTokens(temp.Expr)
 		} else {
 			b.Unget()
-			logger.Println("WARN: environment expects an argument")
+			var at Token
+			if len(b.Expr) > 0 {
+				at = b.Expr[0]
+			}
+			pitz.diagnose(SeverityWarning, DiagArgument, at, "environment expects an argument")
 		}
 		context ^= ctxEnvHasArg
 	}
@@ -193,11 +209,9 @@ func (pitz *Pitziil) ParseTex(b *TokenBuffer, context parseContext, parent ...*M
 			// tell the next sibling to be a super- or subscript
 			continue
 		case tok.Kind&tokBadmacro > 0:
-			child = NewMMLNode("merror", tok.Value)
-			child.SetAttr("title", "cyclic dependency in macro definition")
+			child = pitz.merror(DiagMacro, tok.Value, "cyclic dependency in macro definition")
 		case tok.Kind&tokMacroarg > 0:
-			child = NewMMLNode("merror", "?"+tok.Value)
-			child.SetAttr("title", "Unexpanded macro argument")
+			child = pitz.merror(DiagMacro, "?"+tok.Value, "Unexpanded macro argument")
 		case tok.Kind&tokEscaped > 0:
 			child = NewMMLNode("mo", tok.Value)
 			if tok.Kind&(tokOpen|tokClose|tokFence) > 0 {
@@ -206,7 +220,7 @@ func (pitz *Pitziil) ParseTex(b *TokenBuffer, context parseContext, parent ...*M
 		case tok.Kind&(tokOpen|tokEnv) == tokOpen|tokEnv:
 			ctx := setEnvironmentContext(tok, context) &^ ctxRoot
 			env, _ := b.GetNextN(tok.MatchOffset)
-			child = processEnv(pitz.ParseTex(env, ctx), tok.Value, ctx)
+			child = pitz.processEnv(pitz.ParseTex(env, ctx), tok, ctx)
 		case tok.Kind&(tokOpen|tokCurly) == tokOpen|tokCurly:
 			child = pitz.ParseTex(b, context&^ctxRoot)
 		case tok.Kind&tokOpen > 0:
@@ -235,6 +249,9 @@ func (pitz *Pitziil) ParseTex(b *TokenBuffer, context parseContext, parent ...*M
 				continue
 			}
 		case tok.Kind&tokClose > 0:
+			if tok.MatchOffset == 0 && tok.Kind&(tokFence|tokCommand) == 0 {
+				pitz.diagnose(SeverityNote, DiagDelimiter, tok, "potentially unmatched closing delimiter '%s'", tok.Value)
+			}
 			child = NewMMLNode("mo")
 			if tok.Kind&tokCommand > 0 {
 				child = pitz.ProcessCommand(context&^ctxRoot, tok, b)
@@ -263,15 +280,7 @@ func (pitz *Pitziil) ParseTex(b *TokenBuffer, context parseContext, parent ...*M
 		case tok.Kind&tokCommand > 0:
 			child = pitz.ProcessCommand(context&^ctxRoot, tok, b)
 		case tok.Kind&tokWhitespace > 0:
-			if context&ctxText > 0 {
-				child = NewMMLNode("mspace", " ")
-				child.Tok.Value = " "
-				child.SetAttr("width", "1em")
-				siblings = append(siblings, child)
-				continue
-			} else {
-				continue
-			}
+			continue
 		default:
 			child = NewMMLNode("mo", tok.Value)
 		}
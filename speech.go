@@ -0,0 +1,680 @@
+package treeblood
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Spoken names of operators and relations, keyed by the text of an <mo>.
+var speechOperators = map[string]string{
+	"=":      "equals",
+	"≠":      "is not equal to",
+	"<":      "is less than",
+	">":      "is greater than",
+	"≤":      "is less than or equal to",
+	"≥":      "is greater than or equal to",
+	"≪":      "is much less than",
+	"≫":      "is much greater than",
+	"≈":      "is approximately equal to",
+	"≡":      "is equivalent to",
+	"∼":      "is similar to",
+	"≃":      "is asymptotically equal to",
+	"≅":      "is congruent to",
+	"∝":      "is proportional to",
+	"∈":      "is an element of",
+	"∉":      "is not an element of",
+	"∋":      "contains",
+	"⊂":      "is a subset of",
+	"⊆":      "is a subset of or equal to",
+	"⊃":      "is a superset of",
+	"⊇":      "is a superset of or equal to",
+	"∣":      "divides",
+	"∥":      "is parallel to",
+	"⊥":      "is perpendicular to",
+	"→":      "right arrow",
+	"⟶":      "right arrow",
+	"←":      "left arrow",
+	"⟵":      "left arrow",
+	"↔":      "left right arrow",
+	"⇒":      "implies",
+	"⟹":      "implies",
+	"⇐":      "is implied by",
+	"⟸":      "is implied by",
+	"⇔":      "if and only if",
+	"⟺":      "if and only if",
+	"↦":      "maps to",
+	"+":      "plus",
+	"−":      "minus",
+	"-":      "minus",
+	"±":      "plus or minus",
+	"∓":      "minus or plus",
+	"×":      "times",
+	"⋅":      "times",
+	"·":      "times",
+	"∗":      "times",
+	"÷":      "divided by",
+	"/":      "divided by",
+	"∘":      "composed with",
+	"⊗":      "tensor",
+	"⊕":      "direct sum",
+	"∪":      "union",
+	"∩":      "intersection",
+	"∖":      "set minus",
+	"∧":      "and",
+	"∨":      "or",
+	"¬":      "not",
+	"∀":      "for all",
+	"∃":      "there exists",
+	"∄":      "there does not exist",
+	"!":      "factorial",
+	"′":      "prime",
+	"″":      "double prime",
+	"‴":      "triple prime",
+	"%":      "percent",
+	"°":      "degrees",
+	":":      "colon",
+	"|":      "vertical bar",
+	"‖":      "double vertical bar",
+	"…":      "dot dot dot",
+	"⋯":      "dot dot dot",
+	"⋮":      "vertical dots",
+	"⋱":      "diagonal dots",
+	"(":      "open paren",
+	")":      "close paren",
+	"[":      "open bracket",
+	"]":      "close bracket",
+	"{":      "open brace",
+	"}":      "close brace",
+	"⟨":      "open angle bracket",
+	"⟩":      "close angle bracket",
+	"⌊":      "open floor",
+	"⌋":      "close floor",
+	"⌈":      "open ceiling",
+	"⌉":      "close ceiling",
+	"∑":      "the sum",
+	"∏":      "the product",
+	"∐":      "the coproduct",
+	"∫":      "the integral",
+	"∬":      "the double integral",
+	"∭":      "the triple integral",
+	"∮":      "the contour integral",
+	"⋃":      "the union",
+	"⋂":      "the intersection",
+	"\u2061": "", // function application
+	"\u2062": "", // invisible times
+	"\u2063": "", // invisible separator
+	"\u2064": "", // invisible plus
+}
+
+// Spoken names of identifiers, keyed by the text of an <mi>. Function names are read in full, as in ClearSpeak.
+var speechIdentifiers = map[string]string{
+	"∞":      "infinity",
+	"∂":      "partial",
+	"∇":      "del",
+	"ℏ":      "h bar",
+	"ℓ":      "ell",
+	"∅":      "the empty set",
+	"ℝ":      "the real numbers",
+	"ℕ":      "the natural numbers",
+	"ℤ":      "the integers",
+	"ℚ":      "the rational numbers",
+	"ℂ":      "the complex numbers",
+	"sin":    "sine",
+	"cos":    "cosine",
+	"tan":    "tangent",
+	"sec":    "secant",
+	"csc":    "cosecant",
+	"cot":    "cotangent",
+	"sinh":   "hyperbolic sine",
+	"cosh":   "hyperbolic cosine",
+	"tanh":   "hyperbolic tangent",
+	"arcsin": "arc sine",
+	"arccos": "arc cosine",
+	"arctan": "arc tangent",
+	"ln":     "natural log",
+	"exp":    "exponential",
+	"det":    "determinant",
+	"lim":    "the limit",
+	"max":    "the maximum",
+	"min":    "the minimum",
+	"sup":    "the supremum",
+	"inf":    "the infimum",
+	"gcd":    "the greatest common divisor",
+	"lcm":    "the least common multiple",
+}
+
+// Spoken names of accents, keyed by the text of the <mo> in an accent <mover>. Accents are spoken after their base,
+// except for vectors.
+var speechAccents = map[string]string{
+	"^":      "hat",
+	"ˆ":      "hat",
+	"‾":      "bar",
+	"¯":      "bar",
+	"~":      "tilde",
+	"˜":      "tilde",
+	"˙":      "dot",
+	"¨":      "double dot",
+	"ˇ":      "check",
+	"˘":      "breve",
+	"´":      "acute",
+	"`":      "grave",
+	"→":      "vector",
+	"\u20d7": "vector",
+}
+
+// speechSymbolNames maps the characters of the symbolTable to the shortest command that produces them. It is used to
+// name symbols that have no entry in speechOperators or speechIdentifiers.
+var speechSymbolNames = sync.OnceValue(func() map[string]string {
+	names := make(map[string]string, len(symbolTable))
+	for name, sym := range symbolTable {
+		if sym.char == "" {
+			continue
+		}
+		if prev, ok := names[sym.char]; ok && (len(prev) < len(name) || len(prev) == len(name) && prev < name) {
+			continue
+		}
+		names[sym.char] = name
+	}
+	return names
+})
+
+// Speech returns a description of tex in spoken English, in the style of ClearSpeak. For example,
+// `\frac{-b \pm \sqrt{b^2-4ac}}{2a}` is read as "the fraction with numerator negative b plus or minus the square root
+// of b squared minus 4 a c, end root, and denominator 2 a, end fraction". Macros defined in tex are not added to the
+// document, and equations are not numbered.
+func (pitz *Pitziil) Speech(tex string) (string, error) {
+	ast, err := pitz.parseStandalone(tex)
+	if err != nil {
+		return "", err
+	}
+	return speak(ast), nil
+}
+
+// speakMath sets the alttext and aria-label attributes of the <math> element ast to a spoken description of its
+// contents if SpeechLabels is set. It must be called after the labels of ast have been resolved.
+func (pitz *Pitziil) speakMath(ast *MMLNode) {
+	if !pitz.SpeechLabels || ast == nil {
+		return
+	}
+	speech := xmlEscaper.Replace(speak(ast))
+	ast.SetAttr("alttext", speech)
+	ast.SetAttr("aria-label", speech)
+}
+
+// speak returns the spoken description of the tree rooted at n. A pause at the very end, such as the one after a
+// subscript, is dropped.
+func speak(n *MMLNode) string {
+	var s speaker
+	s.node(n)
+	if last := len(s.words) - 1; last >= 0 {
+		s.words[last] = strings.TrimRight(s.words[last], ",;:")
+	}
+	return strings.Join(s.words, " ")
+}
+
+// A speaker accumulates the words describing a tree of MMLNodes.
+type speaker struct {
+	words    []string
+	approach bool // read arrows as "approaches", as in the subscript of a limit
+}
+
+func (s *speaker) say(words ...string) {
+	for _, w := range words {
+		s.words = append(s.words, strings.Fields(w)...)
+	}
+}
+
+// pause attaches punctuation to the last word spoken.
+func (s *speaker) pause(p string) {
+	if len(s.words) == 0 {
+		return
+	}
+	if last := s.words[len(s.words)-1]; !strings.HasSuffix(last, ",") && !strings.HasSuffix(last, ";") {
+		s.words[len(s.words)-1] += p
+	}
+}
+
+func nodeText(n *MMLNode) string {
+	return html.UnescapeString(n.Text)
+}
+
+// speechLeaf returns the single token element at the bottom of a chain of single-child rows, or nil.
+func speechLeaf(n *MMLNode) *MMLNode {
+	for n != nil {
+		switch n.Tag {
+		case "mi", "mn", "mo", "mtext":
+			return n
+		case "mrow", "mstyle":
+			if len(n.Children) != 1 {
+				return nil
+			}
+			n = n.Children[0]
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// simpleSpeech reports whether n is short enough to be read without an ending, as in "x over y" rather than "the
+// fraction with numerator x and denominator y".
+func simpleSpeech(n *MMLNode) bool {
+	leaf := speechLeaf(n)
+	return leaf != nil && leaf.Tag != "mo"
+}
+
+func (s *speaker) node(n *MMLNode) {
+	if n == nil || n.Properties&propNonprint > 0 {
+		return
+	}
+	switch n.Tag {
+	case "annotation", "annotation-xml", "mspace", "mphantom", "none", "mprescripts":
+	case "mi":
+		s.identifier(nodeText(n))
+	case "mn", "ms":
+		s.say(nodeText(n))
+	case "mtext":
+		s.say(nodeText(n))
+	case "mo":
+		s.operator(nodeText(n))
+	case "merror":
+		s.say("error")
+		s.children(n.Children)
+		if len(n.Children) == 0 {
+			s.say(nodeText(n))
+		}
+	case "mfrac":
+		s.fraction(n)
+	case "msqrt":
+		s.root(n, NewMMLNode("mn", "2"), n.Children)
+	case "mroot":
+		if len(n.Children) == 2 {
+			s.root(n, n.Children[1], n.Children[:1])
+		}
+	case "msub", "msup", "msubsup", "munder", "mover", "munderover":
+		s.script(n)
+	case "mtable":
+		s.table(n, "", "")
+	default:
+		s.children(n.Children)
+	}
+}
+
+func (s *speaker) identifier(text string) {
+	if name, ok := speechIdentifiers[text]; ok {
+		s.say(name)
+		return
+	}
+	if name, ok := speechOperators[text]; ok {
+		// e.g. the vertical bars of |x|, which are identifiers unless given with \left and \right
+		s.say(name)
+		return
+	}
+	if name, ok := symbolName(text); ok {
+		s.say(name)
+		return
+	}
+	s.say(text)
+}
+
+// symbolName returns the name of the command that produces the single non-ASCII character text. ASCII characters
+// are not looked up, since the d of \dv, for instance, would be read as \dd.
+func symbolName(text string) (string, bool) {
+	if r, size := utf8.DecodeRuneInString(text); size != len(text) || r < utf8.RuneSelf {
+		return "", false
+	}
+	name, ok := speechSymbolNames()[text]
+	return name, ok
+}
+
+func (s *speaker) operator(text string) {
+	if s.approach {
+		switch text {
+		case "→", "⟶":
+			s.say("approaches")
+			return
+		}
+	}
+	switch text {
+	case ",", ";":
+		s.pause(text)
+		return
+	}
+	if name, ok := speechOperators[text]; ok {
+		s.say(name)
+		return
+	}
+	if name, ok := symbolName(text); ok {
+		s.say(name)
+		return
+	}
+	s.say(text)
+}
+
+// children reads a sequence of sibling nodes, as in an <mrow>.
+func (s *speaker) children(nodes []*MMLNode) {
+	nodes = trimNonprint(nodes)
+	if len(nodes) >= 2 {
+		first, last := nodes[0], nodes[len(nodes)-1]
+		if first.Tag == "mo" && last.Tag == "mo" {
+			open, close := nodeText(first), nodeText(last)
+			inner := nodes[1 : len(nodes)-1]
+			switch {
+			case len(inner) == 1 && inner[0].Tag == "mfrac" && inner[0].Attrib["linethickness"] == "0" && open == "(":
+				if len(inner[0].Children) == 2 {
+					s.node(inner[0].Children[0])
+					s.say("choose")
+					s.node(inner[0].Children[1])
+					return
+				}
+			case len(inner) == 1 && inner[0].Tag == "mtable":
+				s.table(inner[0], open, close)
+				return
+			case open == "|" && close == "|" && len(inner) > 0:
+				s.say("the absolute value of")
+				s.children(inner)
+				s.pause(",")
+				s.say("end absolute value")
+				return
+			case open == "‖" && close == "‖" && len(inner) > 0:
+				s.say("the norm of")
+				s.children(inner)
+				s.pause(",")
+				s.say("end norm")
+				return
+			}
+		}
+		if first.Tag == "mo" && len(nodes) == 2 && nodes[1].Tag == "mtable" && nodeText(first) == "{" {
+			s.table(nodes[1], "{", "")
+			return
+		}
+	}
+	afterOperator := true // at the start of a row or after an operator, + and - are signs rather than operations
+	for _, child := range nodes {
+		if child.Tag != "mo" {
+			s.node(child)
+			afterOperator = false
+			continue
+		}
+		text := nodeText(child)
+		if afterOperator {
+			switch text {
+			case "−", "-":
+				s.say("negative")
+				continue
+			case "+":
+				s.say("positive")
+				continue
+			}
+		}
+		s.node(child)
+		// a closing fence or factorial ends a term, after which a minus sign is a subtraction
+		afterOperator = child.Attrib["form"] != "postfix" && !speechPostfix[text]
+	}
+}
+
+// operators that end a term, after which a minus sign is a subtraction rather than a negation.
+var speechPostfix = map[string]bool{
+	")": true, "]": true, "}": true, "⟩": true, "|": true, "‖": true, "!": true, "′": true, "″": true, "‴": true,
+	"⌋": true, "⌉": true, "%": true, "°": true,
+}
+
+func trimNonprint(nodes []*MMLNode) []*MMLNode {
+	out := make([]*MMLNode, 0, len(nodes))
+	for _, n := range nodes {
+		if n == nil || n.Properties&propNonprint > 0 {
+			continue
+		}
+		switch n.Tag {
+		case "", "mspace", "annotation", "annotation-xml":
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+func (s *speaker) fraction(n *MMLNode) {
+	if len(n.Children) != 2 {
+		s.children(n.Children)
+		return
+	}
+	num, den := n.Children[0], n.Children[1]
+	if n.Attrib["linethickness"] == "0" {
+		s.node(num)
+		s.say("over")
+		s.node(den)
+		return
+	}
+	if simpleSpeech(num) && simpleSpeech(den) {
+		s.node(num)
+		s.say("over")
+		s.node(den)
+		return
+	}
+	s.say("the fraction with numerator")
+	s.node(num)
+	s.pause(",")
+	s.say("and denominator")
+	s.node(den)
+	s.pause(",")
+	s.say("end fraction")
+}
+
+func (s *speaker) root(n *MMLNode, index *MMLNode, radicand []*MMLNode) {
+	switch leaf := speechLeaf(index); {
+	case leaf != nil && leaf.Text == "2":
+		s.say("the square root of")
+	case leaf != nil && leaf.Text == "3":
+		s.say("the cube root of")
+	case leaf != nil:
+		s.say("the", ordinal(nodeText(leaf)), "root of")
+	default:
+		s.say("the root with index")
+		s.node(index)
+		s.pause(",")
+		s.say("of")
+	}
+	s.children(radicand)
+	if len(radicand) != 1 || !simpleSpeech(radicand[0]) {
+		s.pause(",")
+		s.say("end root")
+	}
+}
+
+// ordinal returns the ordinal form of the number or variable text, e.g. "4th" or "n-th".
+func ordinal(text string) string {
+	if i, err := strconv.Atoi(text); err == nil {
+		switch {
+		case i%100 >= 11 && i%100 <= 13:
+			return text + "th"
+		case i%10 == 1:
+			return text + "st"
+		case i%10 == 2:
+			return text + "nd"
+		case i%10 == 3:
+			return text + "rd"
+		}
+		return text + "th"
+	}
+	return text + "-th"
+}
+
+func (s *speaker) script(n *MMLNode) {
+	var base, sub, sup *MMLNode
+	children := n.Children
+	if len(children) == 0 {
+		return
+	}
+	base = children[0]
+	switch {
+	case (n.Tag == "msub" || n.Tag == "munder") && len(children) == 2:
+		sub = children[1]
+	case (n.Tag == "msup" || n.Tag == "mover") && len(children) == 2:
+		sup = children[1]
+	case len(children) == 3:
+		sub, sup = children[1], children[2]
+	default:
+		s.children(children)
+		return
+	}
+	baseLeaf := speechLeaf(base)
+	if baseLeaf != nil && baseLeaf.Tag == "mo" && (baseLeaf.Properties&propLargeop > 0 || baseLeaf.Attrib["largeop"] == "true") {
+		// sums, integrals, and the like
+		s.node(base)
+		if sub != nil {
+			if sup == nil {
+				s.say("over")
+			} else {
+				s.say("from")
+			}
+			s.node(sub)
+		}
+		if sup != nil {
+			s.say("to")
+			s.node(sup)
+		}
+		s.say("of")
+		return
+	}
+	if baseLeaf != nil && baseLeaf.Tag == "mi" && n.Tag == "munder" && sub != nil {
+		switch nodeText(baseLeaf) {
+		case "lim", "limsup", "liminf", "lim sup", "lim inf":
+			s.node(base)
+			s.say("as")
+			approach := s.approach
+			s.approach = true
+			s.node(sub)
+			s.approach = approach
+			s.say("of")
+			return
+		case "max", "min", "sup", "inf", "arg max", "arg min":
+			s.node(base)
+			s.say("over")
+			s.node(sub)
+			s.say("of")
+			return
+		}
+	}
+	if n.Tag == "mover" && sup != nil && n.Attrib["accent"] == "true" {
+		if leaf := speechLeaf(sup); leaf != nil {
+			if name, ok := speechAccents[nodeText(leaf)]; ok {
+				if name == "vector" {
+					s.say("vector")
+					s.node(base)
+				} else {
+					s.node(base)
+					s.say(name)
+				}
+				return
+			}
+		}
+	}
+	s.node(base)
+	if sub != nil {
+		if n.Tag == "munder" || n.Tag == "munderover" {
+			s.say("with")
+			s.node(sub)
+			s.say("below")
+		} else {
+			s.say("sub")
+			s.node(sub)
+			if !simpleSpeech(sub) {
+				s.pause(",")
+			}
+		}
+	}
+	if sup == nil {
+		return
+	}
+	if n.Tag == "mover" || n.Tag == "munderover" {
+		s.say("with")
+		s.node(sup)
+		s.say("above")
+		return
+	}
+	if leaf := speechLeaf(sup); leaf != nil {
+		switch text := nodeText(leaf); text {
+		case "2":
+			s.say("squared")
+			return
+		case "3":
+			s.say("cubed")
+			return
+		case "′", "″", "‴", "∘", "°":
+			s.operator(text)
+			return
+		}
+	}
+	s.say("to the power of")
+	s.node(sup)
+	if !simpleSpeech(sup) {
+		s.pause(",")
+		s.say("end exponent")
+	}
+}
+
+// table reads the rows of an <mtable>. If the table is enclosed by the fences open and close, it is read as a
+// matrix, determinant, or set of cases; otherwise, each row is read as a line of a multiline equation. The equation
+// numbers of labeled rows are not read.
+func (s *speaker) table(n *MMLNode, open, close string) {
+	var rows [][]*MMLNode
+	for _, row := range n.Children {
+		if row == nil || (row.Tag != "mtr" && row.Tag != "mlabeledtr") {
+			continue
+		}
+		cells := row.Children
+		if row.Tag == "mlabeledtr" && len(cells) > 0 {
+			cells = cells[1:]
+		}
+		rows = append(rows, cells)
+	}
+	cols := 0
+	for _, cells := range rows {
+		cols = max(cols, len(cells))
+	}
+	var rowName, cellSep string
+	switch {
+	case open == "{" && close == "":
+		s.say(strconv.Itoa(len(rows)), "cases")
+		s.pause(",")
+		rowName, cellSep = "case", ","
+	case open == "|" && close == "|":
+		s.say("the", strconv.Itoa(len(rows)), "by", strconv.Itoa(cols), "determinant")
+		s.pause(",")
+		rowName, cellSep = "row", ","
+	case open != "" || close != "":
+		s.say("the", strconv.Itoa(len(rows)), "by", strconv.Itoa(cols), "matrix")
+		s.pause(",")
+		rowName, cellSep = "row", ","
+	case len(rows) == 1:
+	default:
+		rowName = "line"
+	}
+	for i, cells := range rows {
+		if rowName != "" {
+			s.say(rowName, strconv.Itoa(i+1))
+			s.pause(":")
+		}
+		for j, cell := range cells {
+			if j > 0 && cellSep != "" {
+				s.pause(cellSep)
+			}
+			s.node(cell)
+		}
+		if i < len(rows)-1 {
+			s.pause(";")
+		}
+	}
+	switch {
+	case rowName == "row" && open == "|":
+		s.pause(",")
+		s.say("end determinant")
+	case rowName == "row":
+		s.pause(",")
+		s.say("end matrix")
+	}
+}
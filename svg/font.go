@@ -0,0 +1,605 @@
+package svg
+
+import (
+	"bytes"
+	"compress/zlib"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Latin Modern Math, released under the GUST Font License by the TeX users groups. It is the same font as the wasm
+// demo's Treeblood-LatinModern.woff2, stored as WOFF 1.0 since its tables are compressed with zlib, which the standard
+// library can read.
+//
+//go:embed LatinModernMath.woff
+var latinModernMath []byte
+
+var (
+	loadOnce   sync.Once
+	loadedFont *font
+	loadErr    error
+)
+
+// defaultFont returns the bundled font, decoding it on first use.
+func defaultFont() (*font, error) {
+	loadOnce.Do(func() {
+		loadedFont, loadErr = parseWOFF(latinModernMath)
+	})
+	return loadedFont, loadErr
+}
+
+var errFont = errors.New("svg: malformed font")
+
+// The indices of the MathConstants of an OpenType MATH table, in the order in which they are stored.
+const (
+	scriptPercentScaleDown = iota
+	scriptScriptPercentScaleDown
+	delimitedSubFormulaMinHeight
+	displayOperatorMinHeight
+	mathLeading
+	axisHeight
+	accentBaseHeight
+	flattenedAccentBaseHeight
+	subscriptShiftDown
+	subscriptTopMax
+	subscriptBaselineDropMin
+	superscriptShiftUp
+	superscriptShiftUpCramped
+	superscriptBottomMin
+	superscriptBaselineDropMax
+	subSuperscriptGapMin
+	superscriptBottomMaxWithSubscript
+	spaceAfterScript
+	upperLimitGapMin
+	upperLimitBaselineRiseMin
+	lowerLimitGapMin
+	lowerLimitBaselineDropMin
+	stackTopShiftUp
+	stackTopDisplayStyleShiftUp
+	stackBottomShiftDown
+	stackBottomDisplayStyleShiftDown
+	stackGapMin
+	stackDisplayStyleGapMin
+	stretchStackTopShiftUp
+	stretchStackBottomShiftDown
+	stretchStackGapAboveMin
+	stretchStackGapBelowMin
+	fractionNumeratorShiftUp
+	fractionNumeratorDisplayStyleShiftUp
+	fractionDenominatorShiftDown
+	fractionDenominatorDisplayStyleShiftDown
+	fractionNumeratorGapMin
+	fractionNumDisplayStyleGapMin
+	fractionRuleThickness
+	fractionDenominatorGapMin
+	fractionDenomDisplayStyleGapMin
+	skewedFractionHorizontalGap
+	skewedFractionVerticalGap
+	overbarVerticalGap
+	overbarRuleThickness
+	overbarExtraAscender
+	underbarVerticalGap
+	underbarRuleThickness
+	underbarExtraDescender
+	radicalVerticalGap
+	radicalDisplayStyleVerticalGap
+	radicalRuleThickness
+	radicalExtraAscender
+	radicalKernBeforeDegree
+	radicalKernAfterDegree
+	radicalDegreeBottomRaisePercent
+	numMathConstants
+)
+
+// A point of a glyph outline in font units.
+type point struct {
+	x, y    float64
+	onCurve bool
+}
+
+// A glyphPart is one of the pieces from which a glyph assembly is built.
+type glyphPart struct {
+	glyph          uint16
+	startConnector float64
+	endConnector   float64
+	fullAdvance    float64
+	extender       bool
+}
+
+// A construction lists the ways in which a glyph can be made larger in one direction: a sequence of predefined
+// variants of increasing size, and an assembly of parts for sizes beyond the largest variant.
+type construction struct {
+	variants []uint16
+	sizes    []float64 // the size of each variant in the direction of growth
+	parts    []glyphPart
+}
+
+type glyphMetrics struct {
+	advance                float64
+	xMin, yMin, xMax, yMax float64
+}
+
+// A font holds the tables of an OpenType math font needed for layout and drawing.
+type font struct {
+	unitsPerEm float64
+	cmap       map[rune]uint16
+	metrics    []glyphMetrics
+	glyf       []byte
+	loca       []uint32
+	constants  [numMathConstants]float64
+	italics    map[uint16]float64
+	topAccent  map[uint16]float64
+	vertical   map[uint16]*construction
+	horizontal map[uint16]*construction
+	minOverlap float64
+	paths      sync.Map // the SVG path data of each glyph, computed on demand
+}
+
+// parseWOFF decodes a font in the WOFF 1.0 format.
+func parseWOFF(data []byte) (*font, error) {
+	if len(data) < 44 || string(data[:4]) != "wOFF" {
+		return nil, errFont
+	}
+	numTables := int(binary.BigEndian.Uint16(data[12:]))
+	if len(data) < 44+20*numTables {
+		return nil, errFont
+	}
+	tables := make(map[string][]byte, numTables)
+	for i := range numTables {
+		rec := data[44+20*i:]
+		tag := string(rec[:4])
+		offset := int(binary.BigEndian.Uint32(rec[4:]))
+		compLength := int(binary.BigEndian.Uint32(rec[8:]))
+		origLength := int(binary.BigEndian.Uint32(rec[12:]))
+		if offset+compLength > len(data) {
+			return nil, errFont
+		}
+		table := data[offset : offset+compLength]
+		if compLength < origLength {
+			z, err := zlib.NewReader(bytes.NewReader(table))
+			if err != nil {
+				return nil, err
+			}
+			table = make([]byte, origLength)
+			if _, err := io.ReadFull(z, table); err != nil {
+				return nil, err
+			}
+		}
+		tables[tag] = table
+	}
+	return parseTables(tables)
+}
+
+// A reader for the big-endian data of an OpenType table. Reads past the end of the table give zero, and are
+// reported by the failed field, so that the parsing code need not check every offset.
+type tableReader struct {
+	data   []byte
+	failed bool
+}
+
+func (t *tableReader) u16(off int) int {
+	if off < 0 || off+2 > len(t.data) {
+		t.failed = true
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(t.data[off:]))
+}
+
+func (t *tableReader) i16(off int) float64 {
+	return float64(int16(t.u16(off)))
+}
+
+func (t *tableReader) u32(off int) int {
+	if off < 0 || off+4 > len(t.data) {
+		t.failed = true
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(t.data[off:]))
+}
+
+func parseTables(tables map[string][]byte) (*font, error) {
+	f := &font{
+		cmap:       make(map[rune]uint16),
+		italics:    make(map[uint16]float64),
+		topAccent:  make(map[uint16]float64),
+		vertical:   make(map[uint16]*construction),
+		horizontal: make(map[uint16]*construction),
+		glyf:       tables["glyf"],
+	}
+	for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "cmap", "loca", "glyf", "MATH"} {
+		if tables[tag] == nil {
+			return nil, errors.New("svg: font has no " + strings.TrimSpace(tag) + " table")
+		}
+	}
+	head := &tableReader{data: tables["head"]}
+	f.unitsPerEm = float64(head.u16(18))
+	longLoca := head.u16(50) == 1
+	maxp := &tableReader{data: tables["maxp"]}
+	numGlyphs := maxp.u16(4)
+	hhea := &tableReader{data: tables["hhea"]}
+	numHMetrics := hhea.u16(34)
+
+	hmtx := &tableReader{data: tables["hmtx"]}
+	f.metrics = make([]glyphMetrics, numGlyphs)
+	var advance float64
+	for g := range numGlyphs {
+		if g < numHMetrics {
+			advance = float64(hmtx.u16(4 * g))
+		}
+		f.metrics[g].advance = advance
+	}
+
+	loca := &tableReader{data: tables["loca"]}
+	f.loca = make([]uint32, numGlyphs+1)
+	for g := range f.loca {
+		if longLoca {
+			f.loca[g] = uint32(loca.u32(4 * g))
+		} else {
+			f.loca[g] = 2 * uint32(loca.u16(2*g))
+		}
+	}
+	glyf := &tableReader{data: f.glyf}
+	for g := range numGlyphs {
+		if f.loca[g] < f.loca[g+1] {
+			off := int(f.loca[g])
+			m := &f.metrics[g]
+			m.xMin, m.yMin, m.xMax, m.yMax = glyf.i16(off+2), glyf.i16(off+4), glyf.i16(off+6), glyf.i16(off+8)
+		}
+	}
+
+	f.parseCmap(&tableReader{data: tables["cmap"]})
+	f.parseMath(&tableReader{data: tables["MATH"]})
+	if head.failed || maxp.failed || hhea.failed || hmtx.failed || loca.failed || glyf.failed || f.unitsPerEm == 0 {
+		return nil, errFont
+	}
+	return f, nil
+}
+
+// parseCmap reads the Unicode mappings of the cmap table, preferring the full repertoire (format 12) to the Basic
+// Multilingual Plane (format 4).
+func (f *font) parseCmap(t *tableReader) {
+	numSubtables := t.u16(2)
+	format4, format12 := -1, -1
+	for i := range numSubtables {
+		platform, encoding, off := t.u16(4+8*i), t.u16(6+8*i), t.u32(8+8*i)
+		if platform != 0 && platform != 3 {
+			continue
+		}
+		switch t.u16(off) {
+		case 4:
+			if platform == 0 || encoding == 1 {
+				format4 = off
+			}
+		case 12:
+			format12 = off
+		}
+	}
+	if format12 >= 0 {
+		numGroups := t.u32(format12 + 12)
+		for i := range numGroups {
+			g := format12 + 16 + 12*i
+			start, end, glyph := t.u32(g), t.u32(g+4), t.u32(g+8)
+			for r := start; r <= end && !t.failed; r++ {
+				f.cmap[rune(r)] = uint16(glyph + r - start)
+			}
+		}
+		return
+	}
+	if format4 < 0 {
+		return
+	}
+	segCount := t.u16(format4+6) / 2
+	ends := format4 + 14
+	starts := ends + 2*segCount + 2
+	deltas := starts + 2*segCount
+	rangeOffsets := deltas + 2*segCount
+	for i := range segCount {
+		start, end := t.u16(starts+2*i), t.u16(ends+2*i)
+		delta, rangeOffset := t.u16(deltas+2*i), t.u16(rangeOffsets+2*i)
+		for r := start; r <= end && r != 0xffff && !t.failed; r++ {
+			var glyph int
+			if rangeOffset == 0 {
+				glyph = (r + delta) & 0xffff
+			} else if glyph = t.u16(rangeOffsets + 2*i + rangeOffset + 2*(r-start)); glyph != 0 {
+				glyph = (glyph + delta) & 0xffff
+			}
+			if glyph != 0 {
+				f.cmap[rune(r)] = uint16(glyph)
+			}
+		}
+	}
+}
+
+// coverage returns the glyphs of an OpenType coverage table in coverage index order.
+func coverage(t *tableReader, off int) []uint16 {
+	var glyphs []uint16
+	switch t.u16(off) {
+	case 1:
+		for i := range t.u16(off + 2) {
+			glyphs = append(glyphs, uint16(t.u16(off+4+2*i)))
+		}
+	case 2:
+		for i := range t.u16(off + 2) {
+			rec := off + 4 + 6*i
+			for g := t.u16(rec); g <= t.u16(rec+2) && !t.failed; g++ {
+				glyphs = append(glyphs, uint16(g))
+			}
+		}
+	}
+	return glyphs
+}
+
+// parseMath reads the MATH table: its constants, the italic corrections and accent attachment points of glyphs, and
+// the constructions of stretchy glyphs.
+func (f *font) parseMath(t *tableReader) {
+	constants, glyphInfo, variants := t.u16(4), t.u16(6), t.u16(8)
+	for i := range numMathConstants {
+		if i < mathLeading {
+			f.constants[i] = t.i16(constants + 2*i)
+		} else {
+			// a MathValueRecord begins with its value; the last constant is a plain number, stored where the next
+			// record would be
+			f.constants[i] = t.i16(constants + 8 + 4*(i-mathLeading))
+		}
+	}
+	valueRecords := func(off int, m map[uint16]float64) {
+		if off == 0 {
+			return
+		}
+		for i, g := range coverage(t, off+t.u16(off)) {
+			m[g] = t.i16(off + 4 + 4*i)
+		}
+	}
+	valueRecords(glyphInfo+t.u16(glyphInfo), f.italics)
+	if t.u16(glyphInfo+2) != 0 {
+		valueRecords(glyphInfo+t.u16(glyphInfo+2), f.topAccent)
+	}
+	f.minOverlap = float64(t.u16(variants))
+	vertCount, horizCount := t.u16(variants+6), t.u16(variants+8)
+	readConstructions := func(covOff, first, count int, m map[uint16]*construction) {
+		if covOff == 0 {
+			return
+		}
+		for i, g := range coverage(t, variants+covOff) {
+			if i >= count {
+				break
+			}
+			off := variants + t.u16(variants+10+2*(first+i))
+			c := &construction{}
+			for v := range t.u16(off + 2) {
+				c.variants = append(c.variants, uint16(t.u16(off+4+4*v)))
+				c.sizes = append(c.sizes, float64(t.u16(off+6+4*v)))
+			}
+			if assembly := t.u16(off); assembly != 0 {
+				a := off + assembly
+				for p := range t.u16(a + 4) {
+					rec := a + 6 + 10*p
+					c.parts = append(c.parts, glyphPart{
+						glyph:          uint16(t.u16(rec)),
+						startConnector: float64(t.u16(rec + 2)),
+						endConnector:   float64(t.u16(rec + 4)),
+						fullAdvance:    float64(t.u16(rec + 6)),
+						extender:       t.u16(rec+8)&1 != 0,
+					})
+				}
+			}
+			m[g] = c
+		}
+	}
+	readConstructions(t.u16(variants+2), 0, vertCount, f.vertical)
+	readConstructions(t.u16(variants+4), vertCount, horizCount, f.horizontal)
+}
+
+// glyph returns the glyph for r, or zero (the .notdef glyph) if the font has none.
+func (f *font) glyph(r rune) uint16 {
+	return f.cmap[r]
+}
+
+// outline returns the contours of glyph g, transformed by the matrix (a, b, c, d) and offset (dx, dy).
+func (f *font) outline(g uint16, a, b, c, d, dx, dy float64, depth int) [][]point {
+	if int(g)+1 >= len(f.loca) || depth > 8 {
+		return nil
+	}
+	start, end := int(f.loca[g]), int(f.loca[g+1])
+	if start >= end || end > len(f.glyf) {
+		return nil
+	}
+	t := &tableReader{data: f.glyf[start:end]}
+	numContours := int(int16(t.u16(0)))
+	var contours [][]point
+	if numContours < 0 {
+		// a composite glyph
+		off := 10
+		for {
+			flags, component := t.u16(off), uint16(t.u16(off+2))
+			off += 4
+			var x, y float64
+			if flags&0x1 != 0 {
+				x, y = t.i16(off), t.i16(off+2)
+				off += 4
+			} else {
+				v := t.u16(off)
+				x, y = float64(int8(v>>8)), float64(int8(v))
+				off += 2
+			}
+			ca, cb, cc, cd := 1.0, 0.0, 0.0, 1.0
+			switch {
+			case flags&0x8 != 0:
+				ca = t.i16(off) / 16384
+				cd = ca
+				off += 2
+			case flags&0x40 != 0:
+				ca, cd = t.i16(off)/16384, t.i16(off+2)/16384
+				off += 4
+			case flags&0x80 != 0:
+				ca, cb, cc, cd = t.i16(off)/16384, t.i16(off+2)/16384, t.i16(off+4)/16384, t.i16(off+6)/16384
+				off += 8
+			}
+			if flags&0x2 == 0 {
+				// matching points rather than offsets, which the bundled font does not use
+				x, y = 0, 0
+			}
+			// compose the component's transformation with ours
+			contours = append(contours, f.outline(component,
+				a*ca+c*cb, b*ca+d*cb, a*cc+c*cd, b*cc+d*cd,
+				a*x+c*y+dx, b*x+d*y+dy, depth+1)...)
+			if flags&0x20 == 0 || t.failed {
+				break
+			}
+		}
+		return contours
+	}
+	endPoints := make([]int, numContours)
+	for i := range endPoints {
+		endPoints[i] = t.u16(10 + 2*i)
+	}
+	if numContours == 0 {
+		return nil
+	}
+	numPoints := endPoints[numContours-1] + 1
+	off := 10 + 2*numContours
+	off += 2 + t.u16(off) // the instructions
+	flags := make([]byte, 0, numPoints)
+	for len(flags) < numPoints && off < len(t.data) {
+		flag := t.data[off]
+		off++
+		flags = append(flags, flag)
+		if flag&0x8 != 0 && off < len(t.data) {
+			for range t.data[off] {
+				flags = append(flags, flag)
+			}
+			off++
+		}
+	}
+	if len(flags) < numPoints {
+		return nil
+	}
+	pts := make([]point, numPoints)
+	readCoords := func(short, same byte, set func(p *point, v float64)) {
+		var v float64
+		for i, flag := range flags[:numPoints] {
+			switch {
+			case flag&short != 0:
+				if off >= len(t.data) {
+					t.failed = true
+					break
+				}
+				delta := float64(t.data[off])
+				off++
+				if flag&same == 0 {
+					delta = -delta
+				}
+				v += delta
+			case flag&same == 0:
+				v += t.i16(off)
+				off += 2
+			}
+			set(&pts[i], v)
+		}
+	}
+	readCoords(0x2, 0x10, func(p *point, v float64) { p.x = v })
+	readCoords(0x4, 0x20, func(p *point, v float64) { p.y = v })
+	if t.failed {
+		return nil
+	}
+	first := 0
+	for _, last := range endPoints {
+		if last < first || last >= numPoints {
+			return nil
+		}
+		contour := make([]point, 0, last-first+1)
+		for i := first; i <= last; i++ {
+			p := pts[i]
+			contour = append(contour, point{a*p.x + c*p.y + dx, b*p.x + d*p.y + dy, flags[i]&1 != 0})
+		}
+		contours = append(contours, contour)
+		first = last + 1
+	}
+	return contours
+}
+
+// path returns the SVG path data for glyph g, in font units with the y axis pointing down.
+func (f *font) path(g uint16) string {
+	if p, ok := f.paths.Load(g); ok {
+		return p.(string)
+	}
+	var sb strings.Builder
+	for _, contour := range f.outline(g, 1, 0, 0, 1, 0, 0, 0) {
+		if len(contour) == 0 {
+			continue
+		}
+		// start from an on-curve point, inserting one between two off-curve points if there is none
+		start := 0
+		for start < len(contour) && !contour[start].onCurve {
+			start++
+		}
+		var first point
+		if start == len(contour) {
+			first = midpoint(contour[len(contour)-1], contour[0])
+			start = 0
+		} else {
+			first = contour[start]
+			start++
+		}
+		sb.WriteByte('M')
+		writeCoords(&sb, first.x, -first.y)
+		var control *point
+		for i := range len(contour) {
+			p := contour[(start+i)%len(contour)]
+			switch {
+			case p.onCurve && control == nil:
+				sb.WriteByte('L')
+				writeCoords(&sb, p.x, -p.y)
+			case p.onCurve:
+				sb.WriteByte('Q')
+				writeCoords(&sb, control.x, -control.y)
+				sb.WriteByte(' ')
+				writeCoords(&sb, p.x, -p.y)
+				control = nil
+			case control != nil:
+				mid := midpoint(*control, p)
+				sb.WriteByte('Q')
+				writeCoords(&sb, control.x, -control.y)
+				sb.WriteByte(' ')
+				writeCoords(&sb, mid.x, -mid.y)
+				control = &p
+			default:
+				control = &p
+			}
+		}
+		if control != nil {
+			sb.WriteByte('Q')
+			writeCoords(&sb, control.x, -control.y)
+			sb.WriteByte(' ')
+			writeCoords(&sb, first.x, -first.y)
+		}
+		sb.WriteByte('Z')
+	}
+	p, _ := f.paths.LoadOrStore(g, sb.String())
+	return p.(string)
+}
+
+func midpoint(p, q point) point {
+	return point{(p.x + q.x) / 2, (p.y + q.y) / 2, true}
+}
+
+func writeCoords(sb *strings.Builder, x, y float64) {
+	sb.WriteString(formatNumber(x))
+	sb.WriteByte(' ')
+	sb.WriteString(formatNumber(y))
+}
+
+// formatNumber writes v with at most two decimal places.
+func formatNumber(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" || s == "" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,1321 @@
+package svg
+
+import (
+	"html"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wyatt915/treeblood"
+)
+
+type itemKind int
+
+const (
+	itemGlyph itemKind = iota
+	itemRect           // a filled rectangle, such as the bar of a fraction
+	itemLine           // a straight line, such as a cancellation stroke
+	itemFrame          // the outline of a rectangle, such as the box of \boxed
+)
+
+// An item is a single drawing command. Coordinates are in font units relative to the origin of the box holding the
+// item, with the y axis pointing up.
+type item struct {
+	kind   itemKind
+	glyph  uint16
+	x, y   float64 // the origin of a glyph, the lower left corner of a rectangle, or the start of a line
+	w, h   float64 // the size of a rectangle, or the offset from the start of a line to its end
+	scale  float64 // the size of a glyph relative to the font, or the thickness of a line
+	radius float64 // the radius of the corners of a frame
+	color  string
+}
+
+// A box is the result of laying out an element. Its origin is the left end of its baseline; the height is measured
+// upwards from the baseline and the depth downwards.
+type box struct {
+	width, height, depth float64
+	italic               float64 // the italic correction of the glyph that ends the box, if the box is a single glyph
+	attach               float64 // the horizontal position over which an accent is centered
+	items                []item
+}
+
+// add draws c within b with its origin at (x, y). The extent of b is not changed.
+func (b *box) add(c *box, x, y float64) {
+	for _, it := range c.items {
+		it.x += x
+		it.y += y
+		b.items = append(b.items, it)
+	}
+}
+
+// shift raises the contents of b by dy.
+func (b *box) shift(dy float64) {
+	for i := range b.items {
+		b.items[i].y += dy
+	}
+	b.height += dy
+	b.depth -= dy
+}
+
+// paint gives the color c to every item of b that does not have one already.
+func (b *box) paint(c string) {
+	for i := range b.items {
+		if b.items[i].color == "" {
+			b.items[i].color = c
+		}
+	}
+}
+
+// A style holds the parts of the MathML rendering context that affect layout.
+type style struct {
+	display bool // display style, which uses larger operators and more generous spacing
+	level   int  // the script level; each level above zero is drawn smaller
+	cramped bool // superscripts are raised less, as under a radical or in a denominator
+}
+
+// script returns the style of a script attached to an element of style s.
+func (s style) script() style {
+	return style{level: s.level + 1, cramped: s.cramped}
+}
+
+func (s style) cramp() style {
+	s.cramped = true
+	return s
+}
+
+// A stretch records the size to which an operator is to be stretched.
+type stretch struct {
+	size     float64
+	vertical bool
+}
+
+type layout struct {
+	font    *font
+	stretch map[*treeblood.MMLNode]stretch // stretchy operators and the size each is to cover
+	accents map[*treeblood.MMLNode]bool    // operators that are drawn as accents over or under another element
+}
+
+func newLayout(f *font) *layout {
+	return &layout{
+		font:    f,
+		stretch: make(map[*treeblood.MMLNode]stretch),
+		accents: make(map[*treeblood.MMLNode]bool),
+	}
+}
+
+// scale returns the size of the font in style s relative to its size at script level zero.
+func (l *layout) scale(s style) float64 {
+	switch {
+	case s.level <= 0:
+		// TreeBlood enlarges delimiters such as \big( with negative script levels
+		return math.Pow(1/0.71, float64(-s.level))
+	case s.level == 1:
+		return l.font.constants[scriptPercentScaleDown] / 100
+	default:
+		return l.font.constants[scriptScriptPercentScaleDown] / 100
+	}
+}
+
+// em returns the size of the font in style s, in font units.
+func (l *layout) em(s style) float64 {
+	return l.font.unitsPerEm * l.scale(s)
+}
+
+// constant returns the value of a MATH table constant in style s.
+func (l *layout) constant(s style, c int) float64 {
+	return l.font.constants[c] * l.scale(s)
+}
+
+// length converts a MathML length to font units. A signed value is added to base, and a percentage is taken of it;
+// the pseudo-units width, height and depth, used by <mpadded>, refer to the size of rel. The second result is false if
+// v is not a length.
+func (l *layout) length(v string, s style, rel *box, base float64) (float64, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if named, ok := namedSpaces[v]; ok {
+		return named * l.em(s), true
+	}
+	sign := 0.0
+	switch v[0] {
+	case '+':
+		sign = 1
+		v = v[1:]
+	case '-':
+		sign = -1
+		v = v[1:]
+	}
+	end := strings.IndexFunc(v, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end < 0 {
+		end = len(v)
+	}
+	num, err := strconv.ParseFloat(v[:end], 64)
+	if err != nil {
+		return 0, false
+	}
+	em := l.em(s)
+	var size float64
+	switch unit := strings.TrimSpace(v[end:]); unit {
+	case "em":
+		size = num * em
+	case "ex":
+		size = num * l.font.constants[accentBaseHeight] * l.scale(s)
+	case "mu":
+		size = num * em / 18
+	case "pt":
+		// TeX's default font size is 10pt
+		size = num * em / 10
+	case "px":
+		size = num * em / 16
+	case "pc":
+		size = num * 12 * em / 10
+	case "in":
+		size = num * 72.27 * em / 10
+	case "cm":
+		size = num * 72.27 / 2.54 * em / 10
+	case "mm":
+		size = num * 72.27 / 25.4 * em / 10
+	case "%":
+		size = num / 100 * base
+	case "width", "height", "depth":
+		if rel == nil {
+			return 0, false
+		}
+		size = num * map[string]float64{"width": rel.width, "height": rel.height, "depth": rel.depth}[unit]
+	case "":
+		if num != 0 {
+			// a unitless number scales the default value
+			size = num * base
+		}
+	default:
+		return 0, false
+	}
+	if sign != 0 {
+		return base + sign*size, true
+	}
+	return size, true
+}
+
+// The MathML named spaces, in ems.
+var namedSpaces = map[string]float64{
+	"veryverythinmathspace":          1.0 / 18,
+	"verythinmathspace":              2.0 / 18,
+	"thinmathspace":                  3.0 / 18,
+	"mediummathspace":                4.0 / 18,
+	"thickmathspace":                 5.0 / 18,
+	"verythickmathspace":             6.0 / 18,
+	"veryverythickmathspace":         7.0 / 18,
+	"negativeveryverythinmathspace":  -1.0 / 18,
+	"negativeverythinmathspace":      -2.0 / 18,
+	"negativethinmathspace":          -3.0 / 18,
+	"negativemediummathspace":        -4.0 / 18,
+	"negativethickmathspace":         -5.0 / 18,
+	"negativeverythickmathspace":     -6.0 / 18,
+	"negativeveryverythickmathspace": -7.0 / 18,
+}
+
+// cssProperty returns the value of an inline style property of n, which is found in CSS for trees built by TreeBlood
+// and in the style attribute for trees read with treeblood.ParseMathML.
+func cssProperty(n *treeblood.MMLNode, name string) string {
+	if v, ok := n.CSS[name]; ok {
+		return v
+	}
+	for decl := range strings.SplitSeq(n.Attrib["style"], ";") {
+		key, val, ok := strings.Cut(decl, ":")
+		if ok && strings.TrimSpace(key) == name {
+			return strings.TrimSpace(val)
+		}
+	}
+	return ""
+}
+
+// embellishedOp returns the <mo> at the core of n if n is an embellished operator: an operator, possibly with scripts
+// or in a row of its own.
+func embellishedOp(n *treeblood.MMLNode) *treeblood.MMLNode {
+	if n == nil {
+		return nil
+	}
+	switch n.Tag {
+	case "mo":
+		return n
+	case "msub", "msup", "msubsup", "munder", "mover", "munderover", "mmultiscripts", "mfrac", "semantics":
+		if len(n.Children) > 0 {
+			return embellishedOp(n.Children[0])
+		}
+	case "mrow", "mstyle", "mphantom", "mpadded":
+		if len(n.Children) == 1 {
+			return embellishedOp(n.Children[0])
+		}
+	}
+	return nil
+}
+
+// text returns the characters of a token element.
+func text(n *treeblood.MMLNode) string {
+	return html.UnescapeString(n.Text)
+}
+
+// isStretchy reports whether the operator n stretches to fit its surroundings.
+func isStretchy(n *treeblood.MMLNode) bool {
+	switch n.Attrib["stretchy"] {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return n.Attrib["fence"] == "true"
+}
+
+// operatorRune returns the character of the operator n as it is drawn, or zero if n is not a single character.
+func (l *layout) operatorRune(n *treeblood.MMLNode) rune {
+	r, size := utf8.DecodeRuneInString(text(n))
+	if size == 0 || size != len(text(n)) {
+		return 0
+	}
+	if mark, ok := accentMarks[r]; ok && l.accents[n] {
+		return mark
+	}
+	return r
+}
+
+// stretchesVertically reports whether n is an embellished operator that grows to the height of the row holding it.
+func (l *layout) stretchesVertically(n *treeblood.MMLNode) bool {
+	core := embellishedOp(n)
+	if core == nil || !isStretchy(core) {
+		return false
+	}
+	r := l.operatorRune(core)
+	return r == 0 && text(core) == "" || l.font.vertical[l.font.glyph(r)] != nil
+}
+
+// stretchesHorizontally reports whether n is an embellished operator that grows to the width of the elements above or
+// below it.
+func (l *layout) stretchesHorizontally(n *treeblood.MMLNode) bool {
+	core := embellishedOp(n)
+	if core == nil || !isStretchy(core) {
+		return false
+	}
+	return l.font.horizontal[l.font.glyph(l.operatorRune(core))] != nil
+}
+
+// restyle applies the attributes of n that change the style of n and its descendants.
+func restyle(n *treeblood.MMLNode, s style) style {
+	switch n.Attrib["displaystyle"] {
+	case "true":
+		s.display = true
+	case "false":
+		s.display = false
+	}
+	if level := n.Attrib["scriptlevel"]; level != "" {
+		if v, err := strconv.Atoi(strings.TrimPrefix(level, "+")); err == nil {
+			if level[0] == '+' || level[0] == '-' {
+				s.level += v
+			} else {
+				s.level = v
+			}
+		}
+	}
+	return s
+}
+
+// node lays out the element n in style s.
+func (l *layout) node(n *treeblood.MMLNode, s style) *box {
+	if n == nil {
+		return &box{}
+	}
+	s = restyle(n, s)
+	var b *box
+	switch n.Tag {
+	case "mi", "mn", "mo", "mtext", "ms":
+		b = l.token(n, s)
+	case "mspace":
+		b = l.space(n, s)
+	case "mfrac":
+		b = l.fraction(n, s)
+	case "msqrt":
+		b = l.radical(l.row(n.Children, s.cramp()), nil, s)
+	case "mroot":
+		if len(n.Children) < 2 {
+			b = l.row(n.Children, s)
+			break
+		}
+		b = l.radical(l.node(n.Children[0], s.cramp()), l.node(n.Children[1], style{level: s.level + 2, cramped: true}), s)
+	case "msub", "msup", "msubsup":
+		b = l.scripts(n, s)
+	case "munder", "mover", "munderover":
+		b = l.underOver(n, s)
+	case "mmultiscripts":
+		b = l.multiscripts(n, s)
+	case "mtable":
+		b = l.table(n, s)
+	case "mpadded":
+		b = l.padded(n, s)
+	case "mphantom":
+		b = l.row(n.Children, s)
+		b.items = nil
+	case "menclose":
+		b = l.enclose(n, s)
+	case "semantics":
+		if len(n.Children) == 0 {
+			b = &box{}
+			break
+		}
+		b = l.node(n.Children[0], s)
+	case "annotation", "annotation-xml", "none", "mprescripts":
+		b = &box{}
+	default:
+		if len(n.Children) == 0 && n.Text != "" {
+			// text directly within an element such as <merror>
+			b = l.token(n, s)
+			break
+		}
+		b = l.row(n.Children, s)
+	}
+	if n.Tag == "merror" {
+		b.paint("red")
+	}
+	if c := n.Attrib["mathcolor"]; c != "" {
+		b.paint(c)
+	} else if c := cssProperty(n, "color"); c != "" {
+		b.paint(c)
+	}
+	if c := n.Attrib["mathbackground"]; c != "" {
+		bg := item{kind: itemRect, y: -b.depth, w: b.width, h: b.height + b.depth, color: c}
+		b.items = append([]item{bg}, b.items...)
+	}
+	translate(b, cssProperty(n, "transform"))
+	return b
+}
+
+// translate moves the drawing of b, but not b itself, by a CSS transform of the form translateX(p%), which is used by
+// \mathllap and \mathclap. Other transforms are ignored.
+func translate(b *box, transform string) {
+	p, ok := strings.CutPrefix(transform, "translateX(")
+	if !ok {
+		return
+	}
+	p, ok = strings.CutSuffix(p, "%)")
+	if !ok {
+		return
+	}
+	pct, err := strconv.ParseFloat(p, 64)
+	if err != nil {
+		return
+	}
+	for i := range b.items {
+		b.items[i].x += pct / 100 * b.width
+	}
+}
+
+// glyphBox returns a box holding only the glyph g. A glyph without advance, such as a combining accent, is moved so
+// that its ink begins at the origin.
+func (l *layout) glyphBox(g uint16, scale float64) *box {
+	m := l.font.metrics[g]
+	b := &box{
+		width:  m.advance * scale,
+		height: m.yMax * scale,
+		depth:  -m.yMin * scale,
+		italic: l.font.italics[g] * scale,
+		items:  []item{{kind: itemGlyph, glyph: g, scale: scale}},
+	}
+	x := 0.0
+	if m.advance == 0 && m.xMax > m.xMin {
+		x = -m.xMin * scale
+		b.width = (m.xMax - m.xMin) * scale
+		b.items[0].x = x
+	}
+	if a, ok := l.font.topAccent[g]; ok {
+		b.attach = x + a*scale
+	} else {
+		b.attach = b.width / 2
+	}
+	return b
+}
+
+// token lays out a token element such as <mi> or <mo>.
+func (l *layout) token(n *treeblood.MMLNode, s style) *box {
+	t := text(n)
+	if n.Tag == "ms" {
+		t = `"` + t + `"`
+	}
+	variant := n.Attrib["mathvariant"]
+	if variant == "" && n.Tag == "mi" && utf8.RuneCountInString(t) == 1 {
+		variant = "italic"
+	}
+	scale := l.scale(s)
+	if n.Tag == "mo" {
+		if b := l.operator(n, s); b != nil {
+			return b
+		}
+	}
+	b := &box{}
+	glyphs := 0
+	for _, r := range t {
+		if r >= 0x2061 && r <= 0x2064 {
+			// invisible operators such as function application
+			continue
+		}
+		if n.Tag == "mo" && l.accents[n] {
+			if mark, ok := accentMarks[r]; ok {
+				r = mark
+			}
+		}
+		g := l.font.glyph(mathVariant(r, variant))
+		gb := l.glyphBox(g, scale)
+		b.add(gb, b.width, 0)
+		b.height = max(b.height, gb.height)
+		b.depth = max(b.depth, gb.depth)
+		b.italic, b.attach = gb.italic, b.width+gb.attach
+		b.width += gb.width
+		glyphs++
+	}
+	if glyphs != 1 {
+		b.italic, b.attach = 0, b.width/2
+	}
+	return b
+}
+
+// operator lays out an <mo> that is stretched or enlarged, returning nil for an ordinary operator.
+func (l *layout) operator(n *treeblood.MMLNode, s style) *box {
+	r := l.operatorRune(n)
+	g := l.font.glyph(r)
+	scale := l.scale(s)
+	axis := l.constant(s, axisHeight)
+	if st, ok := l.stretch[n]; ok {
+		if r == 0 {
+			// the empty delimiter of \right.
+			return &box{}
+		}
+		b := l.stretchGlyph(g, st.size, st.vertical, scale)
+		if b == nil {
+			return nil
+		}
+		if st.vertical {
+			b.shift(axis - (b.height-b.depth)/2)
+		}
+		return b
+	}
+	if n.Attrib["largeop"] != "true" || g == 0 {
+		return nil
+	}
+	b := l.glyphBox(g, scale)
+	if c := l.font.vertical[g]; c != nil && s.display {
+		for i, v := range c.variants {
+			if c.sizes[i] >= l.font.constants[displayOperatorMinHeight] || i == len(c.variants)-1 {
+				b = l.glyphBox(v, scale)
+				break
+			}
+		}
+	}
+	// large operators are centered on the axis
+	b.shift(axis - (b.height-b.depth)/2)
+	return b
+}
+
+// stretchGlyph returns a box holding the smallest variant of g that is at least size long in the given direction,
+// built from parts if need be. The result is nil if g cannot be stretched in that direction. An assembled glyph is
+// placed with its lower left corner at the origin.
+func (l *layout) stretchGlyph(g uint16, size float64, vertical bool, scale float64) *box {
+	c := l.font.horizontal[g]
+	if vertical {
+		c = l.font.vertical[g]
+	}
+	if c == nil {
+		return nil
+	}
+	target := size / scale
+	if len(c.variants) == 0 && len(c.parts) == 0 {
+		return nil
+	}
+	if !vertical && len(c.parts) == 0 {
+		// a wide accent, which TeX draws with the widest variant that is no wider than its base
+		v := c.variants[0]
+		for i := range c.variants {
+			if c.sizes[i] <= target {
+				v = c.variants[i]
+			}
+		}
+		return l.glyphBox(v, scale)
+	}
+	for i, v := range c.variants {
+		if c.sizes[i] >= target || i == len(c.variants)-1 && len(c.parts) == 0 {
+			return l.glyphBox(v, scale)
+		}
+	}
+	return l.assemble(c.parts, target, vertical, scale)
+}
+
+// assemble builds a glyph at least target font units long from parts, repeating the extenders as often as needed.
+func (l *layout) assemble(parts []glyphPart, target float64, vertical bool, scale float64) *box {
+	minOverlap := l.font.minOverlap
+	var seq []glyphPart
+	for reps := 0; reps < 1000; reps++ {
+		seq = seq[:0]
+		total := 0.0
+		for _, p := range parts {
+			n := 1
+			if p.extender {
+				n = reps
+			}
+			for range n {
+				seq = append(seq, p)
+				total += p.fullAdvance
+			}
+		}
+		if len(seq) > 0 && total-float64(len(seq)-1)*minOverlap >= target {
+			break
+		}
+	}
+	if len(seq) == 0 {
+		return &box{}
+	}
+	total := 0.0
+	for _, p := range seq {
+		total += p.fullAdvance
+	}
+	// spread the overlap evenly over the joints, within the lengths of the connectors
+	overlap := minOverlap
+	if len(seq) > 1 {
+		overlap = max(minOverlap, (total-target)/float64(len(seq)-1))
+	}
+	b := &box{}
+	pos := 0.0
+	for i, p := range seq {
+		m := l.font.metrics[p.glyph]
+		it := item{kind: itemGlyph, glyph: p.glyph, scale: scale}
+		if vertical {
+			it.y = (pos - m.yMin) * scale
+			b.width = max(b.width, m.advance*scale)
+		} else {
+			it.x = pos * scale
+			if m.advance == 0 {
+				// parts of a combining mark, which lie to the left of their origins
+				it.x -= m.xMin * scale
+			}
+			b.height = max(b.height, m.yMax*scale)
+			b.depth = max(b.depth, -m.yMin*scale)
+		}
+		b.items = append(b.items, it)
+		pos += p.fullAdvance
+		if i < len(seq)-1 {
+			pos -= min(overlap, max(minOverlap, min(p.endConnector, seq[i+1].startConnector)))
+		}
+	}
+	if vertical {
+		b.height = pos * scale
+	} else {
+		b.width = pos * scale
+	}
+	b.attach = b.width / 2
+	return b
+}
+
+// space lays out an <mspace>.
+func (l *layout) space(n *treeblood.MMLNode, s style) *box {
+	b := &box{}
+	b.width, _ = l.length(n.Attrib["width"], s, nil, 0)
+	b.height, _ = l.length(n.Attrib["height"], s, nil, 0)
+	b.depth, _ = l.length(n.Attrib["depth"], s, nil, 0)
+	return b
+}
+
+// spacing returns the space before and after the child i of a row, which depends on the operator at its core.
+func (l *layout) spacing(children []*treeblood.MMLNode, i int, s style) (float64, float64) {
+	n := children[i]
+	core := embellishedOp(n)
+	var lspace, rspace float64
+	lset, rset := false, false
+	// the lspace of an <mpadded> moves its contents within it rather than spacing it from its neighbors
+	if t := core; t != nil || n.Tag != "mpadded" && (n.Attrib["lspace"] != "" || n.Attrib["rspace"] != "") {
+		if t == nil {
+			t = n
+		}
+		lspace, lset = l.length(t.Attrib["lspace"], s, nil, 0)
+		rspace, rset = l.length(t.Attrib["rspace"], s, nil, 0)
+	}
+	em := l.em(s)
+	if core == nil && n.Tag == "mi" && utf8.RuneCountInString(text(n)) > 1 && s.level <= 0 {
+		// a function name such as sin is set off from its argument, as in TeX, unless the argument is in brackets
+		if !lset && i > 0 && embellishedOp(children[i-1]) == nil {
+			lspace = 3 * em / 18
+		}
+		if !rset && i < len(children)-1 && embellishedOp(children[i+1]) == nil {
+			rspace = 3 * em / 18
+		}
+	}
+	if core == nil || lset && rset || s.level > 0 {
+		return lspace, rspace
+	}
+	var left, right float64
+	class := operatorClass(text(core))
+	if core.Attrib["largeop"] == "true" {
+		class = opLarge
+	}
+	switch class {
+	case opRelation:
+		left, right = 5*em/18, 5*em/18
+	case opBinary:
+		// a binary operator at the start of a row or after another operator is unary
+		form := core.Attrib["form"]
+		unary := form == "prefix" || form == "postfix" || i == 0 || i == len(children)-1
+		if i > 0 {
+			if prev := embellishedOp(children[i-1]); prev != nil && operatorClass(text(prev)) != opOrdinary {
+				unary = true
+			}
+		}
+		if !unary {
+			left, right = 4*em/18, 4*em/18
+		}
+	case opPunctuation:
+		right = 3 * em / 18
+	case opLarge:
+		if i > 0 {
+			left = 3 * em / 18
+		}
+		right = 3 * em / 18
+	}
+	if !lset {
+		lspace = left
+	}
+	if !rset {
+		rspace = right
+	}
+	return lspace, rspace
+}
+
+// row lays out elements side by side, stretching any operators among them, such as the fences of \left and \right, to
+// the height of the others.
+func (l *layout) row(children []*treeblood.MMLNode, s style) *box {
+	boxes := make([]*box, len(children))
+	var stretchy []int
+	var height, depth float64
+	for i, c := range children {
+		if l.stretchesVertically(c) {
+			stretchy = append(stretchy, i)
+			continue
+		}
+		boxes[i] = l.node(c, s)
+		height, depth = max(height, boxes[i].height), max(depth, boxes[i].depth)
+	}
+	if len(stretchy) > 0 {
+		axis := l.constant(s, axisHeight)
+		half := max(height-axis, depth+axis)
+		// the delimiters may fall a little short of the formula, as in TeX
+		size := max(2*half*0.901, 2*half-l.em(s)/2)
+		for _, i := range stretchy {
+			core := embellishedOp(children[i])
+			l.stretch[core] = stretch{size: size, vertical: true}
+			boxes[i] = l.node(children[i], s)
+			delete(l.stretch, core)
+		}
+	}
+	b := &box{}
+	for i, c := range boxes {
+		lspace, rspace := l.spacing(children, i, s)
+		b.add(c, b.width+lspace, 0)
+		b.width += lspace + c.width + rspace
+		b.height, b.depth = max(b.height, c.height), max(b.depth, c.depth)
+	}
+	if len(boxes) == 1 {
+		b.italic, b.attach = boxes[0].italic, boxes[0].attach
+	} else {
+		b.attach = b.width / 2
+	}
+	return b
+}
+
+// fraction lays out an <mfrac>.
+func (l *layout) fraction(n *treeblood.MMLNode, s style) *box {
+	if len(n.Children) != 2 {
+		return l.row(n.Children, s)
+	}
+	inner := style{level: s.level + 1, cramped: s.cramped}
+	if s.display {
+		inner = style{level: s.level, cramped: s.cramped}
+	}
+	num := l.node(n.Children[0], inner)
+	den := l.node(n.Children[1], inner.cramp())
+	axis := l.constant(s, axisHeight)
+	thickness := l.constant(s, fractionRuleThickness)
+	if t, ok := l.length(n.Attrib["linethickness"], s, nil, thickness); ok {
+		thickness = t
+	}
+	var up, down float64
+	if thickness == 0 {
+		gap := l.constant(s, stackGapMin)
+		up, down = l.constant(s, stackTopShiftUp), l.constant(s, stackBottomShiftDown)
+		if s.display {
+			gap = l.constant(s, stackDisplayStyleGapMin)
+			up, down = l.constant(s, stackTopDisplayStyleShiftUp), l.constant(s, stackBottomDisplayStyleShiftDown)
+		}
+		if actual := (up - num.depth) - (den.height - down); actual < gap {
+			up += (gap - actual) / 2
+			down += (gap - actual) / 2
+		}
+	} else {
+		numGap, denGap := l.constant(s, fractionNumeratorGapMin), l.constant(s, fractionDenominatorGapMin)
+		up, down = l.constant(s, fractionNumeratorShiftUp), l.constant(s, fractionDenominatorShiftDown)
+		if s.display {
+			numGap, denGap = l.constant(s, fractionNumDisplayStyleGapMin), l.constant(s, fractionDenomDisplayStyleGapMin)
+			up, down = l.constant(s, fractionNumeratorDisplayStyleShiftUp), l.constant(s, fractionDenominatorDisplayStyleShiftDown)
+		}
+		up = max(up, axis+thickness/2+numGap+num.depth)
+		down = max(down, den.height+denGap-axis+thickness/2)
+	}
+	// a little space on either side keeps the bar clear of its neighbours
+	pad := l.em(s) / 10
+	width := max(num.width, den.width) + 2*pad
+	b := &box{width: width}
+	b.add(num, (width-num.width)/2, up)
+	b.add(den, (width-den.width)/2, -down)
+	if thickness > 0 {
+		b.items = append(b.items, item{kind: itemRect, x: pad / 2, y: axis - thickness/2, w: width - pad, h: thickness})
+	}
+	b.height = max(up+num.height, axis+thickness/2)
+	b.depth = max(down+den.depth, thickness/2-axis)
+	b.attach = width / 2
+	return b
+}
+
+// radical lays out a square root of base, or a root of the given degree if it is not nil.
+func (l *layout) radical(base, degree *box, s style) *box {
+	gap := l.constant(s, radicalVerticalGap)
+	if s.display {
+		gap = l.constant(s, radicalDisplayStyleVerticalGap)
+	}
+	thickness := l.constant(s, radicalRuleThickness)
+	target := base.height + base.depth + gap + thickness
+	g := l.font.glyph('√')
+	rad := l.stretchGlyph(g, target, true, l.scale(s))
+	if rad == nil {
+		rad = l.glyphBox(g, l.scale(s))
+	}
+	if total := rad.height + rad.depth; total > target {
+		gap += (total - target) / 2
+	}
+	top := base.height + gap + thickness
+	rad.shift(top - rad.height)
+	b := &box{}
+	x := 0.0
+	if degree != nil {
+		before, after := l.constant(s, radicalKernBeforeDegree), l.constant(s, radicalKernAfterDegree)
+		raise := l.font.constants[radicalDegreeBottomRaisePercent] / 100 * (rad.height + rad.depth)
+		bottom := raise - rad.depth
+		b.add(degree, before, bottom)
+		b.height = bottom + degree.height
+		x = max(0, before+degree.width+after)
+	}
+	b.add(rad, x, 0)
+	x += rad.width
+	b.items = append(b.items, item{kind: itemRect, x: x, y: top - thickness, w: base.width, h: thickness})
+	b.add(base, x, 0)
+	b.width = x + base.width
+	b.height = max(b.height, top+l.constant(s, radicalExtraAscender))
+	b.depth = max(base.depth, rad.depth)
+	b.attach = x + base.attach
+	return b
+}
+
+// isToken reports whether the base of a script is a single character, whose scripts are positioned by the font's
+// constants alone rather than by the size of the base.
+func isToken(n *treeblood.MMLNode) bool {
+	switch n.Tag {
+	case "mi", "mn", "mtext":
+		return utf8.RuneCountInString(text(n)) <= 1
+	case "mo":
+		// a large operator is treated as a box, as TeX does once it has been enlarged
+		return utf8.RuneCountInString(text(n)) <= 1 && n.Attrib["largeop"] != "true"
+	}
+	return false
+}
+
+// scripts lays out an <msub>, <msup> or <msubsup>.
+func (l *layout) scripts(n *treeblood.MMLNode, s style) *box {
+	if len(n.Children) < 2 {
+		return l.row(n.Children, s)
+	}
+	base := n.Children[0]
+	var sub, sup *treeblood.MMLNode
+	switch n.Tag {
+	case "msub":
+		sub = n.Children[1]
+	case "msup":
+		sup = n.Children[1]
+	default:
+		sub = n.Children[1]
+		if len(n.Children) > 2 {
+			sup = n.Children[2]
+		}
+	}
+	return l.attachScripts(l.node(base, s), base, sub, sup, s)
+}
+
+// attachScripts places a subscript and superscript, either of which may be nil, after the base b laid out from the
+// element base.
+func (l *layout) attachScripts(b *box, base, sub, sup *treeblood.MMLNode, s style) *box {
+	var subBox, supBox *box
+	if sub != nil && sub.Tag != "none" {
+		subBox = l.node(sub, s.script().cramp())
+	}
+	if sup != nil && sup.Tag != "none" {
+		supBox = l.node(sup, s.script())
+	}
+	var dropUp, dropDown float64
+	if !isToken(base) {
+		dropUp = b.height - l.constant(s, superscriptBaselineDropMax)
+		dropDown = b.depth + l.constant(s, subscriptBaselineDropMin)
+	}
+	var subShift, supShift float64
+	if subBox != nil {
+		subShift = max(l.constant(s, subscriptShiftDown), subBox.height-l.constant(s, subscriptTopMax), dropDown)
+	}
+	if supBox != nil {
+		up := l.constant(s, superscriptShiftUp)
+		if s.cramped {
+			up = l.constant(s, superscriptShiftUpCramped)
+		}
+		supShift = max(up, supBox.depth+l.constant(s, superscriptBottomMin), dropUp)
+	}
+	if subBox != nil && supBox != nil {
+		if gap := (supShift - supBox.depth) - (subBox.height - subShift); gap < l.constant(s, subSuperscriptGapMin) {
+			subShift += l.constant(s, subSuperscriptGapMin) - gap
+			if lift := l.constant(s, superscriptBottomMaxWithSubscript) - (supShift - supBox.depth); lift > 0 {
+				supShift += lift
+				subShift -= lift
+			}
+		}
+	}
+	out := &box{width: b.width, height: b.height, depth: b.depth, attach: b.attach}
+	out.add(b, 0, 0)
+	// the superscript follows the slant of an italic letter; the subscript of an integral is tucked under it instead
+	subX, supX := b.width, b.width+b.italic
+	if core := embellishedOp(base); core != nil && core.Attrib["largeop"] == "true" {
+		subX, supX = b.width-b.italic, b.width
+	}
+	width := b.width
+	if subBox != nil {
+		out.add(subBox, subX, -subShift)
+		width = max(width, subX+subBox.width)
+		out.depth = max(out.depth, subShift+subBox.depth)
+		out.height = max(out.height, subBox.height-subShift)
+	}
+	if supBox != nil {
+		out.add(supBox, supX, supShift)
+		width = max(width, supX+supBox.width)
+		out.height = max(out.height, supShift+supBox.height)
+		out.depth = max(out.depth, supBox.depth-supShift)
+	}
+	if subBox != nil || supBox != nil {
+		width += l.constant(s, spaceAfterScript)
+	}
+	out.width = width
+	return out
+}
+
+// isAccent reports whether the operator at the core of n is drawn as an accent by default, as the MathML operator
+// dictionary gives for accents and for horizontal braces and arrows.
+func (l *layout) isAccent(n *treeblood.MMLNode) bool {
+	core := embellishedOp(n)
+	if core == nil {
+		return false
+	}
+	r, size := utf8.DecodeRuneInString(text(core))
+	if size == 0 || size != len(text(core)) {
+		return false
+	}
+	_, mark := accentMarks[r]
+	return mark || isCombining(r) || l.font.horizontal[l.font.glyph(r)] != nil
+}
+
+// isCombiningAccent reports whether the accent n is drawn with a combining mark, which is designed to sit over a base
+// of the height given by the AccentBaseHeight constant.
+func (l *layout) isCombiningAccent(n *treeblood.MMLNode) bool {
+	core := embellishedOp(n)
+	return core != nil && isCombining(l.operatorRune(core))
+}
+
+// underOver lays out an <munder>, <mover> or <munderover>.
+func (l *layout) underOver(n *treeblood.MMLNode, s style) *box {
+	if len(n.Children) < 2 {
+		return l.row(n.Children, s)
+	}
+	base := n.Children[0]
+	var under, over *treeblood.MMLNode
+	switch n.Tag {
+	case "munder":
+		under = n.Children[1]
+	case "mover":
+		over = n.Children[1]
+	default:
+		under = n.Children[1]
+		if len(n.Children) > 2 {
+			over = n.Children[2]
+		}
+	}
+	if core := embellishedOp(base); core != nil && core.Attrib["movablelimits"] == "true" && !s.display {
+		return l.attachScripts(l.node(base, s), base, under, over, s)
+	}
+	accent := func(attr string, n *treeblood.MMLNode) bool {
+		if n == nil {
+			return false
+		}
+		if attr != "" {
+			return attr == "true"
+		}
+		return l.isAccent(n)
+	}
+	overAccent, underAccent := accent(n.Attrib["accent"], over), accent(n.Attrib["accentunder"], under)
+	baseStyle, overStyle, underStyle := s, s.script(), s.script().cramp()
+	if overAccent {
+		baseStyle, overStyle = s.cramp(), s.cramp()
+		if core := embellishedOp(over); core != nil {
+			l.accents[core] = true
+		}
+	}
+	if underAccent {
+		underStyle = s.cramp()
+		if core := embellishedOp(under); core != nil {
+			l.accents[core] = true
+		}
+	}
+	// lay out the parts that do not stretch first, then stretch the others to the widest of them
+	parts := []*treeblood.MMLNode{base, under, over}
+	styles := []style{baseStyle, underStyle, overStyle}
+	boxes := make([]*box, 3)
+	var stretchy []int
+	width := 0.0
+	for i, p := range parts {
+		if p == nil {
+			continue
+		}
+		if l.stretchesHorizontally(p) {
+			stretchy = append(stretchy, i)
+			continue
+		}
+		boxes[i] = l.node(p, styles[i])
+		width = max(width, boxes[i].width)
+	}
+	for _, i := range stretchy {
+		core := embellishedOp(parts[i])
+		if width > 0 {
+			l.stretch[core] = stretch{size: width}
+		}
+		boxes[i] = l.node(parts[i], styles[i])
+		delete(l.stretch, core)
+	}
+	baseBox := boxes[0]
+	largeop := false
+	if core := embellishedOp(base); core != nil && core.Attrib["largeop"] == "true" {
+		largeop = true
+	}
+	baseStretchy := len(stretchy) > 0 && stretchy[0] == 0
+	b := &box{height: baseBox.height, depth: baseBox.depth}
+	type placed struct {
+		b    *box
+		x, y float64
+	}
+	items := []placed{{baseBox, 0, 0}}
+	left, right := 0.0, baseBox.width
+	center := func(c *box, isAccent bool) float64 {
+		if isAccent {
+			return baseBox.attach - c.attach
+		}
+		return (baseBox.width - c.width) / 2
+	}
+	if o := boxes[2]; o != nil {
+		var y float64
+		switch {
+		case overAccent && l.isCombiningAccent(over):
+			// combining accents are drawn at the right height for a base as tall as an x
+			y = max(0, baseBox.height-l.constant(s, accentBaseHeight))
+		case overAccent:
+			y = baseBox.height + l.constant(s, overbarVerticalGap) + o.depth
+		case largeop:
+			y = baseBox.height + max(l.constant(s, upperLimitGapMin)+o.depth, l.constant(s, upperLimitBaselineRiseMin))
+		case baseStretchy:
+			y = baseBox.height + l.constant(s, stretchStackGapAboveMin) + o.depth
+		default:
+			y = baseBox.height + l.constant(s, overbarVerticalGap) + o.depth
+		}
+		x := center(o, overAccent)
+		items = append(items, placed{o, x, y})
+		left, right = min(left, x), max(right, x+o.width)
+		b.height = max(b.height, y+o.height)
+	}
+	if u := boxes[1]; u != nil {
+		var y float64
+		switch {
+		case underAccent && l.isCombiningAccent(under):
+			y = -baseBox.depth
+		case underAccent:
+			y = -(baseBox.depth + l.constant(s, underbarVerticalGap) + u.height)
+		case largeop:
+			y = -(baseBox.depth + max(l.constant(s, lowerLimitGapMin)+u.height, l.constant(s, lowerLimitBaselineDropMin)))
+		case baseStretchy:
+			y = -(baseBox.depth + l.constant(s, stretchStackGapBelowMin) + u.height)
+		default:
+			y = -(baseBox.depth + l.constant(s, underbarVerticalGap) + u.height)
+		}
+		x := center(u, underAccent)
+		items = append(items, placed{u, x, y})
+		left, right = min(left, x), max(right, x+u.width)
+		b.depth = max(b.depth, u.depth-y)
+	}
+	for _, p := range items {
+		b.add(p.b, p.x-left, p.y)
+	}
+	b.width = right - left
+	b.attach = baseBox.attach - left
+	b.italic = baseBox.italic
+	return b
+}
+
+// multiscripts lays out an <mmultiscripts>, with any prescripts before the base and the other scripts after it.
+func (l *layout) multiscripts(n *treeblood.MMLNode, s style) *box {
+	if len(n.Children) == 0 {
+		return &box{}
+	}
+	base := n.Children[0]
+	var post, pre []*treeblood.MMLNode
+	for _, c := range n.Children[1:] {
+		switch {
+		case c.Tag == "mprescripts":
+			pre = []*treeblood.MMLNode{}
+		case pre != nil:
+			pre = append(pre, c)
+		default:
+			post = append(post, c)
+		}
+	}
+	b := l.node(base, s)
+	out := &box{}
+	if len(pre) > 0 {
+		prescripts := &box{height: b.height, depth: b.depth}
+		for i := 0; i+1 < len(pre); i += 2 {
+			prescripts = l.attachScripts(prescripts, base, pre[i], pre[i+1], s)
+		}
+		out.add(prescripts, 0, 0)
+		out.width = prescripts.width
+		out.height, out.depth = prescripts.height, prescripts.depth
+	}
+	for i := 0; i+1 < len(post); i += 2 {
+		b = l.attachScripts(b, base, post[i], post[i+1], s)
+	}
+	out.add(b, out.width, 0)
+	out.attach = out.width + b.attach
+	out.width += b.width
+	out.height, out.depth = max(out.height, b.height), max(out.depth, b.depth)
+	return out
+}
+
+// padded lays out an <mpadded>, whose size and position may differ from those of its contents.
+func (l *layout) padded(n *treeblood.MMLNode, s style) *box {
+	inner := l.row(n.Children, s)
+	b := &box{width: inner.width, height: inner.height, depth: inner.depth}
+	if w, ok := l.length(n.Attrib["width"], s, inner, inner.width); ok {
+		b.width = w
+	}
+	if h, ok := l.length(n.Attrib["height"], s, inner, inner.height); ok {
+		b.height = h
+	}
+	if d, ok := l.length(n.Attrib["depth"], s, inner, inner.depth); ok {
+		b.depth = d
+	}
+	x, _ := l.length(n.Attrib["lspace"], s, inner, 0)
+	y, _ := l.length(n.Attrib["voffset"], s, inner, 0)
+	b.add(inner, x, y)
+	b.attach = x + inner.attach
+	return b
+}
+
+// enclose lays out an <menclose>, drawing the lines given by its notation around or through its contents.
+func (l *layout) enclose(n *treeblood.MMLNode, s style) *box {
+	inner := l.row(n.Children, s)
+	notation := strings.Fields(n.Attrib["notation"])
+	if len(notation) == 0 {
+		notation = []string{"longdiv"}
+	}
+	thickness := l.constant(s, fractionRuleThickness)
+	pad := 0.0
+	for _, note := range notation {
+		switch note {
+		case "box", "roundedbox", "circle", "left", "right", "top", "bottom", "longdiv", "actuarial", "madruwb":
+			pad = l.em(s) / 6
+		}
+	}
+	b := &box{width: inner.width + 2*pad, height: inner.height + pad, depth: inner.depth + pad}
+	if pad > 0 {
+		b.height += thickness
+		b.depth += thickness
+		b.width += 2 * thickness
+	}
+	x0, y0 := thickness/2, thickness/2-b.depth
+	w, h := b.width-thickness, b.height+b.depth-thickness
+	// the lines are drawn in the border color, as with \fcolorbox, or else in the color of the contents
+	color := cssProperty(n, "border-color")
+	line := func(x, y, dx, dy float64) {
+		b.items = append(b.items, item{kind: itemLine, x: x, y: y, w: dx, h: dy, scale: thickness, color: color})
+	}
+	frame := func(radius float64) {
+		b.items = append(b.items, item{kind: itemFrame, x: x0, y: y0, w: w, h: h, scale: thickness, radius: radius, color: color})
+	}
+	for _, note := range notation {
+		switch note {
+		case "box":
+			frame(0)
+		case "roundedbox":
+			frame(l.em(s) / 4)
+		case "circle":
+			frame(math.Inf(1))
+		case "left", "longdiv":
+			line(x0, y0, 0, h)
+		case "right":
+			line(x0+w, y0, 0, h)
+		case "top":
+			line(x0, y0+h, w, 0)
+		case "bottom":
+			line(x0, y0, w, 0)
+		case "actuarial":
+			line(x0, y0+h, w, 0)
+			line(x0+w, y0, 0, h)
+		case "madruwb":
+			line(x0, y0, w, 0)
+			line(x0+w, y0, 0, h)
+		case "updiagonalstrike":
+			line(x0, y0, w, h)
+		case "downdiagonalstrike":
+			line(x0, y0+h, w, -h)
+		case "verticalstrike":
+			line(x0+w/2, y0, 0, h)
+		case "horizontalstrike":
+			line(x0, y0+h/2, w, 0)
+		}
+		if note == "longdiv" {
+			line(x0, y0+h, w, 0)
+		}
+	}
+	offset := pad
+	if pad > 0 {
+		offset += thickness
+	}
+	b.add(inner, offset, 0)
+	b.attach = offset + inner.attach
+	return b
+}
+
+// table lays out an <mtable>, centering it on the axis.
+func (l *layout) table(n *treeblood.MMLNode, s style) *box {
+	cellStyle := style{display: n.Attrib["displaystyle"] == "true", level: s.level}
+	type cell struct {
+		b           *box
+		align       string
+		left, right float64
+	}
+	var rows [][]cell
+	columns := 0
+	em := l.em(s)
+	xHeight := l.constant(s, accentBaseHeight)
+	tableAlign := strings.Fields(n.Attrib["columnalign"])
+	for _, tr := range n.Children {
+		if tr.Tag != "mtr" && tr.Tag != "mlabeledtr" {
+			continue
+		}
+		tds := tr.Children
+		if tr.Tag == "mlabeledtr" && len(tds) > 0 {
+			// the label is omitted, as there is nowhere to put it
+			tds = tds[1:]
+		}
+		var row []cell
+		for j, td := range tds {
+			c := cell{b: l.node(td, cellStyle), align: "center", left: 0.4 * em, right: 0.4 * em}
+			if len(tableAlign) > 0 {
+				c.align = tableAlign[min(j, len(tableAlign)-1)]
+			}
+			if a := td.Attrib["columnalign"]; a != "" {
+				c.align = a
+			} else if a := cssProperty(td, "text-align"); a != "" {
+				c.align = a
+			}
+			if p, ok := l.length(cssProperty(td, "padding-left"), s, nil, 0); ok {
+				c.left = p
+			}
+			if p, ok := l.length(cssProperty(td, "padding-right"), s, nil, 0); ok {
+				c.right = p
+			}
+			row = append(row, c)
+		}
+		rows = append(rows, row)
+		columns = max(columns, len(row))
+	}
+	widths := make([]float64, columns)
+	for _, row := range rows {
+		for j, c := range row {
+			widths[j] = max(widths[j], c.left+c.b.width+c.right)
+		}
+	}
+	heights, depths := make([]float64, len(rows)), make([]float64, len(rows))
+	total := 0.0
+	for i, row := range rows {
+		heights[i], depths[i] = 0.5*xHeight, 0.5*xHeight
+		for _, c := range row {
+			heights[i] = max(heights[i], c.b.height+0.5*xHeight)
+			depths[i] = max(depths[i], c.b.depth+0.5*xHeight)
+		}
+		total += heights[i] + depths[i]
+	}
+	b := &box{}
+	for _, w := range widths {
+		b.width += w
+	}
+	top := l.constant(s, axisHeight) + total/2
+	b.height, b.depth = top, total-top
+	y := top
+	var rowEdges []float64
+	for i, row := range rows {
+		y -= heights[i]
+		x := 0.0
+		for j, c := range row {
+			inner := widths[j] - c.left - c.right
+			offset := (inner - c.b.width) / 2
+			switch c.align {
+			case "left", "start":
+				offset = 0
+			case "right", "end":
+				offset = inner - c.b.width
+			}
+			b.add(c.b, x+c.left+offset, y)
+			x += widths[j]
+		}
+		y -= depths[i]
+		if i < len(rows)-1 {
+			rowEdges = append(rowEdges, y)
+		}
+	}
+	thickness := l.constant(s, fractionRuleThickness)
+	lines := func(attr string, count int, draw func(i int)) {
+		values := strings.Fields(attr)
+		for i := range count {
+			if len(values) > 0 && values[min(i, len(values)-1)] != "none" {
+				draw(i)
+			}
+		}
+	}
+	x := 0.0
+	lines(n.Attrib["columnlines"], columns-1, func(j int) {
+		x = 0
+		for _, w := range widths[:j+1] {
+			x += w
+		}
+		b.items = append(b.items, item{kind: itemRect, x: x - thickness/2, y: -b.depth, w: thickness, h: total})
+	})
+	lines(n.Attrib["rowlines"], len(rowEdges), func(i int) {
+		b.items = append(b.items, item{kind: itemRect, y: rowEdges[i] - thickness/2, w: b.width, h: thickness})
+	})
+	if f := n.Attrib["frame"]; f != "" && f != "none" {
+		b.items = append(b.items, item{kind: itemFrame, x: thickness / 2, y: thickness/2 - b.depth, w: b.width - thickness, h: total - thickness, scale: thickness})
+	}
+	b.attach = b.width / 2
+	return b
+}
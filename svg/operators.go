@@ -0,0 +1,131 @@
+package svg
+
+import (
+	"strings"
+	"unicode"
+)
+
+// The spacing classes of operators, following TeX. Operators of other classes, such as fences, have no space around
+// them.
+type opClass int
+
+const (
+	opOrdinary opClass = iota
+	opBinary
+	opRelation
+	opPunctuation
+	opLarge
+)
+
+var (
+	binaryOps = "+-−±∓×÷·⋅∗∘∙•∩∪⊎⊓⊔∧∨⊕⊖⊗⊘⊙⊚⊛⊞⊟⊠⊡∖⋄⋆★†‡≀⊺⊻⊼⊽⋎⋏⋒⋓⨿⨯⋉⋊⋋⋌*"
+	relations = "=<>≤≥≦≧≠≡≢≈≉∼≁≃≄≅≇≍≎≏≐≑≒≓≔≕≖≗≜≝≟∝∈∉∊∋∌∍⊂⊃⊄⊅⊆⊇⊈⊉⊊⊋⊏⊐⊑⊒≺≻≼≽≾≿⊀⊁⪯⪰⪕⪖≪≫⋘⋙≲≳≶≷∣∤∥∦⊥⊢⊣⊤⊨⊩⊪⊫⊬⊭⋈⋐⋑⋖⋗⋚⋛⋜⋝⋞⋟⋠⋡⋢⋣⋤⋥⋦⋧⋨⋩⋪⋫⋬⋭⩽⩾⪅⪆⪇⪈⪉⪊⪋⪌:∷≙≚≛≞∺∻∾≊≋≌"
+)
+
+// operatorClass returns the spacing class of an operator with the given text.
+func operatorClass(text string) opClass {
+	r := []rune(text)
+	if len(r) != 1 {
+		return opOrdinary
+	}
+	switch {
+	case strings.ContainsRune(binaryOps, r[0]):
+		return opBinary
+	case strings.ContainsRune(relations, r[0]),
+		r[0] >= 0x2190 && r[0] <= 0x21ff, // Arrows
+		r[0] >= 0x27f0 && r[0] <= 0x27ff, // Supplemental Arrows-A
+		r[0] >= 0x2900 && r[0] <= 0x297f: // Supplemental Arrows-B
+		return opRelation
+	case r[0] == ',' || r[0] == ';':
+		return opPunctuation
+	}
+	return opOrdinary
+}
+
+// accentMarks maps the spacing characters that TreeBlood uses for accents to the combining marks of the font, which
+// are positioned for accents and can be stretched.
+var accentMarks = map[rune]rune{
+	'`':    0x0300,
+	'´':    0x0301,
+	'^':    0x0302,
+	'~':    0x0303,
+	'¯':    0x0304,
+	'‾':    0x0305,
+	'˘':    0x0306,
+	'˙':    0x0307,
+	'¨':    0x0308,
+	'˚':    0x030a,
+	'ˇ':    0x030c,
+	0x0360: 0x0303,
+	'_':    0x0332,
+}
+
+// isCombining reports whether r is a combining mark, which is drawn over or under the preceding character rather than
+// after it.
+func isCombining(r rune) bool {
+	return unicode.Is(unicode.Mn, r)
+}
+
+// The offsets of the styled letters and digits in the Mathematical Alphanumeric Symbols block, for each mathvariant
+// that has them: capital Latin, small Latin, capital Greek, small Greek, and digits. Zero means the variant has no
+// such characters.
+var alphanumerics = map[string][5]rune{
+	"bold":                   {0x1d400, 0x1d41a, 0x1d6a8, 0x1d6c2, 0x1d7ce},
+	"italic":                 {0x1d434, 0x1d44e, 0x1d6e2, 0x1d6fc, 0},
+	"bold-italic":            {0x1d468, 0x1d482, 0x1d71c, 0x1d736, 0},
+	"script":                 {0x1d49c, 0x1d4b6, 0, 0, 0},
+	"bold-script":            {0x1d4d0, 0x1d4ea, 0, 0, 0},
+	"fraktur":                {0x1d504, 0x1d51e, 0, 0, 0},
+	"double-struck":          {0x1d538, 0x1d552, 0, 0, 0x1d7d8},
+	"bold-fraktur":           {0x1d56c, 0x1d586, 0, 0, 0},
+	"sans-serif":             {0x1d5a0, 0x1d5ba, 0, 0, 0x1d7e2},
+	"bold-sans-serif":        {0x1d5d4, 0x1d5ee, 0x1d756, 0x1d770, 0x1d7ec},
+	"sans-serif-italic":      {0x1d608, 0x1d622, 0, 0, 0},
+	"sans-serif-bold-italic": {0x1d63c, 0x1d656, 0x1d790, 0x1d7aa, 0},
+	"monospace":              {0x1d670, 0x1d68a, 0, 0, 0x1d7f6},
+}
+
+// Letters of the variants that were encoded in the Letterlike Symbols block before the Mathematical Alphanumeric
+// Symbols, and so are missing from it.
+var letterlike = map[rune]rune{
+	0x1d455: 'ℎ', 0x1d49d: 'ℬ', 0x1d4a0: 'ℰ', 0x1d4a1: 'ℱ', 0x1d4a3: 'ℋ', 0x1d4a4: 'ℐ', 0x1d4a7: 'ℒ', 0x1d4a8: 'ℳ',
+	0x1d4ad: 'ℛ', 0x1d4ba: 'ℯ', 0x1d4bc: 'ℊ', 0x1d4c4: 'ℴ', 0x1d506: 'ℭ', 0x1d50b: 'ℌ', 0x1d50c: 'ℑ', 0x1d515: 'ℜ',
+	0x1d51d: 'ℨ', 0x1d53a: 'ℂ', 0x1d53f: 'ℍ', 0x1d545: 'ℕ', 0x1d547: 'ℙ', 0x1d548: 'ℚ', 0x1d549: 'ℝ', 0x1d551: 'ℤ',
+}
+
+// The positions of the Greek symbols that follow the small letters in the Mathematical Alphanumeric Symbols block,
+// counting from α.
+var greekExtras = map[rune]rune{'∂': 25, 'ϵ': 26, 'ϑ': 27, 'ϰ': 28, 'ϕ': 29, 'ϱ': 30, 'ϖ': 31}
+
+// mathVariant returns the character for r in the given mathvariant, or r itself if there is none.
+func mathVariant(r rune, variant string) rune {
+	offsets, ok := alphanumerics[variant]
+	if !ok {
+		return r
+	}
+	var styled rune
+	switch {
+	case r >= 'A' && r <= 'Z' && offsets[0] != 0:
+		styled = offsets[0] + r - 'A'
+	case r >= 'a' && r <= 'z' && offsets[1] != 0:
+		styled = offsets[1] + r - 'a'
+	case r >= 'Α' && r <= 'Ω' && offsets[2] != 0:
+		styled = offsets[2] + r - 'Α'
+	case r >= 'α' && r <= 'ω' && offsets[3] != 0:
+		styled = offsets[3] + r - 'α'
+	case greekExtras[r] != 0 && offsets[3] != 0:
+		styled = offsets[3] + greekExtras[r]
+	case r >= '0' && r <= '9' && offsets[4] != 0:
+		styled = offsets[4] + r - '0'
+	case r == 'ı' && variant == "italic":
+		return 0x1d6a4
+	case r == 'ȷ' && variant == "italic":
+		return 0x1d6a5
+	default:
+		return r
+	}
+	if l, ok := letterlike[styled]; ok {
+		return l
+	}
+	return styled
+}
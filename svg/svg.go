@@ -0,0 +1,137 @@
+// Package svg draws the MathML produced by TreeBlood as standalone SVG images, for readers that cannot display MathML,
+// such as many RSS readers, older e-readers and email clients. Equations are laid out following TeX and MathML Core,
+// using the metrics, outlines and OpenType MATH table of Latin Modern Math, which is embedded in the package. Every
+// character is drawn as a path, so the images need no fonts to display.
+//
+// Importing this package adds about half a megabyte to a program for the font; programs that only produce MathML do
+// not pay for it.
+package svg
+
+import (
+	"errors"
+	"html"
+	"math"
+	"strings"
+
+	"github.com/wyatt915/treeblood"
+)
+
+// Render lays out the MathML tree rooted at n, usually a <math> element such as one read with treeblood.ParseMathML,
+// and returns it as an <svg> element. A <math> element with display="block" is laid out in display style. The image
+// is sized in ems, so that it matches the size of the surrounding text, and has a spoken description of the equation
+// as its aria-label. Inline equations are lowered with vertical-align so that their baselines line up with the text
+// when the SVG is placed directly in an HTML document.
+func Render(n *treeblood.MMLNode) (string, error) {
+	if n == nil {
+		return "", errors.New("svg: no MathML to render")
+	}
+	f, err := defaultFont()
+	if err != nil {
+		return "", err
+	}
+	display := n.Attrib["display"] == "block" || n.Attrib["displaystyle"] == "true"
+	b := newLayout(f).node(n, style{display: display})
+	var sb strings.Builder
+	writeSVG(&sb, f, b, display, n.Speech())
+	return sb.String(), nil
+}
+
+// RenderTeX renders tex as an SVG image, using the macros and settings of pitz. See Render. Like Speech, RenderTeX
+// does not number equations or add the macros defined in tex to the document, so an equation may be drawn as an
+// image in addition to being rendered as MathML.
+func RenderTeX(pitz *treeblood.Pitziil, tex string, display bool) (string, error) {
+	n, err := pitz.AST(tex, display)
+	if err != nil {
+		return "", err
+	}
+	return Render(n)
+}
+
+// extent returns the bounds of the ink of it.
+func (f *font) extent(it item) (left, right, bottom, top float64) {
+	switch it.kind {
+	case itemGlyph:
+		m := f.metrics[it.glyph]
+		return it.x + m.xMin*it.scale, it.x + m.xMax*it.scale, it.y + m.yMin*it.scale, it.y + m.yMax*it.scale
+	case itemLine, itemFrame:
+		t := it.scale / 2
+		return it.x + min(0, it.w) - t, it.x + max(0, it.w) + t, it.y + min(0, it.h) - t, it.y + max(0, it.h) + t
+	default:
+		return it.x, it.x + it.w, it.y, it.y + it.h
+	}
+}
+
+// writeSVG writes the <svg> element for the box b.
+func writeSVG(sb *strings.Builder, f *font, b *box, display bool, label string) {
+	// the image covers the box and any ink that strays outside it, such as the overhang of an italic letter
+	left, right, bottom, top := 0.0, b.width, -b.depth, b.height
+	for _, it := range b.items {
+		l, r, btm, t := f.extent(it)
+		left, right, bottom, top = min(left, l), max(right, r), min(bottom, btm), max(top, t)
+	}
+	left, right = math.Floor(left), math.Ceil(right)
+	bottom, top = math.Floor(bottom), math.Ceil(top)
+	em := func(v float64) string {
+		return formatNumber(math.Round(v/f.unitsPerEm*1000)/1000) + "em"
+	}
+	sb.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="` + em(right-left) + `" height="` + em(top-bottom))
+	sb.WriteString(`" viewBox="` + formatNumber(left) + " " + formatNumber(-top) + " " + formatNumber(right-left) + " " + formatNumber(top-bottom))
+	if display {
+		sb.WriteString(`" style="display: block; margin: 0 auto;`)
+	} else {
+		sb.WriteString(`" style="vertical-align: ` + em(bottom) + `;`)
+	}
+	sb.WriteString(`" fill="currentColor" role="img"`)
+	if label != "" {
+		sb.WriteString(` aria-label="` + html.EscapeString(label) + `"`)
+	}
+	sb.WriteString(">")
+	for _, it := range b.items {
+		switch it.kind {
+		case itemGlyph:
+			path := f.path(it.glyph)
+			if path == "" {
+				continue
+			}
+			sb.WriteString(`<path d="` + path + `" transform="translate(` + formatNumber(it.x) + " " + formatNumber(-it.y) + ")")
+			if it.scale != 1 {
+				sb.WriteString(" scale(" + formatNumber(math.Round(it.scale*1000)/1000) + ")")
+			}
+			sb.WriteByte('"')
+			writeColor(sb, "fill", it.color)
+		case itemRect:
+			sb.WriteString(`<rect x="` + formatNumber(it.x) + `" y="` + formatNumber(-it.y-it.h) + `" width="` + formatNumber(it.w) + `" height="` + formatNumber(it.h) + `"`)
+			writeColor(sb, "fill", it.color)
+		case itemLine:
+			sb.WriteString(`<line x1="` + formatNumber(it.x) + `" y1="` + formatNumber(-it.y) + `" x2="` + formatNumber(it.x+it.w) + `" y2="` + formatNumber(-it.y-it.h) + `"`)
+			writeStroke(sb, it)
+		case itemFrame:
+			if math.IsInf(it.radius, 1) {
+				sb.WriteString(`<ellipse cx="` + formatNumber(it.x+it.w/2) + `" cy="` + formatNumber(-it.y-it.h/2) + `" rx="` + formatNumber(it.w/2) + `" ry="` + formatNumber(it.h/2) + `" fill="none"`)
+			} else {
+				sb.WriteString(`<rect x="` + formatNumber(it.x) + `" y="` + formatNumber(-it.y-it.h) + `" width="` + formatNumber(it.w) + `" height="` + formatNumber(it.h) + `" fill="none"`)
+				if it.radius > 0 {
+					sb.WriteString(` rx="` + formatNumber(it.radius) + `"`)
+				}
+			}
+			writeStroke(sb, it)
+		}
+		sb.WriteString("/>")
+	}
+	sb.WriteString("</svg>")
+}
+
+func writeColor(sb *strings.Builder, attr, color string) {
+	if color != "" {
+		sb.WriteString(" " + attr + `="` + html.EscapeString(color) + `"`)
+	}
+}
+
+func writeStroke(sb *strings.Builder, it item) {
+	color := it.color
+	if color == "" {
+		color = "currentColor"
+	}
+	writeColor(sb, "stroke", color)
+	sb.WriteString(` stroke-width="` + formatNumber(it.scale) + `"`)
+}
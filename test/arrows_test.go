@@ -0,0 +1,35 @@
+package treeblood_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestExtensibleArrows(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.PrintOneLine = true
+	tests := []struct {
+		tex  string
+		want []string
+	}{
+		{`\xrightarrow{f}`, []string{`<mover accent="false"><mo stretchy="true">→</mo><mrow><mspace width="0.2778em"></mspace><mi>f</mi><mspace width="0.5em"></mspace></mrow></mover>`}},
+		{`\xleftarrow[g]{f}`, []string{`<munderover accent="false" accentunder="false"><mo stretchy="true">←</mo><mrow><mspace width="0.5em"></mspace><mi>g</mi><mspace width="0.2778em"></mspace></mrow><mrow><mspace width="0.5em"></mspace><mi>f</mi><mspace width="0.2778em"></mspace></mrow></munderover>`}},
+		{`\xleftrightarrow{}`, []string{`<mo stretchy="true">↔</mo><mrow><mspace width="0.5em"></mspace><mspace width="0.5em"></mspace></mrow>`}},
+		{`\xRightarrow{n \to \infty}`, []string{`<mo stretchy="true">⇒</mo>`, `<mo>→</mo><mi>∞</mi>`}},
+		{`\xmapsto{x}`, []string{`<mo stretchy="true">↦</mo>`}},
+		{`\xhookrightarrow[\text{inc}]{}`, []string{`<munderover accent="false" accentunder="false"><mo stretchy="true">↪</mo><mrow><mspace width="0.2778em"></mspace><mtext>inc</mtext>`}},
+	}
+	for _, tt := range tests {
+		res, err := pitz.TextStyle(tt.tex)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(res, want) {
+				t.Errorf("%s: expected %s in output\n%s", tt.tex, want, res)
+			}
+		}
+	}
+}
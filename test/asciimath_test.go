@@ -0,0 +1,48 @@
+package treeblood_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestAsciiMath(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.PrintOneLine = true
+	escaper := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	annotations := regexp.MustCompile(`(?s)<annotation encoding="[^"]*">.*?</annotation>`)
+	tests := []struct {
+		ascii, tex string
+	}{
+		{`sum_(i=1)^n i^3=((n(n+1))/2)^2`, `\sum_{i=1}^{n} i^{3} = \left(\frac{n\left(n+1\right)}{2}\right)^{2}`},
+		{`x = (-b +- sqrt(b^2-4ac))/(2a)`, `x = \frac{-b \pm \sqrt{b^{2}-4ac}}{2a}`},
+		{`[[a,b],[c,d]]`, `\left[\begin{matrix} a & b \\ c & d \end{matrix}\right]`},
+		{`|x| + abs(y) + floor(z/2)`, `\left|x\right| + \left|y\right| + \left\lfloor \frac{z}{2} \right\rfloor`},
+		{`f(x) = {(x, if x >= 0),(-x, "otherwise"):}`, `f\left(x\right) = \left\{\begin{matrix} x & \text{ if } x \geq 0 \\ -x & \text{otherwise}\end{matrix}\right.`},
+		{`int_0^oo e^(-x^2) dx = sqrt(pi)/2`, `\int_{0}^{\infty} e^{-x^{2}} {dx} = \frac{\sqrt{\pi}}{2}`},
+		{`dy/dx = (dz)/dt`, `\frac{{dy}}{{dx}} = \frac{{dz}}{{dt}}`},
+		{`x + hat`, `x + \hat{\phantom{}}`},
+		{`ul`, `\underline{\phantom{}}`},
+		{`lim_(x->0) sin x/x = 1`, `\lim_{x \to 0} \frac{\sin x}{x} = 1`},
+		{`root(3)(x) + hat(x) + bb(v) + text(a b) + alpha xx beta`, `\sqrt[3]{x} + \hat{x} + \mathbf{v} + \text{a b} + \alpha \times \beta`},
+		{`AA x in RR, EE y: x <= y`, `\forall x \in \mathbb{R}, \exists y: x \leq y`},
+	}
+	for _, tt := range tests {
+		got, err := pitz.AsciiMath(tt.ascii, true)
+		if err != nil {
+			t.Errorf("%s: %s", tt.ascii, err.Error())
+		}
+		if strings.Contains(got, "merror") {
+			t.Errorf("%s: unexpected error in output\n%s", tt.ascii, got)
+		}
+		if !strings.Contains(got, `<annotation encoding="text/x-asciimath">`+escaper.Replace(tt.ascii)+`</annotation>`) {
+			t.Errorf("%s: expected the AsciiMath source in an annotation\n%s", tt.ascii, got)
+		}
+		want, _ := pitz.DisplayStyle(tt.tex)
+		if annotations.ReplaceAllString(got, "") != annotations.ReplaceAllString(want, "") {
+			t.Errorf("%s: expected the same MathML as %s\n%s\n%s", tt.ascii, tt.tex, want, got)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package treeblood_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestBoxesAndPhantoms(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.PrintOneLine = true
+	tests := []struct {
+		tex  string
+		want []string
+	}{
+		{`\boxed{x^2}`, []string{`<menclose notation="box"><msup><mi>x</mi><mn>2</mn></msup></menclose>`}},
+		{`\fbox{a $b$}`, []string{`<menclose notation="box"><mtext>a&nbsp;</mtext><mrow><mi>b</mi></mrow></menclose>`}},
+		{`\colorbox{yellow}{a}`, []string{`<mpadded depth="+0.3em" height="+0.3em" lspace="0.3em" mathbackground="yellow" width="+0.6em"><mtext>a</mtext></mpadded>`}},
+		{`\fcolorbox{red}{yellow}{a}`, []string{`<menclose mathbackground="yellow" notation="box" style="border-color:red;"><mtext>a</mtext></menclose>`}},
+		{`\phantom{x}`, []string{`<mphantom><mi>x</mi></mphantom>`}},
+		{`\hphantom{x}`, []string{`<mpadded depth="0" height="0"><mphantom><mi>x</mi></mphantom></mpadded>`}},
+		{`\vphantom{x}`, []string{`<mpadded width="0"><mphantom><mi>x</mi></mphantom></mpadded>`}},
+		{`\smash{x}`, []string{`<mpadded depth="0" height="0"><mi>x</mi></mpadded>`}},
+		{`\smash[t]{x}`, []string{`<mpadded height="0"><mi>x</mi></mpadded>`}},
+		{`\smash[b]{x}`, []string{`<mpadded depth="0"><mi>x</mi></mpadded>`}},
+		{`\colorbox{#FF0}{a}`, []string{`mathbackground="#FF0"`}},
+		{`\fcolorbox{#ff000080}{yellow}{a}`, []string{`style="border-color:#ff000080;"`}},
+		{`\mathllap{x}`, []string{`<mpadded width="0"><mrow style="transform:translateX(-100%);"><mi>x</mi></mrow></mpadded>`}},
+		{`\mathrlap{x}`, []string{`<mpadded width="0"><mi>x</mi></mpadded>`}},
+		{`\mathclap{x}`, []string{`<mpadded width="0"><mrow style="transform:translateX(-50%);"><mi>x</mi></mrow></mpadded>`}},
+	}
+	for _, tt := range tests {
+		res, err := pitz.TextStyle(tt.tex)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(res, want) {
+				t.Errorf("%s: expected %s in output\n%s", tt.tex, want, res)
+			}
+		}
+	}
+}
+
+func TestColors(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.PrintOneLine = true
+	// every color command accepts the same colors
+	commands := []struct {
+		tex, attr string
+	}{
+		{`\textcolor{%s}{a}`, `mathcolor="%s"`},
+		{`{\color{%s} a}`, `mathcolor="%s"`},
+		{`\colorbox{%s}{a}`, `mathbackground="%s"`},
+		{`\fcolorbox{%s}{%[1]s}{a}`, `style="border-color:%s;"`},
+	}
+	good := []string{`red`, `DarkBlue`, `#FF0`, `#1e90ff`, `#ff000080`, `rgb(1,0,0)`, `rgba(255, 0, 0, 0.5)`}
+	bad := []string{`red;background:url(//evil)`, `#12`, `red" onclick="f()`, ``, `url(x)`}
+	for _, cmd := range commands {
+		for _, c := range good {
+			tex := fmt.Sprintf(cmd.tex, c)
+			res, err := pitz.Render(tex, false)
+			if err != nil {
+				t.Errorf("%s: %s", tex, err.Error())
+			}
+			if want := fmt.Sprintf(cmd.attr, c); !strings.Contains(res.MathML, want) || len(res.Diagnostics) > 0 {
+				t.Errorf("%s: expected %s in output\n%s", tex, want, res.MathML)
+			}
+		}
+		for _, c := range bad {
+			tex := fmt.Sprintf(cmd.tex, c)
+			res, err := pitz.Render(tex, false)
+			if err != nil {
+				t.Errorf("%s: %s", tex, err.Error())
+			}
+			if !strings.Contains(res.MathML, "<merror") || strings.Contains(res.MathML, "mathcolor") || strings.Contains(res.MathML, "mathbackground") || strings.Contains(res.MathML, "border-color") {
+				t.Errorf("%s: expected an error in place of the color\n%s", tex, res.MathML)
+			}
+			if len(res.Diagnostics) != 1 || res.Diagnostics[0].Code != treeblood.DiagArgument {
+				t.Errorf("%s: expected one argument diagnostic, got %v", tex, res.Diagnostics)
+			}
+		}
+	}
+}
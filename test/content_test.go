@@ -0,0 +1,46 @@
+package treeblood_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestContentMathML(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.PrintOneLine = true
+	pitz.ContentMathML = true
+	tests := []struct {
+		tex  string
+		want []string
+	}{
+		{`x = 1 + 2y`, []string{`<annotation-xml encoding="MathML-Content"><apply><eq></eq><ci>x</ci><apply><plus></plus><cn>1</cn><apply><times></times><cn>2</cn><ci>y</ci></apply></apply></apply></annotation-xml>`}},
+		{`\frac{a}{b^2}`, []string{`<apply><divide></divide><ci>a</ci><apply><power></power><ci>b</ci><cn>2</cn></apply></apply>`}},
+		{`\sum_{i=1}^n i^2`, []string{`<apply><sum></sum><bvar><ci>i</ci></bvar><lowlimit><cn>1</cn></lowlimit><uplimit><ci>n</ci></uplimit>`}},
+		{`\int_0^1 f(x)\,dx`, []string{`<apply><int></int><bvar><ci>x</ci></bvar><lowlimit><cn>0</cn></lowlimit><uplimit><cn>1</cn></uplimit><apply><csymbol>juxtaposition</csymbol><ci>f</ci><ci>x</ci></apply></apply>`}},
+		{`\sum_i x_i`, []string{`<apply><sum></sum><bvar><ci>i</ci></bvar><ci><msub><mi>x</mi><mi>i</mi></msub></ci></apply>`}},
+		{"f\u2061(x) + \\sin\u2061x", []string{`<apply><plus></plus><apply><ci>f</ci><ci>x</ci></apply><apply><sin></sin><ci>x</ci></apply></apply>`}},
+		{`a(b+c) + 2(x+1)`, []string{`<apply><csymbol>juxtaposition</csymbol><ci>a</ci>`, `<apply><times></times><cn>2</cn>`}},
+		{`\sin x + |y|`, []string{`<apply><sin></sin><ci>x</ci></apply>`, `<apply><abs></abs><ci>y</ci></apply>`}},
+		{`\sqrt[3]{x}`, []string{`<apply><root></root><degree><cn>3</cn></degree><ci>x</ci></apply>`}},
+		{`f'(x) + g''(y)`, []string{`<apply><apply><diff></diff><ci>f</ci></apply><ci>x</ci></apply>`, `<apply><diff></diff><apply><diff></diff><ci>g</ci></apply></apply>`}},
+		{`|x| = \begin{cases} x & x \geq 0 \\ -x & \text{otherwise} \end{cases}`, []string{`<piecewise><piece><ci>x</ci><apply><geq></geq><ci>x</ci><cn>0</cn></apply></piece><otherwise><apply><minus></minus><ci>x</ci></apply></otherwise></piecewise>`}},
+		{`\begin{pmatrix} a & b \\ c & d \end{pmatrix}`, []string{`<matrix><matrixrow><ci>a</ci><ci>b</ci></matrixrow>`}},
+		{`x \pm 1`, []string{`<csymbol>±</csymbol>`}},
+	}
+	for _, tt := range tests {
+		res, err := pitz.DisplayStyle(tt.tex)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(res, want) {
+				t.Errorf("%s: expected %s in output\n%s", tt.tex, want, res)
+			}
+		}
+		if i, j := strings.Index(res, "MathML-Content"), strings.Index(res, "application/x-tex"); i < 0 || j < i {
+			t.Errorf("%s: expected Content MathML annotation before the TeX annotation\n%s", tt.tex, res)
+		}
+	}
+}
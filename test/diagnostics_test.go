@@ -0,0 +1,72 @@
+package treeblood_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestDiagnostics(t *testing.T) {
+	doc := treeblood.NewDocument(map[string]string{"half": `\frac{1}{2}\foo`}, true)
+	tests := []struct {
+		tex      string
+		severity treeblood.Severity
+		code     string
+		span     string // the source text covered by the diagnostic
+	}{
+		{`a + \foo{b}`, treeblood.SeverityError, treeblood.DiagUnknownCommand, `\foo`},
+		{`x + \frac{a}`, treeblood.SeverityError, treeblood.DiagArgument, `\frac`},
+		{`x = \half`, treeblood.SeverityError, treeblood.DiagUnknownCommand, `\half`},
+		{`x + \frac{a}{b`, treeblood.SeverityError, treeblood.DiagSyntax, `{`},
+		{`[0, 1)`, treeblood.SeverityNote, treeblood.DiagDelimiter, `)`},
+		{`\eqref{nope}`, treeblood.SeverityWarning, treeblood.DiagLabel, `\eqref`},
+		{`\begin{align} a &= b \label{twice} \\ c &= d \label{twice} \end{align}`, treeblood.SeverityWarning, treeblood.DiagLabel, `\label`},
+		{`\begin{alignat}{x} a &= b \end{alignat}`, treeblood.SeverityWarning, treeblood.DiagEnvironment, `\begin`},
+		{`\newcommand{\x}{y} \newcommand{\x}{z}`, treeblood.SeverityWarning, treeblood.DiagMacro, `\x`},
+		{`\DeclareMathOperator{\op}{y} \DeclareMathOperator{\op}{z}`, treeblood.SeverityWarning, treeblood.DiagMacro, `\op`},
+	}
+	for _, tt := range tests {
+		res, _ := doc.Render(tt.tex, true)
+		if len(res.Diagnostics) != 1 {
+			t.Errorf("%s: expected one diagnostic, got %v", tt.tex, res.Diagnostics)
+			continue
+		}
+		d := res.Diagnostics[0]
+		if d.Severity != tt.severity || d.Code != tt.code {
+			t.Errorf("%s: expected %s[%s], got %s", tt.tex, tt.severity, tt.code, d)
+		}
+		if span := string([]rune(tt.tex)[d.Start:d.End]); span != tt.span {
+			t.Errorf("%s: expected diagnostic at %q, got %q", tt.tex, tt.span, span)
+		}
+	}
+	if res, _ := doc.Render(`\frac{a}{b} + c`, false); len(res.Diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics %v", res.Diagnostics)
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	doc := treeblood.NewDocument(map[string]string{"loop": `\loop`}, false)
+	if d := doc.MacroDiagnostics(); len(d) != 1 || d[0].Code != treeblood.DiagMacro {
+		t.Errorf("expected a diagnostic for the recursive macro, got %v", d)
+	}
+	doc.LogHandler = slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})
+	doc.DisplayStyle(`a + \foo{b} + [0, 1)`)
+	log := buf.String()
+	for _, want := range []string{`level=ERROR`, `msg="unknown command 'foo'"`, `code=unknown-command`, `start=4`, `end=8`} {
+		if !strings.Contains(log, want) {
+			t.Errorf("expected %s in log:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "delimiter") {
+		t.Errorf("notes should not be logged at level WARN:\n%s", log)
+	}
+	buf.Reset()
+	doc.TextStyle(`\eqref{nowhere}`)
+	if log := buf.String(); !strings.Contains(log, `msg="unresolved reference: nowhere"`) || !strings.Contains(log, `code=label`) {
+		t.Errorf("expected the unresolved reference in log:\n%s", log)
+	}
+}
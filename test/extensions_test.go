@@ -0,0 +1,105 @@
+package treeblood_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+// \pair{a}{b}... renders every grouped argument separated by semicolons inside angle brackets
+func pairExtension(n *treeblood.MMLNode, ctx treeblood.ExtContext, args []treeblood.CmdArg) error {
+	n.AppendNew("mo", "⟨")
+	for i, arg := range args {
+		if i > 0 {
+			n.AppendNew("mo", ";")
+		}
+		n.AppendChild(ctx.Parse(arg.Value))
+	}
+	n.AppendNew("mo", "⟩")
+	return nil
+}
+
+func TestExtensionPatterns(t *testing.T) {
+	doc := treeblood.NewPitziil()
+	doc.PrintOneLine = true
+	err := doc.RegisterExtension([]string{"pair"}, pairExtension, []treeblood.CmdArgExpr{"{}+"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = doc.RegisterExtension([]string{`\opts`}, func(n *treeblood.MMLNode, ctx treeblood.ExtContext, args []treeblood.CmdArg) error {
+		if len(args) == 0 || args[0].Flavor&treeblood.CF_OPTION == 0 {
+			return errors.New("missing options")
+		}
+		for _, item := range args[0].Items {
+			n.AppendNew("mi", treeblood.StringifyTokens(item))
+		}
+		if len(args) > 1 && args[1].Flavor&treeblood.CF_LITERAL > 0 {
+			n.AppendNew("mo", "→")
+		}
+		if ctx.Star() {
+			n.AppendNew("mo", "*")
+		}
+		return nil
+	}, []treeblood.CmdArgExpr{"[,]? '\\to'?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []TexTest{
+		{`\pair{a}{b}{c}`, `<mrow><mo>⟨</mo><mi>a</mi><mo>;</mo><mi>b</mi><mo>;</mo><mi>c</mi><mo>⟩</mo></mrow>`},
+		{`\pair{a} + c`, `<mrow><mrow><mo>⟨</mo><mi>a</mi><mo>⟩</mo></mrow><mo>+</mo><mi>c</mi></mrow>`},
+		{`\opts[x, y,z]\to`, `<mrow><mi>x</mi><mi>y</mi><mi>z</mi><mo>→</mo></mrow>`},
+		{`\opts*[x]`, `<mrow><mi>x</mi><mo>*</mo></mrow>`},
+		{`\opts{x}`, `<mrow><merror title="missing options">opts</merror><mi>x</mi></mrow>`},
+		{`\pair`, `<mrow><merror title="pair: arguments do not match any accepted pattern">pair</merror></mrow>`},
+	}
+	for _, tt := range tests {
+		res, err := doc.SemanticsOnly(tt.Tex)
+		if err != nil {
+			t.Errorf("%s: %s", tt.Tex, err.Error())
+			continue
+		}
+		if err = compareXML(res, tt.MML); err != nil {
+			t.Errorf("%s produced incorrect output (%s):\n%s\n", tt.Tex, err.Error(), res)
+		}
+	}
+	// extensions registered on one Pitziil must not leak into another
+	other := treeblood.NewPitziil()
+	if res, _ := other.SemanticsOnly(`\pair{a}{b}`); !strings.Contains(res, "merror") {
+		t.Errorf("extension leaked between documents: %s", res)
+	}
+}
+
+func TestExtensionContext(t *testing.T) {
+	var display bool
+	var variant string
+	var level int
+	doc := treeblood.NewPitziil()
+	err := doc.RegisterExtension([]string{"probe"}, func(n *treeblood.MMLNode, ctx treeblood.ExtContext, args []treeblood.CmdArg) error {
+		display, variant, level = ctx.Display(), ctx.MathVariant(), ctx.ScriptLevel()
+		n.Tag = "mi"
+		n.Text = ctx.Command()
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.DisplayStyle(`\mathbf{\probe}`)
+	if !display || variant != "bold" || level != 0 {
+		t.Errorf("got display=%v variant=%q level=%d", display, variant, level)
+	}
+	doc.TextStyle(`\scriptstyle \probe`)
+	if display || variant != "" || level != 1 {
+		t.Errorf("got display=%v variant=%q level=%d", display, variant, level)
+	}
+}
+
+func TestExtensionBadPattern(t *testing.T) {
+	for _, pattern := range []treeblood.CmdArgExpr{"{", "[,}", "''", "'/", "x"} {
+		err := treeblood.RegisterExtension([]string{"bad"}, pairExtension, []treeblood.CmdArgExpr{pattern})
+		if !errors.Is(err, treeblood.ErrExtensionPattern) {
+			t.Errorf("pattern %q: expected ErrExtensionPattern, got %v", pattern, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package treeblood_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestHTMLOutput(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.HTMLOutput = true
+	tests := []struct {
+		tex     string
+		display bool
+		want    []string
+	}{
+		{`x^2`, false, []string{`<span class="tb-math" role="math" aria-label="`, `<span class="tb-sup tb-small">`}},
+		{`\frac{a}{b}`, false, []string{`tb-mfrac`, `tb-num`, `tb-den`}},
+		{`\sqrt{2}`, false, []string{`tb-msqrt`, `tb-surd`}},
+		{`\left( \frac{a}{b} \right)`, true, []string{`tb-math tb-block`, `tb-fenced`, `tb-fence tb-lparen`, `tb-fence tb-rparen`}},
+		{`\begin{pmatrix} a & b \\ c & d \end{pmatrix}`, true, []string{`tb-mtable`, `grid-row:2;grid-column:2;`}},
+		{`\hat{x}`, false, []string{"x̂"}},
+		{`\sum_{i=1}^n i`, true, []string{`tb-largeop tb-displayop`, `tb-under tb-small`}},
+		{`{\color{red} a} + b`, false, []string{`<span style="color:red;">`, `tb-mo tb-bin`}},
+		{`\begin{aligned} a &= b \\[1em] c &= d \end{aligned}`, true, []string{`tb-mtable`, `padding-top:calc(`}},
+		{`\sum_{\substack{0<i<m \\ 0<j<n}} a_{ij}`, true, []string{`tb-under tb-small`, `tb-mtable`}},
+		{`a \overset{*}{+} b`, false, []string{`<span class="tb-bin"><span class="tb-mover">`}},
+		{`a \stackrel{\text{def}}{=} b`, false, []string{`<span class="tb-rel"><span class="tb-mover">`}},
+	}
+	for _, tt := range tests {
+		res, err := pitz.Render(tt.tex, tt.display)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+			continue
+		}
+		if strings.Contains(res.MathML, "<math") {
+			t.Errorf("%s: expected HTML, got MathML\n%s", tt.tex, res.MathML)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(res.MathML, want) {
+				t.Errorf("%s: expected %s in output\n%s", tt.tex, want, res.MathML)
+			}
+		}
+	}
+	if !strings.Contains(treeblood.HTMLStylesheet, ".tb-mfrac") {
+		t.Errorf("stylesheet does not style fractions")
+	}
+}
+
+func TestHTMLNumbering(t *testing.T) {
+	pitz := treeblood.NewDocument(nil, true)
+	pitz.HTMLOutput = true
+	res, err := pitz.DisplayStyle(`a = b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, `<span class="tb-eqno"><span class="tb-mtext">(1)</span></span>`) {
+		t.Errorf("expected an equation number\n%s", res)
+	}
+	pitz.HTMLOutput = false
+	res, err = pitz.DisplayStyle(`a = b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, "<math") {
+		t.Errorf("expected MathML once HTMLOutput is unset\n%s", res)
+	}
+}
+
+func TestHTMLTexInputs(t *testing.T) {
+	for testname, tests := range readTestcases() {
+		pitz := treeblood.NewPitziil()
+		pitz.HTMLOutput = true
+		for i, test := range tests {
+			if _, err := pitz.DisplayStyle(test.Tex); err != nil {
+				t.Errorf("%s #%d: %s", testname, i, err.Error())
+			}
+		}
+	}
+}
+
+func TestHTMLColors(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.HTMLOutput = true
+	res, _ := pitz.TextStyle(`\textcolor{red;background:url(//evil)}{y}`)
+	if strings.Contains(res, "url(") {
+		t.Errorf("expected the color to be rejected\n%s", res)
+	}
+	// a tree that was not built by TreeBlood may hold any attribute
+	ast, err := treeblood.ParseMathML(strings.NewReader(`<math><mi mathcolor="red;background:url(//evil)" mathbackground="#ff0;position:fixed">y</mi><mi mathcolor="blue">z</mi></math>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	ast.WriteHTML(&sb)
+	if strings.Contains(sb.String(), "url(") || strings.Contains(sb.String(), "position") {
+		t.Errorf("expected invalid colors to be dropped\n%s", sb.String())
+	}
+	if !strings.Contains(sb.String(), "color:blue;") {
+		t.Errorf("expected color:blue in output\n%s", sb.String())
+	}
+}
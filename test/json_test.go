@@ -0,0 +1,77 @@
+package treeblood_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.PrintOneLine = true
+	tests := []struct {
+		tex     string
+		sameMML bool // false if the decoded tree escapes its text differently from the original
+	}{
+		{`x = \frac{-b \pm \sqrt{b^2-4ac}}{2a}`, true},
+		{`\sum_{i=1}^n i^2 \label{sum}`, true},
+		{`\textcolor{red}{x} + \mathbb{R}`, true},
+		{`a < b \text{ and } c > d`, false},
+		{`\begin{pmatrix} a & b \\ c & d \end{pmatrix}`, false},
+	}
+	for _, tt := range tests {
+		tex := tt.tex
+		var mml, js bytes.Buffer
+		if err := pitz.RenderTo(&mml, tex, true); err != nil {
+			t.Errorf("%s: %s", tex, err.Error())
+		}
+		if err := pitz.RenderJSON(&js, tex, true, true); err != nil {
+			t.Errorf("%s: %s", tex, err.Error())
+		}
+		var node treeblood.MMLNode
+		if err := json.Unmarshal(js.Bytes(), &node); err != nil {
+			t.Fatalf("%s: %s\n%s", tex, err.Error(), js.String())
+		}
+		var out strings.Builder
+		node.Write(&out, -1)
+		if got, want := out.String(), strings.TrimSpace(mml.String()); tt.sameMML && got != want {
+			t.Errorf("%s: round trip differs\n got: %s\nwant: %s", tex, got, want)
+		}
+		var again bytes.Buffer
+		if err := node.EncodeJSON(&again, true); err != nil {
+			t.Errorf("%s: %s", tex, err.Error())
+		}
+		if again.String() != js.String() {
+			t.Errorf("%s: re-encoding differs\n got: %s\nwant: %s", tex, again.String(), js.String())
+		}
+	}
+}
+
+func TestJSONSpans(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	var js bytes.Buffer
+	if err := pitz.RenderJSON(&js, `x^2 + \alpha`, false, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`{"tag":"msup","children":[{"tag":"mi","text":"x","span":[0,1]},{"tag":"mn","text":"2","span":[2,3]}],"span":[0,3]}`,
+		`{"tag":"mo","text":"+","span":[4,5]}`,
+		`{"tag":"mi","text":"α","span":[6,12]}`,
+	} {
+		if !strings.Contains(js.String(), want) {
+			t.Errorf("expected %s in output\n%s", want, js.String())
+		}
+	}
+	data, err := json.Marshal(&treeblood.MMLNode{Tag: "mi", Text: "a&lt;b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	json.Unmarshal(data, &decoded)
+	if decoded["tag"] != "mi" || decoded["text"] != "a<b" || len(decoded) != 2 {
+		t.Errorf("unexpected encoding %s", data)
+	}
+}
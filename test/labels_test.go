@@ -0,0 +1,106 @@
+package treeblood_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestEquationLabels(t *testing.T) {
+	doc := treeblood.NewDocument(nil, true)
+	doc.PrintOneLine = true
+	tests := []struct {
+		tex     string
+		display bool
+		want    []string
+		reject  []string
+	}{
+		{`E = mc^2 \label{einstein}`, true, []string{`<mtext>(1)</mtext>`}, nil},
+		{`a^2 + b^2 = c^2 \notag`, true, nil, []string{`mlabeledtr`}},
+		{`F = ma \tag{N2} \label{newton}`, true, []string{`<mtext>(N2)</mtext>`}, nil},
+		{`x = y \tag*{A.1}`, true, []string{`<mtext>A.1</mtext>`}, nil},
+		{`z = w \tag{\alpha} \label{greek}`, true, []string{`<mtext>(α)</mtext>`}, nil},
+		{`u = v \tag{$x^2$}`, true, []string{`<mtd><mrow><mtext>(</mtext><mrow><msup><mi>x</mi><mn>2</mn></msup></mrow><mtext>)</mtext></mrow></mtd>`}, nil},
+		{`p = mv \label{momentum}`, true, []string{`<mtext>(2)</mtext>`}, nil},
+		{`\text{by } \eqref{einstein} \text{ and } \ref{newton}`, false, []string{`<mtext>(1)</mtext>`, `<mtext>N2</mtext>`}, nil},
+		{`\eqref{missing}`, false, []string{`<mtext title="unresolved reference: missing">(??)</mtext>`}, nil},
+	}
+	for _, tt := range tests {
+		var res string
+		var err error
+		if tt.display {
+			res, err = doc.DisplayStyle(tt.tex)
+		} else {
+			res, err = doc.TextStyle(tt.tex)
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(res, want) {
+				t.Errorf("%s: expected %s in output\n%s", tt.tex, want, res)
+			}
+		}
+		for _, reject := range tt.reject {
+			if strings.Contains(res, reject) {
+				t.Errorf("%s: unexpected %s in output\n%s", tt.tex, reject, res)
+			}
+		}
+	}
+	labels := doc.Labels()
+	expected := map[string]string{"einstein": "1", "newton": "N2", "greek": "α", "momentum": "2"}
+	for k, v := range expected {
+		if labels[k] != v {
+			t.Errorf("label %s: expected %s, got %s", k, v, labels[k])
+		}
+	}
+	if doc.EQCount != 2 {
+		t.Errorf("expected EQCount 2, got %d", doc.EQCount)
+	}
+	if unresolved := doc.UnresolvedRefs(); !slices.Equal(unresolved, []string{"missing"}) {
+		t.Errorf("unexpected unresolved references %v", unresolved)
+	}
+}
+
+func TestEnvironmentNumbering(t *testing.T) {
+	doc := treeblood.NewDocument(nil, true)
+	doc.PrintOneLine = true
+	tests := []struct {
+		tex    string
+		labels []string
+	}{
+		{`\begin{align} a &= b \label{first} \\ c &= d \notag \\ e &= f \tag{x} \\ \end{align}`, []string{"(1)", "(x)"}},
+		{`\begin{align*} a &= b \\ c &= d \tag*{y} \end{align*}`, []string{"y"}},
+		{`\begin{align*} a &= b \tag{\beta} \end{align*}`, []string{"(β)"}},
+		{`\begin{gather} a \\ b \label{second} \end{gather}`, []string{"(2)", "(3)"}},
+		{`\begin{multline} a + b \\ + c \\ = d \label{third} \end{multline}`, []string{"(4)"}},
+		{`\begin{aligned} a &= b \\ c &= d \end{aligned}`, []string{"(5)"}},
+		{`\begin{equation*} a = b \end{equation*}`, nil},
+		{`\begin{equation} a = b \label{fourth} \end{equation}`, []string{"(6)"}},
+		{`\begin{alignat}{2} a &= b & c &= d \\ e &= f & g &= h \end{alignat}`, []string{"(7)", "(8)"}},
+		{`\begin{flalign*} a &= b \\ c &= d \end{flalign*}`, nil},
+	}
+	for _, tt := range tests {
+		res, err := doc.DisplayStyle(tt.tex)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		if n := strings.Count(res, "<mlabeledtr>"); n != len(tt.labels) {
+			t.Errorf("%s: expected %d labeled rows, got %d\n%s", tt.tex, len(tt.labels), n, res)
+		}
+		for _, want := range tt.labels {
+			if !strings.Contains(res, "<mtd><mtext>"+want+"</mtext></mtd>") {
+				t.Errorf("%s: expected label %s in output\n%s", tt.tex, want, res)
+			}
+		}
+	}
+	labels := doc.Labels()
+	expected := map[string]string{"first": "1", "second": "3", "third": "4", "fourth": "6"}
+	for k, v := range expected {
+		if labels[k] != v {
+			t.Errorf("label %s: expected %s, got %s", k, v, labels[k])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package treeblood_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestParseMathMLRoundTrip(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.PrintOneLine = true
+	for _, tex := range []string{
+		`x^2 < \frac{a}{b}`,
+		`\sum_{i=1}^n i^2 = \frac{n(n+1)(2n+1)}{6}`,
+		`\left\{ x \in \mathbb{R} \middle| x \geq 0 \right\}`,
+		`\sqrt[3]{x} + \hat{y} + \text{if } z`,
+		`\lim_{x \to 0} \frac{\sin x}{x} = 1`,
+	} {
+		mml, err := pitz.DisplayStyle(tex)
+		if err != nil {
+			t.Errorf("%s: %s", tex, err.Error())
+			continue
+		}
+		mml = strings.TrimSpace(mml)
+		ast, err := treeblood.ParseMathML(strings.NewReader(mml))
+		if err != nil {
+			t.Errorf("%s: %s", tex, err.Error())
+			continue
+		}
+		var sb strings.Builder
+		ast.Write(&sb, -1)
+		if sb.String() != mml {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tex, mml, sb.String())
+		}
+		if src, ok := ast.TeX(); !ok || src != tex {
+			t.Errorf("%s: recovered TeX %q", tex, src)
+		}
+		want, _ := pitz.Speech(tex)
+		if got := ast.Speech(); got != want {
+			t.Errorf("%s: expected speech %q, got %q", tex, want, got)
+		}
+	}
+}
+
+func TestParseMathMLLegacy(t *testing.T) {
+	tests := []struct {
+		mml, want, tex string
+	}{
+		{
+			`<?xml version="1.0"?>
+<mml:math xmlns:mml="http://www.w3.org/1998/Math/MathML">
+  <mml:mrow>
+    <mml:mi> a </mml:mi><mml:mo>&InvisibleTimes;</mml:mo><mml:mi>b</mml:mi>
+    <mml:mtext>x&nbsp;  &amp; y</mml:mtext>
+  </mml:mrow>
+</mml:math>`,
+			`<math xmlns:mml="http://www.w3.org/1998/Math/MathML"><mrow><mi>a</mi><mo>` + "\u2062" + `</mo><mi>b</mi><mtext>x&nbsp; &amp; y</mtext></mrow></math>`,
+			"",
+		},
+		{
+			`<math><semantics><mrow><mi>a</mi><mo>&lt;</mo><mi>b</mi></mrow><annotation encoding="TeX">a &lt; b &amp; c</annotation></semantics></math>`,
+			`<math><semantics><mrow><mi>a</mi><mo>&lt;</mo><mi>b</mi></mrow><annotation encoding="TeX">a &lt; b &amp; c</annotation></semantics></math>`,
+			"a < b & c",
+		},
+		{`<mrow><mi>x</mi></mrow>`, `<mrow><mi>x</mi></mrow>`, ""},
+	}
+	for _, tt := range tests {
+		ast, err := treeblood.ParseMathML(strings.NewReader(tt.mml))
+		if err != nil {
+			t.Errorf("%s: %s", tt.mml, err.Error())
+			continue
+		}
+		var sb strings.Builder
+		ast.Write(&sb, -1)
+		if sb.String() != tt.want {
+			t.Errorf("expected\n%s\ngot\n%s", tt.want, sb.String())
+		}
+		if tex, _ := ast.TeX(); tex != tt.tex {
+			t.Errorf("expected TeX %q, got %q", tt.tex, tex)
+		}
+	}
+	for _, bad := range []string{"", "<math><mi>x</mi>", "<math><mi>x</mo></math>", `<span class="math"><span>x</span></span>`, "<div><math><mi>x</mi></math></div>"} {
+		if _, err := treeblood.ParseMathML(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestPostProcessMathML(t *testing.T) {
+	ast, err := treeblood.ParseMathML(strings.NewReader(`<math><mrow><mo>-</mo><msup><mi>f</mi><mrow><mo>'</mo><mo>'</mo></mrow></msup></mrow></math>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast.PostProcess()
+	var sb strings.Builder
+	ast.Write(&sb, -1)
+	want := `<math><mrow><mo>−</mo><msup><mi>f</mi><mrow><mo>″</mo></mrow></msup></mrow></math>`
+	if sb.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, sb.String())
+	}
+}
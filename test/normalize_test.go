@@ -0,0 +1,73 @@
+package treeblood_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestNormalize(t *testing.T) {
+	pitz := treeblood.NewPitziil(map[string]string{
+		"R":    `\mathbb{R}`,
+		"norm": `\left\lVert #1 \right\rVert`,
+	})
+	tests := []struct {
+		tex, want string
+	}{
+		{`\frac12 + \frac a b`, `\frac{1}{2} + \frac{a}{b}`},
+		{`\frac{12}3.5`, `\frac{12}{3}.5`},
+		{`\sqrt[3]2x \le \norm{x}`, `\sqrt[3]{2}x \leq \left\lVert x \right\rVert`},
+		{"f \\colon \\R \\to \\R % a function\n", `f \colon \mathbb{R} \to \mathbb{R}`},
+		{`\hat\alpha_1 + \mathbf  x\alpha%comment` + "\nb", `\hat{\alpha}_1 + \mathbf{x}\alpha b`},
+		{`\left( x \middle| y \right. \bigl\{ z \bigr\} \Big|`, `\left( x \middle| y \right. \bigl\{ z \bigr\} \Big|`},
+		{`a \land b \gets \lnot c \ne d`, `a \wedge b \leftarrow \neg c \neq d`},
+		{`\begin{pmatrix} a & b \\ c & d \end{pmatrix}`, "\\begin{pmatrix} a & b \\\\\nc & d \\end{pmatrix}"},
+		{`\begin{align*} x &= 1 \\[2pt] y &= 2 \end{align*}`, "\\begin{align*} x &= 1 \\\\[2pt]\ny &= 2 \\end{align*}"},
+		{`\text{a  b} \not= \{ \}`, `\text{a b} \not= \{ \}`},
+	}
+	for _, tt := range tests {
+		res, err := pitz.Normalize(tt.tex)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		if res != tt.want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.tex, tt.want, res)
+		}
+		again, _ := pitz.Normalize(res)
+		if again != res {
+			t.Errorf("%s: normalizing is not idempotent:\n%s\n%s", tt.tex, res, again)
+		}
+	}
+	if _, err := pitz.Normalize(`\frac{a`); err == nil {
+		t.Errorf("expected an error for mismatched braces")
+	}
+}
+
+// The normalized TeX must render to the same MathML as the original.
+func TestNormalizeRendering(t *testing.T) {
+	pitz := treeblood.NewPitziil(map[string]string{"R": `\mathbb{R}`})
+	pitz.PrintOneLine = true
+	annotation := regexp.MustCompile(`(?s)<annotation encoding="application/x-tex">.*?</annotation>`)
+	for _, tex := range []string{
+		`\frac{-b \pm \sqrt{b^2 - 4ac}}{2a}`,
+		`\sum_{i=1}^n i^2 \le \int_0^\infty e^{-x}\,dx`,
+		`\left\{ x \in \R \middle| x \ge 0 \right\}`,
+		`\begin{cases} x & x \ge 0 \\ -x & \text{otherwise} \end{cases}`,
+		`\hat x \vec v \overline{AB} \mathcal L \bigl( a \bigr)`,
+		`\alpha\beta \gets \dag \isin \empty`,
+	} {
+		norm, err := pitz.Normalize(tex)
+		if err != nil {
+			t.Errorf("%s: %s", tex, err.Error())
+			continue
+		}
+		want, _ := pitz.DisplayStyle(tex)
+		got, _ := pitz.DisplayStyle(norm)
+		want = annotation.ReplaceAllString(want, "")
+		got = annotation.ReplaceAllString(got, "")
+		if got != want {
+			t.Errorf("%s: normalized to %s, which renders differently:\n%s\n%s", tex, norm, want, got)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package treeblood_test
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestOMML(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	tests := []struct {
+		tex  string
+		want []string
+	}{
+		{`\frac{a}{b}`, []string{`<m:f><m:num><m:r><m:t>a</m:t></m:r></m:num><m:den><m:r><m:t>b</m:t></m:r></m:den></m:f>`}},
+		{`\binom{n}{k}`, []string{`<m:d><m:dPr><m:begChr m:val="("/><m:endChr m:val=")"/></m:dPr>`, `<m:type m:val="noBar"/>`}},
+		{`x_i^2 + y_j + z^3`, []string{`<m:sSubSup>`, `<m:sSub>`, `<m:sSup>`}},
+		{`\sum_{i=1}^n i^2 + 1`, []string{`<m:nary><m:naryPr><m:chr m:val="∑"/><m:limLoc m:val="undOvr"/></m:naryPr><m:sub>`, `<m:e><m:sSup><m:e><m:r><m:t>i</m:t></m:r></m:e><m:sup><m:r><m:t>2</m:t></m:r></m:sup></m:sSup></m:e></m:nary><m:r><m:t>+</m:t></m:r>`}},
+		{`\int f\,dx`, []string{`<m:chr m:val="∫"/><m:limLoc m:val="subSup"/><m:subHide m:val="1"/><m:supHide m:val="1"/>`}},
+		{`\sqrt{x} + \sqrt[3]{y}`, []string{`<m:rad><m:radPr><m:degHide m:val="1"/></m:radPr><m:deg/>`, `<m:rad><m:deg><m:r><m:t>3</m:t></m:r></m:deg>`}},
+		{`\begin{bmatrix} a & b \\ c & d \end{bmatrix}`, []string{`<m:begChr m:val="["/>`, `<m:m><m:mr><m:e><m:r><m:t>a</m:t></m:r></m:e><m:e><m:r><m:t>b</m:t></m:r></m:e></m:mr>`}},
+		{`\begin{aligned} a &= b \\ c &= d \end{aligned}`, []string{`<m:eqArr><m:e><m:r><m:t>a</m:t></m:r><m:r><m:t>=</m:t></m:r>`}},
+		{`\hat{x} \overline{y} \underline{z}`, []string{`<m:acc><m:accPr><m:chr m:val="̂"/></m:accPr>`, `<m:bar><m:barPr><m:pos m:val="top"/>`, `<m:pos m:val="bot"/>`}},
+		{`\lim_{x \to 0} \sin x`, []string{`<m:limLow><m:e><m:r><m:rPr><m:sty m:val="p"/></m:rPr><m:t>lim</m:t></m:r></m:e>`}},
+		{`a < \text{b & c}`, []string{`<m:t>&lt;</m:t>`, `<m:rPr><m:nor/></m:rPr><m:t>b &amp; c</m:t>`}},
+	}
+	for _, tt := range tests {
+		res, err := pitz.OMML(tt.tex, false)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(res, want) {
+				t.Errorf("%s: expected %s in output\n%s", tt.tex, want, res)
+			}
+		}
+		dec := xml.NewDecoder(strings.NewReader(res))
+		for {
+			_, err := dec.Token()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Errorf("%s: invalid XML: %s\n%s", tt.tex, err.Error(), res)
+				break
+			}
+		}
+	}
+	res, _ := pitz.OMML(`x`, true)
+	if !strings.HasPrefix(res, `<m:oMathPara xmlns:m="http://schemas.openxmlformats.org/officeDocument/2006/math"><m:oMath>`) {
+		t.Errorf("expected display math to be wrapped in m:oMathPara\n%s", res)
+	}
+}
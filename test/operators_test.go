@@ -0,0 +1,62 @@
+package treeblood_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestOperatorName(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.PrintOneLine = true
+	tests := []struct {
+		tex  string
+		want []string
+	}{
+		{`\operatorname{Tr} A`, []string{`<mi lspace="0.11111em">Tr</mi><mi>A</mi>`}},
+		{`\operatorname{T}`, []string{`<mi lspace="0.11111em" mathvariant="normal">T</mi>`}},
+		{`\operatorname{sn-1}`, []string{`<mi lspace="0.11111em">sn-1</mi>`}},
+		{`\operatorname*{argmax}_{x} f`, []string{`<munder><mi lspace="0.11111em" movablelimits="true">argmax</mi><mi>x</mi></munder>`}},
+		{`\operatorname{argmax}_{x} f`, []string{`<msub><mi lspace="0.11111em">argmax</mi><mi>x</mi></msub>`}},
+		{`\operatorname*{arg\,max}_x`, []string{`<munder><mrow movablelimits="true"><mi lspace="0.11111em">arg</mi><mspace width="0.1666667em"></mspace><mi>max</mi></mrow><mi>x</mi></munder>`}},
+		{`\operatorname*{ess}\nolimits_x`, []string{`<msub><mi lspace="0.11111em" movablelimits="true">ess</mi><mi>x</mi></msub>`}},
+		{`\DeclareMathOperator{\Tr}{Tr} \Tr_x`, []string{`<msub><mi lspace="0.11111em">Tr</mi><mi>x</mi></msub>`}},
+		{`\DeclareMathOperator*{\esssup}{ess\,sup} \esssup_x`, []string{`<munder><mrow movablelimits="true"><mi lspace="0.11111em">ess</mi>`}},
+	}
+	for _, tt := range tests {
+		res, err := pitz.DisplayStyle(tt.tex)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(res, want) {
+				t.Errorf("%s: expected %s in output\n%s", tt.tex, want, res)
+			}
+		}
+	}
+	// operators declared in an expression apply to the rest of the document
+	res, _ := pitz.DisplayStyle(`\esssup_y g`)
+	if !strings.Contains(res, `<munder><mrow movablelimits="true"><mi lspace="0.11111em">ess</mi>`) {
+		t.Errorf("expected \\esssup to remain defined\n%s", res)
+	}
+}
+
+func TestDeclareMathOperators(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.PrintOneLine = true
+	pitz.DeclareMathOperators(map[string]string{"rank": "rank"}, false)
+	pitz.DeclareMathOperators(map[string]string{"Lim": "Lim"}, true)
+	res, err := pitz.DisplayStyle(`\rank_A \Lim_{n} a_n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<msub><mi lspace="0.11111em">rank</mi><mi>A</mi></msub>`,
+		`<munder><mi lspace="0.11111em" movablelimits="true">Lim</mi><mi>n</mi></munder>`,
+	} {
+		if !strings.Contains(res, want) {
+			t.Errorf("expected %s in output\n%s", want, res)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package treeblood_test
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestRenderParallel(t *testing.T) {
+	eqs := []treeblood.Equation{
+		{Tex: `E = mc^2 \label{einstein}`, Display: true},
+		{Tex: `\text{see } \eqref{einstein} \text{ and } \eqref{later}`, Display: false},
+		{Tex: `\newcommand{\half}{\frac{1}{2}} \half x`, Display: true},
+		{Tex: `\begin{align} a &= \half b \label{row} \\ c &= d \notag \end{align}`, Display: true},
+		{Tex: `F = ma \tag{N2} \label{newton}`, Display: true},
+		{Tex: `p = mv \label{later}`, Display: true},
+		{Tex: `\eqref{row}, \ref{newton}, \eqref{later}`, Display: false},
+	}
+	for _, tt := range readTestcases()["intmath"] {
+		eqs = append(eqs, treeblood.Equation{Tex: tt.Tex, Display: true})
+	}
+	sequential := treeblood.NewDocument(nil, true)
+	sequential.PrintOneLine = true
+	want := make([]string, len(eqs))
+	for i, eq := range eqs {
+		if eq.Display {
+			want[i], _ = sequential.DisplayStyle(eq.Tex)
+		} else {
+			want[i], _ = sequential.TextStyle(eq.Tex)
+		}
+	}
+	parallel := treeblood.NewDocument(nil, true)
+	parallel.PrintOneLine = true
+	got, errs := parallel.RenderParallel(eqs, 4)
+	for i := range eqs {
+		if errs[i] != nil {
+			t.Errorf("%s: %s", eqs[i].Tex, errs[i].Error())
+		}
+		if got[i].MathML != want[i] {
+			t.Errorf("%s: parallel output differs:\n%s\n%s", eqs[i].Tex, got[i].MathML, want[i])
+		}
+	}
+	if parallel.EQCount != sequential.EQCount {
+		t.Errorf("expected EQCount %d, got %d", sequential.EQCount, parallel.EQCount)
+	}
+	if !maps.Equal(parallel.Labels(), sequential.Labels()) {
+		t.Errorf("labels differ: %v %v", parallel.Labels(), sequential.Labels())
+	}
+	if !slices.Equal(parallel.UnresolvedRefs(), []string{"later"}) {
+		t.Errorf("unexpected unresolved references %v", parallel.UnresolvedRefs())
+	}
+}
+
+// Macros defined with \newcommand in one expression are available in the expressions after it.
+func TestMacrosCarryOver(t *testing.T) {
+	eqs := []treeblood.Equation{
+		{Tex: `\newcommand{\foo}[1]{#1^2} \foo{x}`},
+		{Tex: `\foo{y}`},
+		{Tex: `\def\bar{z} \bar`},
+		{Tex: `\bar + \foo{w}`},
+	}
+	want := []string{
+		`<msup><mi>x</mi><mn>2</mn></msup>`,
+		`<msup><mi>y</mi><mn>2</mn></msup>`,
+		`<mi>z</mi>`,
+		`<mi>z</mi><mo>+</mo><mrow><msup><mi>w</mi><mn>2</mn></msup></mrow>`,
+	}
+	sequential := treeblood.NewDocument(nil, false)
+	sequential.PrintOneLine = true
+	for i, eq := range eqs {
+		res, err := sequential.TextStyle(eq.Tex)
+		if err != nil {
+			t.Errorf("%s: %s", eq.Tex, err.Error())
+		}
+		if !strings.Contains(res, want[i]) {
+			t.Errorf("%s: expected %s in output\n%s", eq.Tex, want[i], res)
+		}
+	}
+	parallel := treeblood.NewDocument(nil, false)
+	parallel.PrintOneLine = true
+	got, _ := parallel.RenderParallel(eqs, 4)
+	for i, eq := range eqs {
+		if !strings.Contains(got[i].MathML, want[i]) {
+			t.Errorf("%s: expected %s in parallel output\n%s", eq.Tex, want[i], got[i].MathML)
+		}
+	}
+}
+
+// Run with -race to check that a single Pitziil may be shared between goroutines.
+func TestConcurrentRendering(t *testing.T) {
+	doc := treeblood.NewDocument(map[string]string{"R": `\mathbb{R}`}, true)
+	tests := readTestcases()["intmath"]
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, tt := range tests {
+				doc.DisplayStyle(fmt.Sprintf(`\newcommand{\g%d}{x} %s \in \R \label{eq%d-%d}`, g, tt.Tex, g, i))
+				doc.TextStyle(`\ref{eq0-0}`)
+			}
+		}()
+	}
+	wg.Wait()
+	if doc.EQCount != 8*len(tests) {
+		t.Errorf("expected EQCount %d, got %d", 8*len(tests), doc.EQCount)
+	}
+}
@@ -0,0 +1,58 @@
+package treeblood_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestSpeech(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	tests := []struct {
+		tex  string
+		want string
+	}{
+		{`x = \frac{-b \pm \sqrt{b^2-4ac}}{2a}`, "x equals the fraction with numerator negative b plus or minus the square root of b squared minus 4 a c, end root, and denominator 2 a, end fraction"},
+		{`\frac{a}{b}`, "a over b"},
+		{`\sum_{i=1}^n i^2`, "the sum from i equals 1 to n of i squared"},
+		{`\int_0^1 x^{n+1}\,dx`, "the integral from 0 to 1 of x to the power of n plus 1, end exponent d x"},
+		{`\lim_{x\to 0} \sin x`, "the limit as x approaches 0 of sine x"},
+		{`\sqrt[3]{x} + \sqrt[n]{y}`, "the cube root of x plus the n-th root of y"},
+		{`\hat{x} \vec{v} f'`, "x hat vector v f prime"},
+		{`\binom{n}{k}`, "n choose k"},
+		{`\left| x \right| \leq \alpha`, "the absolute value of x, end absolute value is less than or equal to alpha"},
+		{`\begin{pmatrix} a & b \\ c & d \end{pmatrix}`, "the 2 by 2 matrix, row 1: a, b; row 2: c, d, end matrix"},
+		{`a - (-b)`, "a minus open paren negative b close paren"},
+		{`\dv{f}{x}`, "the fraction with numerator d f, and denominator d x, end fraction"},
+		{`a_{ij}`, "a sub i j"},
+		{`a_{ij} + b`, "a sub i j, plus b"},
+	}
+	for _, tt := range tests {
+		got, err := pitz.Speech(tt.tex)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		if got != tt.want {
+			t.Errorf("%s:\n got: %s\nwant: %s", tt.tex, got, tt.want)
+		}
+	}
+}
+
+func TestSpeechLabels(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.SpeechLabels = true
+	res, err := pitz.TextStyle(`a < \frac{1}{2}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`alttext="a is less than 1 over 2"`, `aria-label="a is less than 1 over 2"`} {
+		if !strings.Contains(res, want) {
+			t.Errorf("expected %s in output\n%s", want, res)
+		}
+	}
+	pitz.SpeechLabels = false
+	if res, _ = pitz.TextStyle(`x`); strings.Contains(res, "aria-label") {
+		t.Errorf("unexpected aria-label in output\n%s", res)
+	}
+}
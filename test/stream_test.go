@@ -0,0 +1,76 @@
+package treeblood_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestRenderTo(t *testing.T) {
+	doc := treeblood.NewPitziil()
+	var buf bytes.Buffer
+	for _, tests := range readTestcases() {
+		for _, tt := range tests {
+			for _, display := range []bool{true, false} {
+				var want string
+				if display {
+					want, _ = doc.DisplayStyle(tt.Tex)
+				} else {
+					want, _ = doc.TextStyle(tt.Tex)
+				}
+				buf.Reset()
+				doc.RenderTo(&buf, tt.Tex, display)
+				if buf.String() != want {
+					t.Errorf("%s: RenderTo differs from the string output:\n%s\n%s", tt.Tex, buf.String(), want)
+				}
+			}
+		}
+	}
+	if err := doc.RenderTo(failingWriter{}, `x^2`, true); err == nil {
+		t.Error("expected an error from a failing writer")
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	node := treeblood.NewMMLNode("mrow")
+	node.AppendNew("mi", "x")
+	node.AppendNew("mo", "+")
+	node.AppendNew("mn", "1")
+	var buf bytes.Buffer
+	n, err := node.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<mrow><mi>x</mi><mo>+</mo><mn>1</mn></mrow>`
+	if buf.String() != want || n != int64(len(want)) {
+		t.Errorf("got %q (%d bytes), expected %q", buf.String(), n, want)
+	}
+}
+
+func TestCanonicalOrdering(t *testing.T) {
+	doc := treeblood.NewPitziil()
+	doc.PrintOneLine = true
+	tex := `\begin{align} a &= \left( \frac{b}{c} \right) \\ d &= e \end{align}`
+	first, _ := doc.DisplayStyle(tex)
+	for range 20 {
+		if res, _ := doc.DisplayStyle(tex); res != first {
+			t.Fatalf("output is not deterministic:\n%s\n%s", first, res)
+		}
+	}
+	want := `<math class="math-displaystyle" display="block" displaystyle="true" style="font-feature-settings: 'dtls' off;" xmlns="http://www.w3.org/1998/Math/MathML">`
+	if !strings.HasPrefix(first, "\n"+want) {
+		t.Errorf("attributes are not sorted:\n%s", first)
+	}
+	if !strings.Contains(first, `style="padding-left:1em;padding-right:0em;text-align:right;"`) {
+		t.Errorf("style properties are not sorted:\n%s", first)
+	}
+}
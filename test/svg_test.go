@@ -0,0 +1,101 @@
+package treeblood_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+	"github.com/wyatt915/treeblood/svg"
+)
+
+func TestSVG(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	tests := []struct {
+		tex     string
+		display bool
+		want    []string
+	}{
+		{`x^2`, false, []string{`<svg xmlns="http://www.w3.org/2000/svg" width="`, ` viewBox="`, `<path d="M`, ` scale(0.7)`}},
+		{`y`, false, []string{`style="vertical-align: -0.`}},
+		{`\sum_{i=1}^n i`, true, []string{`style="display: block; margin: 0 auto;"`}},
+		{`\frac{a}{b}`, false, []string{`<rect x=`}},
+		{`\sqrt{2}`, false, []string{`<rect x=`}},
+		{`{\color{red} a} + b`, false, []string{`fill="red"`}},
+		{`a \mathllap{x}`, false, []string{` transform="translate(-`}},
+		{`\cancel{a}`, false, []string{`<line x1=`, `stroke="currentColor"`}},
+		{`\fcolorbox{red}{yellow}{a}`, false, []string{`<rect x=`, `fill="yellow"`, `fill="none" stroke="red"`}},
+	}
+	for _, tt := range tests {
+		res, err := svg.RenderTeX(pitz, tt.tex, tt.display)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+			continue
+		}
+		if !strings.HasSuffix(res, "</svg>") {
+			t.Errorf("%s: unterminated svg\n%s", tt.tex, res)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(res, want) {
+				t.Errorf("%s: expected %s in output\n%s", tt.tex, want, res)
+			}
+		}
+	}
+}
+
+func TestSVGMatchesMathML(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	tex := `\int_0^1 f(x)\,dx = \left( \frac{a}{b} \right)`
+	mml, err := pitz.DisplayStyle(tex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := treeblood.ParseMathML(strings.NewReader(mml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromTree, err := svg.Render(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromTeX, err := svg.RenderTeX(pitz, tex, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromTree != fromTeX {
+		t.Errorf("Render and RenderTeX differ:\n%s\n%s", fromTree, fromTeX)
+	}
+	if label := `aria-label="` + n.Speech() + `"`; !strings.Contains(fromTree, label) {
+		t.Errorf("expected %s in output\n%s", label, fromTree)
+	}
+	if _, err := svg.Render(nil); err == nil {
+		t.Errorf("expected an error rendering a nil tree")
+	}
+}
+
+func TestSVGLeavesDocumentAlone(t *testing.T) {
+	doc := treeblood.NewDocument(nil, true)
+	if _, err := svg.RenderTeX(doc, `\newcommand{\half}{\frac{1}{2}} E = mc^2 \label{einstein}`, true); err != nil {
+		t.Fatal(err)
+	}
+	if doc.EQCount != 0 {
+		t.Errorf("expected EQCount 0, got %d", doc.EQCount)
+	}
+	if labels := doc.Labels(); len(labels) != 0 {
+		t.Errorf("unexpected labels %v", labels)
+	}
+	if res, _ := doc.TextStyle(`\half`); !strings.Contains(res, "merror") {
+		t.Errorf("expected \\half to be undefined\n%s", res)
+	}
+}
+
+func TestSVGIgnoresHTMLOutput(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.HTMLOutput = true
+	res, err := svg.RenderTeX(pitz, `\frac{a}{b}`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res, `<rect x=`) || strings.Contains(res, "span") {
+		t.Errorf("expected a fraction drawn from the MathML\n%s", res)
+	}
+}
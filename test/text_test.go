@@ -0,0 +1,46 @@
+package treeblood_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestTextCommands(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.PrintOneLine = true
+	tests := []struct {
+		tex  string
+		want []string
+	}{
+		{`\text{if } x`, []string{`<mtext>if&nbsp;</mtext><mi>x</mi>`}},
+		{`\text{}`, []string{`<mtext></mtext>`}},
+		{`\textbf{a}`, []string{`<mtext mathvariant="bold" style="font-weight:bold;">a</mtext>`}},
+		{`\textit{a}`, []string{`<mtext mathvariant="italic" style="font-style:italic;">a</mtext>`}},
+		{`\texttt{a}`, []string{`<mtext mathvariant="monospace" style="font-family:monospace;">a</mtext>`}},
+		{`\textsf{a}`, []string{`<mtext mathvariant="sans-serif" style="font-family:sans-serif;">a</mtext>`}},
+		{`\textrm{a} \mbox{b} \hbox{c}`, []string{`<mtext>a</mtext><mtext>b</mtext><mtext>c</mtext>`}},
+		{`\textbf{a \textit{b}}`, []string{`<mtext mathvariant="bold" style="font-weight:bold;">a&nbsp;</mtext><mtext mathvariant="bold-italic" style="font-style:italic;font-weight:bold;">b</mtext>`}},
+		{`\mathbf{\text{a}}`, []string{`<mtext>a</mtext>`}},
+		{`\text{a $x^2$ b}`, []string{`<mtext>a&nbsp;</mtext><mrow><msup><mi>x</mi><mn>2</mn></msup></mrow><mtext>&nbsp;b</mtext>`}},
+		{`\text{$\text{$x$}$}`, []string{`<semantics><mrow><mrow><mi>x</mi></mrow></mrow><annotation`}},
+		{`\text{for \(y > 0\)}`, []string{`<mtext>for&nbsp;</mtext><mrow><mi>y</mi><mo>&gt;</mo><mn>0</mn></mrow>`}},
+		{`\text{50\% \& \$5 \{x\} a<b}`, []string{`<mtext>50%&nbsp;&amp;&nbsp;$5&nbsp;{x}&nbsp;a&lt;b</mtext>`}},
+		{`\text{a\ b~c}`, []string{`<mtext>a&nbsp;b&nbsp;c</mtext>`}},
+		{"\\text{``a'' --- b's}", []string{`<mtext>“a”&nbsp;—&nbsp;b’s</mtext>`}},
+		{`\text{\textbackslash\ldots x}`, []string{`<mtext>\…x</mtext>`}},
+		{`\text{a {\color{red} b}}`, []string{`<mtext>a&nbsp;</mtext><mstyle mathcolor="red"><mtext>&nbsp;b</mtext></mstyle>`}},
+	}
+	for _, tt := range tests {
+		res, err := pitz.TextStyle(tt.tex)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(res, want) {
+				t.Errorf("%s: expected %s in output\n%s", tt.tex, want, res)
+			}
+		}
+	}
+}
@@ -107,9 +107,6 @@ func TestTexInputs(t *testing.T) {
 	AllTests := readTestcases()
 	results := make(map[string][]TexTest)
 	for testname, tests := range AllTests {
-		if testname == "derivatives" {
-			continue
-		}
 		subtest := func(tt *testing.T) {
 			doc := treeblood.NewPitziil()
 			doc.PrintOneLine = true
@@ -195,6 +192,20 @@ func BenchmarkComplexInputs(b *testing.B) {
 	}
 }
 
+func BenchmarkRenderTo(b *testing.B) {
+	tests := readTestcases()["intmath"]
+	doc := treeblood.NewPitziil()
+	chars := 0
+	for b.Loop() {
+		for _, t := range tests {
+			chars += len(t.Tex)
+			doc.RenderTo(io.Discard, t.Tex, true)
+		}
+	}
+	b.ReportMetric(float64(chars)/float64(b.Elapsed().Milliseconds()), "characters/ms")
+	b.ReportAllocs()
+}
+
 // Same set from https://www.intmath.com/cg5/katex-mathjax-comparison.php
 // demonstrates 1000x performance over mathjax and 100x performance over katex
 //func TestIntmathSet(t *testing.T) {
@@ -0,0 +1,37 @@
+package treeblood_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestUnderOverSet(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	pitz.PrintOneLine = true
+	tests := []struct {
+		tex  string
+		want []string
+	}{
+		{`\overset{a}{b}`, []string{`<mrow><mover><mi>b</mi><mi>a</mi></mover></mrow>`}},
+		{`\underset{x}{\to}`, []string{`<mrow><munder><mo stretchy="true">→</mo><mi>x</mi></munder></mrow>`}},
+		{`\overunderset{a}{b}{\longrightarrow}`, []string{`<munderover><mo stretchy="true">⟶</mo><mi>b</mi><mi>a</mi></munderover>`}},
+		{`\underoverset{a}{b}{x}`, []string{`<munderover><mi>x</mi><mi>a</mi><mi>b</mi></munderover>`}},
+		{`a \stackrel{\text{def}}{=} b`, []string{`<mi>a</mi><mrow><mover><mo stretchy="true">=</mo><mtext>def</mtext></mover></mrow><mi>b</mi>`}},
+		{`a \overset{*}{+} b`, []string{`<mi>a</mi><mrow><mover><mo stretchy="true">+</mo><mo>*</mo></mover></mrow><mi>b</mi>`}},
+		{`a \stackrel{a}{b} c`, []string{`<mpadded lspace="0.2778em" width="+0.5556em"><mover><mi>b</mi><mi>a</mi></mover></mpadded>`}},
+		{`a \stackrel{*}{+} c`, []string{`<mpadded lspace="0.2778em" width="+0.5556em"><mover><mo lspace="0" rspace="0" stretchy="true">+</mo><mo>*</mo></mover></mpadded>`}},
+	}
+	for _, tt := range tests {
+		res, err := pitz.TextStyle(tt.tex)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(res, want) {
+				t.Errorf("%s: expected %s in output\n%s", tt.tex, want, res)
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package treeblood_test
+
+import (
+	"testing"
+
+	"github.com/wyatt915/treeblood"
+)
+
+func TestUnicodeText(t *testing.T) {
+	pitz := treeblood.NewPitziil()
+	tests := []struct {
+		tex  string
+		want string
+	}{
+		{`x = \frac{-b \pm \sqrt{b^2-4ac}}{2a}`, "x = (−b ± √(b² − 4ac))/(2a)"},
+		{`\sum_{i=1}^n i^2`, "∑ᵢ₌₁ⁿ i²"},
+		{`\int_0^1 f(x)\,dx`, "∫₀¹ f(x) dx"},
+		{`e^{i\pi} + 1 = 0`, "e^(iπ) + 1 = 0"},
+		{`\lim_{x\to 0} \frac{\sin x}{x} = 1`, "lim_(x→0) (sin x)/x = 1"},
+		{`\sqrt[3]{x} - \sqrt[n]{y}`, "∛x − ⁿ√y"},
+		{`\hat{x} + \overline{AB}`, "x̂ + A̅B̅"},
+		{`f'(x) = -x^{n+1}`, "f′(x) = −xⁿ⁺¹"},
+		{`\binom{n}{k}`, "(n¦k)"},
+		{`\begin{pmatrix} a & b \\ c & d \end{pmatrix}`, "(a, b; c, d)"},
+		{`\begin{aligned} a &= b \\ c &= -d \end{aligned}`, "a = b\nc = −d"},
+	}
+	for _, tt := range tests {
+		got, err := pitz.UnicodeText(tt.tex)
+		if err != nil {
+			t.Errorf("%s: %s", tt.tex, err.Error())
+		}
+		if got != tt.want {
+			t.Errorf("%s:\n got: %q\nwant: %q", tt.tex, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package treeblood
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var (
+	// characters produced by commands in text mode
+	text_symbols = map[string]string{
+		"textbackslash":     `\`,
+		"textasciitilde":    "~",
+		"textasciicircum":   "^",
+		"textbar":           "|",
+		"textless":          "<",
+		"textgreater":       ">",
+		"textunderscore":    "_",
+		"textbraceleft":     "{",
+		"textbraceright":    "}",
+		"textdollar":        "$",
+		"textendash":        "–",
+		"textemdash":        "—",
+		"textquoteleft":     "‘",
+		"textquoteright":    "’",
+		"textquotedblleft":  "“",
+		"textquotedblright": "”",
+		"textbullet":        "•",
+		"textellipsis":      "…",
+		"ldots":             "…",
+		"dots":              "…",
+		"S":                 "§",
+		"P":                 "¶",
+		"dag":               "†",
+		"ddag":              "‡",
+		"copyright":         "©",
+		"textregistered":    "®",
+		"texttrademark":     "™",
+	}
+	// CSS for the variants of mtext, for browsers that only support mathvariant on <mi>
+	text_variant_css = map[parseContext][2]string{
+		ctxVarBold:   {"font-weight", "bold"},
+		ctxVarItalic: {"font-style", "italic"},
+		ctxVarSans:   {"font-family", "sans-serif"},
+		ctxVarMono:   {"font-family", "monospace"},
+	}
+)
+
+// textContext returns the context in which the argument of the text command name is parsed. Text does not take on
+// the font of the math surrounding it, but the text commands nest, so that \textbf{\textit{x}} is bold and italic.
+func textContext(context parseContext, name string) parseContext {
+	if context&ctxText == 0 {
+		context = context&^isolateMathVariant(context) | ctxText
+	}
+	switch name {
+	case "textnormal":
+		context &^= isolateMathVariant(context)
+	case "textrm":
+		context &^= ctxVarSans | ctxVarMono
+	case "textsf", "texttt":
+		context = context&^(ctxVarSans|ctxVarMono) | text_commands[name]
+	case "textup":
+		context &^= ctxVarItalic
+	case "textmd":
+		context &^= ctxVarBold
+	case "emph":
+		context ^= ctxVarItalic
+	default:
+		context |= text_commands[name]
+	}
+	return context
+}
+
+// textParser collects the nodes of a run of text. Consecutive characters are gathered into a single <mtext>.
+type textParser struct {
+	pitz       *Pitziil
+	context    parseContext
+	nodes      []*MMLNode
+	sb         strings.Builder // entity-escaped text not yet written to an <mtext>
+	start, end int             // the location of the pending text in the expression
+}
+
+// parseText parses b as the argument of a text command such as \text or \textbf. Whitespace and escaped characters
+// are kept as written, and math delimited by $...$ or \(...\) becomes a sibling <mrow> of the surrounding text.
+func (pitz *Pitziil) parseText(b *TokenBuffer, context parseContext, parent ...*MMLNode) *MMLNode {
+	p := textParser{pitz: pitz, context: context &^ ctxRoot}
+	p.parse(b)
+	p.flush()
+	if len(parent) > 0 && parent[0] != nil {
+		node := parent[0]
+		node.Children = append(node.Children, p.nodes...)
+		if node.Tag == "" {
+			node.Tag = "mrow"
+		}
+		return node
+	}
+	switch len(p.nodes) {
+	case 0:
+		return NewMMLNode("mtext")
+	case 1:
+		return p.nodes[0]
+	}
+	return NewMMLNode("mrow").AppendChild(p.nodes...)
+}
+
+// write adds s, which must already be escaped, to the pending text.
+func (p *textParser) write(s string, tok Token) {
+	if p.sb.Len() == 0 {
+		p.start = tok.start
+	}
+	p.sb.WriteString(s)
+	p.end = tok.end
+}
+
+// flush ends the pending text, if any, with an <mtext> in the font given by the context.
+func (p *textParser) flush() {
+	if p.sb.Len() == 0 {
+		return
+	}
+	n := NewMMLNode("mtext", p.sb.String())
+	n.Tok = Token{Kind: tokLetter, Value: p.sb.String(), start: p.start, end: p.end}
+	if variant := mathvariantFromContext(p.context); variant != "" {
+		n.SetAttr("mathvariant", variant)
+		for bit, css := range text_variant_css {
+			if p.context&bit > 0 {
+				n.SetCssProp(css[0], css[1])
+			}
+		}
+	}
+	p.nodes = append(p.nodes, n)
+	p.sb.Reset()
+}
+
+// add ends the pending text and appends n.
+func (p *textParser) add(n *MMLNode) {
+	p.flush()
+	if n != nil {
+		p.nodes = append(p.nodes, n)
+	}
+}
+
+// math parses toks as inline math.
+func (p *textParser) math(toks []Token) {
+	// math in text is set in the math fonts, whatever the font of the text around it
+	ctx := p.context&^ctxText&^isolateMathVariant(p.context) | ctxInline
+	p.add(p.pitz.ParseTex(NewTokenBuffer(toks), ctx, NewMMLNode("mrow")))
+}
+
+// closingMath returns the index of the token that closes the math opened at b.Expr[i], or -1 if there is none.
+func closingMath(b *TokenBuffer, i int) int {
+	open := b.Expr[i]
+	if open.Kind&tokEscaped > 0 && open.MatchOffset > 0 {
+		return i + open.MatchOffset
+	}
+	for j := i + 1; j < len(b.Expr); j++ {
+		t := b.Expr[j]
+		if t.Kind&(tokCurly|tokOpen) == tokCurly|tokOpen && t.Kind&tokEscaped == 0 && t.MatchOffset > 0 {
+			// a $ within a group, such as that of a nested \text, belongs to the group
+			j += t.MatchOffset
+			continue
+		}
+		if open.Kind&tokReserved > 0 && t.Kind&tokReserved > 0 && t.Value == "$" {
+			return j
+		}
+		if open.Kind&tokEscaped > 0 && t.Kind&tokEscaped > 0 && t.Value == ")" {
+			return j
+		}
+	}
+	return -1
+}
+
+func (p *textParser) parse(b *TokenBuffer) {
+	// the number of consecutive tokens with the value v beginning at b.Expr[i]
+	run := func(i int, v string) int {
+		n := 0
+		for i+n < len(b.Expr) && b.Expr[i+n].Kind&tokChar > 0 && b.Expr[i+n].Value == v {
+			n++
+		}
+		return n
+	}
+	for b.idx < len(b.Expr) {
+		i := b.idx
+		tok := b.Expr[i]
+		b.idx++
+		switch {
+		case tok.Kind&tokComment > 0:
+		case tok.Kind&tokWhitespace > 0:
+			p.write("&nbsp;", tok)
+		case tok.Kind&(tokCurly|tokOpen) == tokCurly|tokOpen && tok.Kind&tokEscaped == 0:
+			// braces only delimit groups in text; their contents continue the current run
+			end := min(i+max(tok.MatchOffset, 0), len(b.Expr))
+			p.parse(NewTokenBuffer(b.Expr[i+1 : end]))
+			b.idx = end + 1
+		case tok.Kind&tokCurly > 0 && tok.Kind&tokEscaped == 0:
+			// a stray closing brace
+		case tok.Kind&tokReserved > 0 && tok.Value == "$", tok.Kind&tokEscaped > 0 && tok.Value == "(":
+			end := closingMath(b, i)
+			if end < 0 {
+				p.pitz.diagnose(SeverityWarning, DiagSyntax, tok, "unterminated math in text")
+				end = len(b.Expr)
+			}
+			p.math(b.Expr[i+1 : end])
+			b.idx = end + 1
+		case tok.Kind&tokReserved > 0 && tok.Value == "~":
+			p.write("&nbsp;", tok)
+		case tok.Kind&tokEscaped > 0 && tok.Value == `\`:
+			p.add(NewMMLNode("mspace").SetAttr("linebreak", "newline"))
+		case tok.Kind&tokCommand > 0:
+			p.command(tok, b)
+		case tok.Kind&tokChar > 0 && tok.Value == "`":
+			if run(i, "`") > 1 {
+				p.write("“", tok)
+				b.idx++
+			} else {
+				p.write("‘", tok)
+			}
+		case tok.Kind&tokChar > 0 && tok.Value == "'":
+			if run(i, "'") > 1 {
+				p.write("”", tok)
+				b.idx++
+			} else {
+				p.write("’", tok)
+			}
+		case tok.Kind&tokChar > 0 && tok.Value == "-":
+			n := min(run(i, "-"), 3)
+			p.write([]string{"-", "–", "—"}[n-1], tok)
+			b.idx = i + n
+		default:
+			p.write(xmlEscaper.Replace(tok.Value), tok)
+		}
+	}
+}
+
+// command handles a command in text. Commands that produce characters add to the current run; the rest are
+// processed as in math.
+func (p *textParser) command(tok Token, b *TokenBuffer) {
+	name := tok.Value
+	// as in TeX, the spaces following a command whose name is a word are skipped
+	if r := []rune(name); unicode.IsLetter(r[len(r)-1]) {
+		for b.idx < len(b.Expr) && b.Expr[b.idx].Kind&tokWhitespace > 0 {
+			b.idx++
+		}
+	}
+	if s, ok := text_symbols[name]; ok {
+		p.write(xmlEscaper.Replace(s), tok)
+		return
+	}
+	if name == " " {
+		p.write("&nbsp;", tok)
+		return
+	}
+	if _, ok := text_commands[name]; ok {
+		p.flush()
+		arg, err := b.GetNextExpr()
+		if errors.Is(err, ErrTokenBufferSingle) {
+			arg, err = b.GetNextN(1, true)
+		}
+		if err != nil {
+			p.add(p.pitz.merror(DiagArgument, name, name+" expects an argument"))
+			return
+		}
+		inner := textParser{pitz: p.pitz, context: textContext(p.context, name)}
+		inner.parse(arg)
+		inner.flush()
+		p.nodes = append(p.nodes, inner.nodes...)
+		return
+	}
+	if sym, ok := symbolTable[name]; ok && sym.char != "" && sym.kind != sym_large {
+		p.write(xmlEscaper.Replace(sym.char), tok)
+		return
+	}
+	p.add(p.pitz.ProcessCommand(p.context, tok, b))
+}
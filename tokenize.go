@@ -2,8 +2,6 @@ package treeblood
 
 import (
 	"errors"
-	"log"
-	"os"
 	"slices"
 	"strconv"
 	"strings"
@@ -49,7 +47,8 @@ const (
 	tokBigness4
 	tokInfix
 	tokStarSuffix
-	tokNull = 0
+	tokLeftRight // a delimiter given by \left, \middle, or \right
+	tokNull      = 0
 )
 
 var (
@@ -66,10 +65,6 @@ var (
 	char_reserved = []rune(`#$%^&_{}~\`)
 )
 
-func init() {
-	logger = log.New(os.Stderr, "TreeBlood: ", log.LstdFlags)
-}
-
 type Token struct {
 	Kind        TokenKind
 	MatchOffset int // offset from current index to matching paren, brace, etc.
@@ -223,7 +218,7 @@ func getToken(tex []rune, start int) (Token, int) {
 			}
 		}
 	}
-	return Token{Kind: kind, Value: string(result)}, idx
+	return Token{Kind: kind, Value: string(result), start: start, end: idx}, idx
 }
 
 type ExprKind int
@@ -458,17 +453,6 @@ func StringifyTokens(toks []Token) string {
 	}
 	return sb.String()
 }
-func stringifyTokensHtml(toks []Token) string {
-	var sb strings.Builder
-	for _, t := range toks {
-		if t.Value == " " {
-			sb.WriteString("&nbsp;")
-		} else {
-			sb.WriteString(t.Value)
-		}
-	}
-	return sb.String()
-}
 
 type tokenTestFunc func(t Token, u ...Token) bool
 
@@ -476,10 +460,11 @@ type MismatchedBraceError struct {
 	kind    string
 	context string
 	pos     int
+	tok     Token // the offending token
 }
 
-func newMismatchedBraceError(kind string, context string, pos int) MismatchedBraceError {
-	return MismatchedBraceError{kind, context, pos}
+func newMismatchedBraceError(kind string, context string, pos int, tok Token) MismatchedBraceError {
+	return MismatchedBraceError{kind, context, pos, tok}
 }
 
 func (e MismatchedBraceError) Error() string {
@@ -535,12 +520,12 @@ func matchBracesCritical(tokens []Token, kind TokenKind) error {
 					k = "environment (" + t.Value + ")"
 				}
 				context := errorContext(t, StringifyTokens(tokens[max(0, i-contextLength):min(i+contextLength, len(tokens))]))
-				return newMismatchedBraceError(k, "<pre>"+context+"</pre>", i)
+				return newMismatchedBraceError(k, "<pre>"+context+"</pre>", i, t)
 			}
 			mate := tokens[s.Peek()]
 			if kind == tokEnv && mate.Value != t.Value {
 				context := errorContext(t, StringifyTokens(tokens[max(0, i-contextLength):min(i+contextLength, len(tokens))]))
-				return newMismatchedBraceError("environment ("+mate.Value+")", "<pre>"+context+"</pre>", i)
+				return newMismatchedBraceError("environment ("+mate.Value+")", "<pre>"+context+"</pre>", i, t)
 			}
 			if (mate.Kind&t.Kind)&kind > 0 {
 				pos := s.Pop()
@@ -560,14 +545,15 @@ func matchBracesCritical(tokens []Token, kind TokenKind) error {
 			kind = "environment (" + t.Value + ")"
 		}
 		context := errorContext(t, StringifyTokens(tokens[max(0, pos-contextLength):min(pos+contextLength, len(tokens))]))
-		return newMismatchedBraceError(kind, "<pre>"+context+"</pre>", pos)
+		return newMismatchedBraceError(kind, "<pre>"+context+"</pre>", pos, t)
 	}
 	return nil
 }
 
+// match delimiters such as parentheses which need not be balanced. Unmatched delimiters are left with a MatchOffset of
+// zero and reported by the parser.
 func matchBracesLazy(tokens []Token) {
 	s := newStack[int]()
-	contextLength := 16
 	for i, t := range tokens {
 		if t.MatchOffset != 0 {
 			// Critical regions have already been taken care of.
@@ -579,9 +565,6 @@ func matchBracesLazy(tokens []Token) {
 		}
 		if t.Kind&tokClose > 0 {
 			if s.empty() {
-				logger.Println("WARN: Potentially unmatched closing delimeter")
-				context := StringifyTokens(tokens[max(0, i-contextLength):min(i+contextLength, len(tokens))])
-				logger.Println(errorContext(t, context))
 				continue
 			}
 			mate := tokens[s.Peek()]
@@ -589,10 +572,6 @@ func matchBracesLazy(tokens []Token) {
 				pos := s.Pop()
 				tokens[i].MatchOffset = pos - i
 				tokens[pos].MatchOffset = i - pos
-			} else {
-				logger.Println("WARN: Potentially unmatched closing delimeter")
-				context := StringifyTokens(tokens[max(0, i-contextLength):min(i+contextLength, len(tokens))])
-				logger.Println(errorContext(t, context))
 			}
 		}
 	}
@@ -633,7 +612,7 @@ func fixFences(toks []Token) []Token {
 			} else {
 				temp.Value = nextval
 			}
-			temp.Kind |= tokFence | tokOpen
+			temp.Kind |= tokFence | tokOpen | tokLeftRight
 			temp.Kind &= ^(tokMiddle | tokClose)
 		case "middle":
 			i++
@@ -644,7 +623,7 @@ func fixFences(toks []Token) []Token {
 			} else {
 				temp.Value = nextval
 			}
-			temp.Kind |= tokFence | tokMiddle
+			temp.Kind |= tokFence | tokMiddle | tokLeftRight
 			temp.Kind &= ^(tokOpen | tokClose)
 		case "right":
 			i++
@@ -655,7 +634,7 @@ func fixFences(toks []Token) []Token {
 			} else {
 				temp.Value = nextval
 			}
-			temp.Kind |= tokFence | tokClose
+			temp.Kind |= tokFence | tokClose | tokLeftRight
 			temp.Kind &= ^(tokOpen | tokMiddle)
 		case "big", "Big", "bigg", "Bigg":
 			i++
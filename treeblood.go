@@ -2,16 +2,15 @@ package treeblood
 
 import (
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
 	"slices"
 	"strings"
+	"sync"
 )
 
-func init() {
-	logger = log.New(os.Stderr, "TreeBlood: ", log.LstdFlags)
-}
-
 // tex - the string of math to render. Do not include delimeters like \\(...\\) or $...$
 // macros - a map of user-defined commands (without leading backslash) to their expanded form as a normal TeX string.
 // block - set display="block" if true, display="inline" otherwise
@@ -30,26 +29,18 @@ func TexToMML(tex string, macros map[string]string, block, displaystyle bool) (r
 			if displaystyle {
 				ast.SetTrue("displaystyle")
 			}
-			fmt.Println(r)
-			fmt.Println(tex)
 			ast.Write(&builder, 0)
 			result = builder.String()
 			err = fmt.Errorf("TreeBlood encountered an unexpected error while processing\n%s\n", tex)
 		}
 	}()
-	pitz := NewPitziil()
-	pitz.currentExpr = []rune(strings.Clone(tex))
-	tokens, err := tokenize(pitz.currentExpr)
+	pitz := NewPitziil(macros).newRender(tex, block)
+	mrow, err := pitz.parse()
 	if err != nil {
 		return "", err
 	}
-	if macros != nil {
-		tokens, err = ExpandMacros(tokens, PrepareMacros(macros))
-		if err != nil {
-			return "", err
-		}
-	}
-	ast = wrapInMathTag(pitz.ParseTex(NewTokenBuffer(tokens), ctxRoot), tex)
+	pitz.resolveLabels(pitz.rc.pending)
+	ast = wrapInMathTag(mrow, tex)
 	if block {
 		ast.SetAttr("display", "block")
 	} else {
@@ -97,17 +88,39 @@ func InlineStyle(tex string, macros map[string]string) (string, error) {
 // Thus, Pitziil roughly translates to "ballcourt". In the context of TreeBlood, a Pitziil is a container for persistent
 // data to be used across parsing calls.
 // As a rule of thumb, create one new Pitziil for each unique document
+//
+// A Pitziil may be used by multiple goroutines at once, provided its settings are not changed and no macros or
+// extensions are added while rendering is in progress. Equations rendered concurrently are numbered in the order they
+// finish; use RenderParallel to number them in document order.
 type Pitziil struct {
-	macros               map[string]Macro // Global macros for the document
+	macros               map[string]Macro // Global macros for the document. Replaced, never modified, once compiled.
 	EQCount              int              // used for numbering display equations
 	DoNumbering          bool             // Whether or not to number equations in a document
 	PrintOneLine         bool
-	currentExpr          []rune          // the expression currently being evaluated
-	currentIsDisplay     bool            // true if the current expression is being rendered in displaystyle
-	cursor               int             // the index of the token currently being evaluated
-	needMacroExpansion   map[string]bool // used if any \newcommand definitions are encountered.
-	depth                int             // recursive parse depth
-	unknownCommandsAsOps bool            // treat unknown \commands as operators
+	SpeechLabels         bool                  // describe each equation in spoken English with alttext and aria-label
+	ContentMathML        bool                  // annotate each equation with Content MathML inferred from its structure
+	HTMLOutput           bool                  // write HTML styled by HTMLStylesheet instead of MathML
+	LogHandler           slog.Handler          // receives diagnostics as they are encountered. If nil, nothing is logged.
+	macroDiagnostics     []Diagnostic          // problems encountered while compiling the document macros
+	unknownCommandsAsOps bool                  // treat unknown \commands as operators
+	extensions           map[string]*extension // commands registered with RegisterExtension for this document
+	labels               map[string]string     // \label keys and the equation numbers assigned to them
+	unresolvedRefs       map[string]bool       // \ref keys that could not be resolved when rendered
+	mu                   *sync.Mutex           // guards macros, EQCount, labels, and unresolvedRefs while rendering
+	rc                   *renderContext        // state of the current render. Only set on the copy made by newRender.
+}
+
+// renderContext holds the state of a single call to DisplayStyle, TextStyle, etc. Each render works on a copy of the
+// Pitziil carrying its own renderContext, so that the document itself is never modified while parsing.
+type renderContext struct {
+	expr               []rune           // the expression currently being evaluated
+	display            bool             // true if the current expression is being rendered in displaystyle
+	macros             map[string]Macro // the document macros when rendering began
+	needMacroExpansion map[string]Macro // macros defined with \newcommand etc. during this render
+	eq                 equationTag      // \tag, \notag, and \label commands in the current expression
+	pending            []pendingLabel   // equation numbers and references to be filled in once parsing is finished
+	diagnostics        []Diagnostic     // problems encountered while rendering
+	diagnosticNodes    map[*MMLNode]int // nodes whose diagnostics have yet to be located; see locateDiagnostics
 }
 
 // NewDocument creates a Pitziil to be used for a single web page or other standalone document.
@@ -121,9 +134,12 @@ func NewDocument(macros map[string]string, doNumbering bool) *Pitziil {
 
 func NewPitziil(macros ...map[string]string) *Pitziil {
 	var out Pitziil
-	out.needMacroExpansion = make(map[string]bool)
+	out.extensions = make(map[string]*extension)
+	out.labels = make(map[string]string)
+	out.unresolvedRefs = make(map[string]bool)
+	out.mu = &sync.Mutex{}
 	if len(macros) > 0 && macros[0] != nil {
-		out.macros = PrepareMacros(macros[0])
+		out.macros, out.macroDiagnostics = prepareMacros(macros[0])
 	} else {
 		out.macros = make(map[string]Macro)
 	}
@@ -133,52 +149,127 @@ func NewPitziil(macros ...map[string]string) *Pitziil {
 // Compile and add macros to the Pitziil/document, overwriting any macros with the same name
 func (pitz *Pitziil) AddMacros(macros ...map[string]string) *Pitziil {
 	for _, m := range macros {
-		for name, macro := range PrepareMacros(m) {
-			pitz.macros[name] = macro
+		prepared, diagnostics := prepareMacros(m)
+		for _, d := range diagnostics {
+			pitz.log(d)
 		}
+		pitz.mu.Lock()
+		pitz.macroDiagnostics = append(pitz.macroDiagnostics, diagnostics...)
+		pitz.mu.Unlock()
+		pitz.commitMacros(prepared)
 	}
 	return pitz
 }
 
-func (pitz *Pitziil) render(tex string, displaystyle bool) (result string, err error) {
-	var ast *MMLNode
-	var builder strings.Builder
-	var indent int
-	if pitz.PrintOneLine {
-		indent = -1
+// DeclareMathOperators adds operator names to the document, as \DeclareMathOperator does. operators are key-value pairs
+// of a command (without a leading backslash) and the name of the operator it sets, such as "Tr": "Tr". If limits is
+// true, the operators take limits above and below in display style, as with \DeclareMathOperator*.
+func (pitz *Pitziil) DeclareMathOperators(operators map[string]string, limits bool) *Pitziil {
+	cmd := `\operatorname`
+	if limits {
+		cmd += "*"
+	}
+	macros := make(map[string]string, len(operators))
+	for name, op := range operators {
+		macros[name] = cmd + "{" + op + "}"
+	}
+	return pitz.AddMacros(macros)
+}
+
+// MacroDiagnostics returns any problems encountered while compiling the macros given to NewPitziil, NewDocument, or
+// AddMacros.
+func (pitz *Pitziil) MacroDiagnostics() []Diagnostic {
+	pitz.mu.Lock()
+	defer pitz.mu.Unlock()
+	return slices.Clone(pitz.macroDiagnostics)
+}
+
+// commitMacros adds macros to the document. The macro table is copied rather than modified so that renders already
+// in progress keep a consistent view of it.
+func (pitz *Pitziil) commitMacros(macros map[string]Macro) {
+	if len(macros) == 0 {
+		return
+	}
+	pitz.mu.Lock()
+	defer pitz.mu.Unlock()
+	updated := maps.Clone(pitz.macros)
+	if updated == nil {
+		updated = make(map[string]Macro, len(macros))
+	}
+	maps.Copy(updated, macros)
+	pitz.macros = updated
+}
+
+// newRender returns a copy of pitz with a fresh renderContext for the expression tex.
+func (pitz *Pitziil) newRender(tex string, displaystyle bool) *Pitziil {
+	pitz.mu.Lock()
+	r := *pitz
+	pitz.mu.Unlock()
+	r.rc = &renderContext{
+		expr:               []rune(strings.Clone(tex)),
+		display:            displaystyle,
+		macros:             r.macros,
+		needMacroExpansion: make(map[string]Macro),
+	}
+	return &r
+}
+
+// parse tokenizes the expression of the current render, expands any macros, and parses the result.
+func (pitz *Pitziil) parse() (*MMLNode, error) {
+	tokens, err := pitz.lex()
+	if err != nil {
+		return nil, err
+	}
+	return pitz.ParseTex(NewTokenBuffer(tokens), ctxRoot), nil
+}
+
+// lex tokenizes the expression being rendered and expands the document macros.
+func (pitz *Pitziil) lex() ([]Token, error) {
+	tokens, err := tokenize(pitz.rc.expr)
+	if err != nil {
+		pitz.diagnoseError(DiagSyntax, err)
+		return nil, err
 	}
+	if pitz.rc.macros != nil {
+		tokens, err = ExpandMacros(tokens, pitz.rc.macros)
+		if err != nil {
+			pitz.diagnoseError(DiagMacro, err)
+			return nil, err
+		}
+	}
+	return tokens, nil
+}
+
+// renderAST parses tex and wraps the result in a <math> tag. If tex cannot be tokenized, the returned node is nil.
+// Any macros defined in tex are added to the document, but the equation numbers and references in the returned tree
+// are left for the caller to resolve from the returned renderContext.
+func (pitz *Pitziil) renderAST(tex string, displaystyle bool) (ast *MMLNode, rc *renderContext, err error) {
+	r := pitz.newRender(tex, displaystyle)
+	rc = r.rc
 	defer func() {
-		if r := recover(); r != nil {
+		if rec := recover(); rec != nil {
 			ast = makeMMLError()
-			if displaystyle {
-				ast.SetAttr("display", "block")
-				ast.SetAttr("class", "math-displaystyle")
-				ast.SetAttr("displaystyle", "true")
-			} else {
-				ast.SetAttr("display", "inline")
-				ast.SetAttr("class", "math-textstyle")
-			}
-			fmt.Println(r)
-			fmt.Println(tex)
-			ast.Write(&builder, indent)
-			result = builder.String()
+			rc.pending = nil
+			r.diagnose(SeverityError, DiagInternal, Token{}, "%v", rec)
 			err = fmt.Errorf("TreeBlood encountered an unexpected error")
 		}
-		pitz.currentIsDisplay = false
+		if ast != nil {
+			setDisplay(ast, displaystyle)
+		}
 	}()
-	pitz.currentExpr = []rune(strings.Clone(tex))
-	tokens, err := tokenize(pitz.currentExpr)
+	mrow, err := r.parse()
 	if err != nil {
-		return "", err
-	}
-	if pitz.macros != nil {
-		tokens, err = ExpandMacros(tokens, pitz.macros)
-		if err != nil {
-			return "", err
-		}
+		return nil, rc, err
 	}
-	ast = pitz.wrapInMathTag(pitz.ParseTex(NewTokenBuffer(tokens), ctxRoot), tex)
+	ast = r.wrapInMathTag(mrow, tex)
 	ast.SetAttr("xmlns", "http://www.w3.org/1998/Math/MathML")
+	r.finishDiagnostics(ast)
+	pitz.commitMacros(rc.needMacroExpansion)
+	return ast, rc, nil
+}
+
+// setDisplay sets the attributes of the <math> element ast for a display or inline equation.
+func setDisplay(ast *MMLNode, displaystyle bool) {
 	if displaystyle {
 		ast.SetAttr("display", "block")
 		ast.SetAttr("class", "math-displaystyle")
@@ -187,23 +278,73 @@ func (pitz *Pitziil) render(tex string, displaystyle bool) (result string, err e
 		ast.SetAttr("display", "inline")
 		ast.SetAttr("class", "math-textstyle")
 	}
-	builder.WriteRune('\n')
-	ast.Write(&builder, indent)
-	builder.WriteRune('\n')
-	return builder.String(), err
+}
+
+func (pitz *Pitziil) render(tex string, displaystyle bool) (string, error) {
+	result, err := pitz.Render(tex, displaystyle)
+	return result.MathML, err
+}
+
+// RenderTo streams the MathML (or HTML, if HTMLOutput is set) for tex to w. The output is identical to that of
+// DisplayStyle (if display is true) or TextStyle, but is written through a pooled buffer rather than built up as a
+// string.
+func (pitz *Pitziil) RenderTo(w io.Writer, tex string, display bool) error {
+	var indent int
+	if pitz.PrintOneLine {
+		indent = -1
+	}
+	ast, rc, err := pitz.renderAST(tex, display)
+	if ast == nil {
+		return err
+	}
+	pitz.resolveLabels(rc.pending)
+	pitz.speakMath(ast)
+	pw := getPooledWriter(w)
+	defer putPooledWriter(pw)
+	pw.buf.WriteByte('\n')
+	if werr := pitz.writeMath(pw.buf, ast, indent); werr != nil {
+		err = werr
+	}
+	pw.buf.WriteByte('\n')
+	if ferr := pw.buf.Flush(); ferr != nil {
+		return ferr
+	}
+	return err
+}
+
+// writeMath writes the finished equation ast to w as MathML, or as HTML if HTMLOutput is set. As with a panic while
+// parsing, a panic while writing HTML is returned as an error, and an error is written in place of the equation.
+func (pitz *Pitziil) writeMath(w mmlWriter, ast *MMLNode, indent int) (err error) {
+	if pitz.HTMLOutput {
+		// the HTML is buffered so that nothing of a failed equation is written
+		var sb strings.Builder
+		defer func() {
+			if rec := recover(); rec != nil {
+				h := htmlWriter{w: w}
+				h.math(makeMMLError())
+				err = fmt.Errorf("TreeBlood encountered an unexpected error writing HTML: %v", rec)
+				return
+			}
+			w.WriteString(sb.String())
+		}()
+		h := htmlWriter{w: &sb}
+		h.math(ast)
+		return nil
+	}
+	ast.write(w, indent)
+	return nil
 }
 
 func (pitz *Pitziil) wrapInMathTag(mrow *MMLNode, tex string) *MMLNode {
 	node := NewMMLNode("math")
 	node.SetAttr("style", "font-feature-settings: 'dtls' off;")
 	semantics := node.AppendNew("semantics")
-	if pitz.DoNumbering && pitz.currentIsDisplay {
-		pitz.EQCount++
+	if tag, ok := pitz.nextEquationTag(); ok {
 		numberedEQ := NewMMLNode("mtable")
 		row := numberedEQ.AppendNew("mlabeledtr")
 		num := row.AppendNew("mtd")
 		eq := row.AppendNew("mtd")
-		num.AppendNew("mtext", fmt.Sprintf("(%d)", pitz.EQCount))
+		num.AppendChild(tag)
 		if mrow != nil && mrow.Tag != "mrow" {
 			root := NewMMLNode("mrow")
 			root.AppendChild(mrow)
@@ -226,6 +367,9 @@ func (pitz *Pitziil) wrapInMathTag(mrow *MMLNode, tex string) *MMLNode {
 			semantics.doPostProcess()
 		}
 	}
+	if pitz.ContentMathML {
+		semantics.AppendChild(contentAnnotation(mrow))
+	}
 	annotation := NewMMLNode("annotation", strings.ReplaceAll(tex, "<", "&lt;"))
 	annotation.SetAttr("encoding", "application/x-tex")
 	semantics.AppendChild(annotation)
@@ -234,7 +378,6 @@ func (pitz *Pitziil) wrapInMathTag(mrow *MMLNode, tex string) *MMLNode {
 
 // Create a display style equation from the tex string.
 func (pitz *Pitziil) DisplayStyle(tex string) (string, error) {
-	pitz.currentIsDisplay = true
 	return pitz.render(tex, true)
 }
 
@@ -243,38 +386,21 @@ func (pitz *Pitziil) TextStyle(tex string) (string, error) {
 	return pitz.render(tex, false)
 }
 
-// only produce the MathML that would be within the <semantics> tag. I.e. the root level <mrow>.
+// only produce the MathML that would be within the <semantics> tag. I.e. the root level <mrow>. HTMLOutput is ignored.
 func (pitz *Pitziil) SemanticsOnly(tex string) (string, error) {
-	pitz.currentExpr = []rune(strings.Clone(tex))
-	tokens, err := tokenize(pitz.currentExpr)
+	r := pitz.newRender(tex, false)
 	defer func() {
-		if r := recover(); r != nil {
-			//ast = makeMMLError()
-			//if block {
-			//	ast.SetAttr("display", "block")
-			//} else {
-			//	ast.SetAttr("display", "inline")
-			//}
-			//if displaystyle {
-			//	ast.SetTrue("displaystyle")
-			//}
-			//fmt.Println(r)
-			//fmt.Println(tex)
-			//ast.Write(&builder, 0)
-			//result = builder.String()
-			fmt.Printf("TreeBlood encountered an unexpected error while processing\n%s\n", tex)
+		if rec := recover(); rec != nil {
+			r.diagnose(SeverityError, DiagInternal, Token{}, "%v", rec)
 		}
 	}()
+	ast, err := r.parse()
 	if err != nil {
 		return "", err
 	}
-	if pitz.macros != nil {
-		tokens, err = ExpandMacros(tokens, pitz.macros)
-		if err != nil {
-			return "", err
-		}
-	}
-	ast := pitz.ParseTex(NewTokenBuffer(tokens), ctxRoot)
+	r.finishDiagnostics(ast)
+	pitz.commitMacros(r.rc.needMacroExpansion)
+	pitz.resolveLabels(r.rc.pending)
 	var builder strings.Builder
 	var indent int
 	if pitz.PrintOneLine {
@@ -284,6 +410,72 @@ func (pitz *Pitziil) SemanticsOnly(tex string) (string, error) {
 	return builder.String(), err
 }
 
+// parseStandalone parses tex for output other than MathML, such as Speech. Macros defined in tex are not added to the
+// document and equations are not numbered, but references are resolved from the labels defined so far.
+func (pitz *Pitziil) parseStandalone(tex string) (ast *MMLNode, err error) {
+	r := pitz.newRender(tex, false)
+	defer func() {
+		if rec := recover(); rec != nil {
+			ast = nil
+			err = fmt.Errorf("TreeBlood encountered an unexpected error")
+		}
+	}()
+	ast, err = r.parse()
+	if err != nil {
+		return nil, err
+	}
+	pitz.resolveStandalone(r.rc.pending)
+	return ast, nil
+}
+
+// resolveStandalone fills in the text of pending references from the labels defined so far, and of equation tags from
+// their \tag, without numbering equations or otherwise changing the document.
+func (pitz *Pitziil) resolveStandalone(pending []pendingLabel) {
+	pitz.mu.Lock()
+	defer pitz.mu.Unlock()
+	for _, p := range pending {
+		if p.ref == "" {
+			if p.eq.hasTag {
+				setTag(p.node, p.eq)
+			}
+			continue
+		}
+		value, ok := pitz.labels[p.ref]
+		if !ok {
+			value = "??"
+		}
+		if p.eqref {
+			value = "(" + value + ")"
+		}
+		p.node.Text = value
+	}
+}
+
+// AST parses tex into a tree rooted at a <math> element, holding the same elements as its MathML, for programs that
+// lay out or transform the MathML themselves, such as the svg package. As with Speech, macros defined in tex are not
+// added to the document and equations are not numbered, though a \tag is kept. References are resolved from the
+// labels defined so far.
+func (pitz *Pitziil) AST(tex string, display bool) (ast *MMLNode, err error) {
+	r := pitz.newRender(tex, display)
+	r.DoNumbering = false
+	defer func() {
+		if rec := recover(); rec != nil {
+			ast = nil
+			err = fmt.Errorf("TreeBlood encountered an unexpected error")
+		}
+	}()
+	mrow, err := r.parse()
+	if err != nil {
+		return nil, err
+	}
+	ast = r.wrapInMathTag(mrow, tex)
+	ast.SetAttr("xmlns", "http://www.w3.org/1998/Math/MathML")
+	setDisplay(ast, display)
+	pitz.resolveStandalone(r.rc.pending)
+	ast.prune()
+	return ast, nil
+}
+
 type directoryEntry struct {
 	input  string
 	result string
@@ -0,0 +1,407 @@
+package treeblood
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var superscriptRunes = map[rune]rune{
+	'0': '⁰', '1': '¹', '2': '²', '3': '³', '4': '⁴', '5': '⁵', '6': '⁶', '7': '⁷', '8': '⁸', '9': '⁹',
+	'+': '⁺', '-': '⁻', '−': '⁻', '=': '⁼', '(': '⁽', ')': '⁾',
+	'a': 'ᵃ', 'b': 'ᵇ', 'c': 'ᶜ', 'd': 'ᵈ', 'e': 'ᵉ', 'f': 'ᶠ', 'g': 'ᵍ', 'h': 'ʰ', 'i': 'ⁱ', 'j': 'ʲ', 'k': 'ᵏ',
+	'l': 'ˡ', 'm': 'ᵐ', 'n': 'ⁿ', 'o': 'ᵒ', 'p': 'ᵖ', 'r': 'ʳ', 's': 'ˢ', 't': 'ᵗ', 'u': 'ᵘ', 'v': 'ᵛ', 'w': 'ʷ',
+	'x': 'ˣ', 'y': 'ʸ', 'z': 'ᶻ',
+	'A': 'ᴬ', 'B': 'ᴮ', 'D': 'ᴰ', 'E': 'ᴱ', 'G': 'ᴳ', 'H': 'ᴴ', 'I': 'ᴵ', 'J': 'ᴶ', 'K': 'ᴷ', 'L': 'ᴸ', 'M': 'ᴹ',
+	'N': 'ᴺ', 'O': 'ᴼ', 'P': 'ᴾ', 'R': 'ᴿ', 'T': 'ᵀ', 'U': 'ᵁ', 'V': 'ⱽ', 'W': 'ᵂ',
+	'α': 'ᵅ', 'β': 'ᵝ', 'γ': 'ᵞ', 'δ': 'ᵟ', 'ε': 'ᵋ', 'θ': 'ᶿ', 'ι': 'ᶥ', 'φ': 'ᵠ', 'χ': 'ᵡ',
+	'′': '′', '″': '″', '‴': '‴', '∘': '°',
+}
+
+var subscriptRunes = map[rune]rune{
+	'0': '₀', '1': '₁', '2': '₂', '3': '₃', '4': '₄', '5': '₅', '6': '₆', '7': '₇', '8': '₈', '9': '₉',
+	'+': '₊', '-': '₋', '−': '₋', '=': '₌', '(': '₍', ')': '₎',
+	'a': 'ₐ', 'e': 'ₑ', 'h': 'ₕ', 'i': 'ᵢ', 'j': 'ⱼ', 'k': 'ₖ', 'l': 'ₗ', 'm': 'ₘ', 'n': 'ₙ', 'o': 'ₒ', 'p': 'ₚ',
+	'r': 'ᵣ', 's': 'ₛ', 't': 'ₜ', 'u': 'ᵤ', 'v': 'ᵥ', 'x': 'ₓ',
+	'β': 'ᵦ', 'γ': 'ᵧ', 'ρ': 'ᵨ', 'φ': 'ᵩ', 'χ': 'ᵪ',
+}
+
+// Combining characters for accents, keyed by the text of the <mo> in an accent <mover> or <munder>.
+var combiningAccents = map[string]string{
+	"^":      "\u0302",
+	"ˆ":      "\u0302",
+	"‾":      "\u0305",
+	"¯":      "\u0304",
+	"~":      "\u0303",
+	"˜":      "\u0303",
+	"˙":      "\u0307",
+	"¨":      "\u0308",
+	"ˇ":      "\u030c",
+	"˘":      "\u0306",
+	"´":      "\u0301",
+	"`":      "\u0300",
+	"→":      "\u20d7",
+	"\u20d7": "\u20d7",
+	"_":      "\u0332",
+	"˚":      "\u030a",
+	"←":      "\u20d6",
+	"\u0308": "\u0308",
+	"\u0311": "\u0311",
+	"\u0332": "\u0332",
+	"\u0360": "\u0303",
+	"\u20db": "\u20db",
+	"\u20dc": "\u20dc",
+}
+
+// textOperators is the set of <mo> texts that are written with a space on either side: the binary operators and
+// relations of the symbolTable, and a few that are typed directly.
+var textOperators = sync.OnceValue(func() map[string]bool {
+	ops := map[string]bool{"=": true, "+": true, "-": true, "−": true, "<": true, ">": true, "*": true}
+	for _, sym := range symbolTable {
+		if sym.kind&(sym_binaryop|sym_relation) > 0 && sym.char != "" {
+			ops[sym.char] = true
+		}
+	}
+	return ops
+})
+
+// UnicodeText renders tex as a single line of plain Unicode text, for use where MathML cannot be displayed. Scripts
+// are written with the Unicode superscript and subscript characters when possible, and fractions and roots are
+// linearized with parentheses, so that `x = \frac{-b \pm \sqrt{b^2-4ac}}{2a}` becomes
+// "x = (−b ± √(b² − 4ac))/(2a)". The rows of tables are separated by newlines, or by semicolons within a matrix. As
+// with Speech, macros defined in tex are not added to the document, and equations are not numbered.
+func (pitz *Pitziil) UnicodeText(tex string) (string, error) {
+	ast, err := pitz.parseStandalone(tex)
+	if err != nil {
+		return "", err
+	}
+	var t textWriter
+	t.node(ast)
+	return strings.TrimSpace(t.b.String()), nil
+}
+
+// A textWriter accumulates the plain text representation of a tree of MMLNodes.
+type textWriter struct {
+	b       bytes.Buffer
+	compact bool // omit the spaces around operators, as within scripts
+	operand bool // true after an operand, where + and − are binary operators rather than signs
+}
+
+func (t *textWriter) write(s string) {
+	t.b.WriteString(s)
+}
+
+// space writes a single space unless the output is empty or already ends with whitespace or an opening fence.
+func (t *textWriter) space() {
+	if t.compact {
+		return
+	}
+	switch t.lastRune() {
+	case utf8.RuneError, ' ', '\n', '(', '[', '{':
+		return
+	}
+	t.b.WriteRune(' ')
+}
+
+// lastRune returns the last rune written, or utf8.RuneError if nothing has been written.
+func (t *textWriter) lastRune() rune {
+	r, _ := utf8.DecodeLastRune(t.b.Bytes())
+	return r
+}
+
+// unspace removes a trailing space, as after a function name that turns out to have a subscript.
+func (t *textWriter) unspace() {
+	if t.lastRune() == ' ' {
+		t.b.Truncate(t.b.Len() - 1)
+	}
+}
+
+// sub renders n with a separate textWriter, as for a script or fraction.
+func (t *textWriter) sub(n *MMLNode, compact bool) string {
+	s := textWriter{compact: compact || t.compact}
+	s.node(n)
+	return strings.TrimSpace(s.b.String())
+}
+
+func (t *textWriter) node(n *MMLNode) {
+	if n == nil || n.Properties&propNonprint > 0 {
+		return
+	}
+	switch n.Tag {
+	case "annotation", "annotation-xml", "mphantom", "none", "mprescripts":
+	case "mspace":
+		if w := n.Attrib["width"]; w != "" && !strings.HasPrefix(w, "-") && w != "0" && w != "0em" {
+			t.space()
+		}
+		if n.Attrib["linebreak"] == "newline" {
+			t.write("\n")
+		}
+	case "mi":
+		text := nodeText(n)
+		if utf8.RuneCountInString(text) > 1 {
+			// function names such as sin are set apart from their arguments
+			if r := t.lastRune(); r != utf8.RuneError && r != '(' && r != ' ' {
+				t.space()
+			}
+			t.write(text)
+			t.space()
+		} else {
+			t.write(text)
+		}
+		t.operand = true
+	case "mn":
+		t.write(nodeText(n))
+		t.operand = true
+	case "mtext", "ms":
+		t.write(strings.ReplaceAll(nodeText(n), "\u00a0", " "))
+		t.operand = true
+	case "mo":
+		t.operator(n)
+	case "mfrac":
+		t.fraction(n)
+	case "msqrt":
+		t.write("√")
+		t.write(t.wrap(&MMLNode{Tag: "mrow", Children: n.Children}))
+		t.operand = true
+	case "mroot":
+		if len(n.Children) != 2 {
+			t.children(n.Children)
+			return
+		}
+		switch index := t.sub(n.Children[1], true); index {
+		case "2":
+			t.write("√")
+		case "3":
+			t.write("∛")
+		case "4":
+			t.write("∜")
+		default:
+			t.write(t.script(n.Children[1], superscriptRunes, "^"))
+			t.write("√")
+		}
+		t.write(t.wrap(n.Children[0]))
+		t.operand = true
+	case "msub", "msup", "msubsup", "munder", "mover", "munderover":
+		t.scripts(n)
+	case "mtable":
+		t.table(n, false)
+	default:
+		t.children(n.Children)
+	}
+}
+
+func (t *textWriter) operator(n *MMLNode) {
+	text := nodeText(n)
+	switch {
+	case text == "," || text == ";":
+		t.write(text)
+		if !t.compact {
+			t.write(" ")
+		}
+		t.operand = false
+	case (text == "−" || text == "-" || text == "+" || text == "±" || text == "∓") && !t.operand:
+		// a sign, as in -b
+		t.write(text)
+	case textOperators()[text] && n.Attrib["form"] != "prefix" && n.Attrib["form"] != "postfix":
+		t.space()
+		t.write(text)
+		t.space()
+		t.operand = false
+	default:
+		t.write(text)
+		// a closing fence or factorial ends an operand
+		t.operand = n.Attrib["form"] == "postfix" || speechPostfix[text]
+	}
+}
+
+func (t *textWriter) children(children []*MMLNode) {
+	nodes := trimNonprint(children)
+	if len(nodes) == 2 && nodes[0].Tag == "mo" && nodeText(nodes[0]) == "{" && nodes[1].Tag == "mtable" {
+		// cases
+		t.write("{")
+		t.table(nodes[1], true)
+		t.operand = true
+		return
+	}
+	if len(nodes) == 3 && nodes[0].Tag == "mo" && nodes[1].Tag == "mtable" && nodes[2].Tag == "mo" {
+		// matrices
+		t.write(nodeText(nodes[0]))
+		t.table(nodes[1], true)
+		t.write(nodeText(nodes[2]))
+		t.operand = true
+		return
+	}
+	for _, child := range children {
+		t.node(child)
+	}
+}
+
+// textAtomic reports whether the text of n can be written as the numerator or denominator of a fraction, or the
+// radicand of a root, without enclosing it in parentheses.
+func textAtomic(n *MMLNode) bool {
+	if leaf := speechLeaf(n); leaf != nil {
+		return leaf.Tag != "mo"
+	}
+	switch n.Tag {
+	case "msqrt", "mroot":
+		return true
+	case "msub", "msup", "msubsup":
+		return len(n.Children) > 0 && textAtomic(n.Children[0])
+	case "mrow", "mstyle":
+		nodes := trimNonprint(n.Children)
+		if len(nodes) == 1 {
+			return textAtomic(nodes[0])
+		}
+		// an expression already in parentheses
+		return len(nodes) > 2 && nodes[0].Tag == "mo" && nodes[len(nodes)-1].Tag == "mo" &&
+			nodes[0].Attrib["form"] == "prefix" && nodes[len(nodes)-1].Attrib["form"] == "postfix"
+	}
+	return false
+}
+
+// wrap returns the text of n, enclosed in parentheses unless it is atomic.
+func (t *textWriter) wrap(n *MMLNode) string {
+	s := t.sub(n, false)
+	if textAtomic(n) {
+		return s
+	}
+	return "(" + s + ")"
+}
+
+func (t *textWriter) fraction(n *MMLNode) {
+	if len(n.Children) != 2 {
+		t.children(n.Children)
+		return
+	}
+	num, den := t.wrap(n.Children[0]), t.wrap(n.Children[1])
+	if n.Attrib["linethickness"] == "0" {
+		// binomial coefficients and the like, written as in UnicodeMath
+		t.write(num + "¦" + den)
+	} else {
+		t.write(num + "/" + den)
+	}
+	t.operand = true
+}
+
+// script returns the text of n written with the given script characters if they can all be converted, or else
+// preceded by marker, e.g. "ⁿ⁺¹" or "^(n+1/2)".
+func (t *textWriter) script(n *MMLNode, runes map[rune]rune, marker string) string {
+	s := t.sub(n, true)
+	var converted strings.Builder
+	for _, r := range s {
+		c, ok := runes[r]
+		if !ok {
+			if utf8.RuneCountInString(s) > 1 && !textAtomic(n) {
+				s = "(" + s + ")"
+			}
+			return marker + s
+		}
+		converted.WriteRune(c)
+	}
+	return converted.String()
+}
+
+func (t *textWriter) scripts(n *MMLNode) {
+	var sub, sup *MMLNode
+	children := n.Children
+	if len(children) == 0 {
+		return
+	}
+	base := children[0]
+	switch {
+	case (n.Tag == "msub" || n.Tag == "munder") && len(children) == 2:
+		sub = children[1]
+	case (n.Tag == "msup" || n.Tag == "mover") && len(children) == 2:
+		sup = children[1]
+	case len(children) == 3:
+		sub, sup = children[1], children[2]
+	default:
+		t.children(children)
+		return
+	}
+	// accents
+	if n.Tag == "mover" || n.Tag == "munder" {
+		accent := sup
+		if n.Tag == "munder" {
+			accent = sub
+		}
+		if leaf := speechLeaf(accent); leaf != nil && leaf.Tag == "mo" {
+			text := t.sub(base, false)
+			mark, ok := combiningAccents[nodeText(leaf)]
+			switch {
+			case ok && utf8.RuneCountInString(text) == 1:
+				t.write(text + mark)
+			case ok && (mark == "\u0305" || mark == "\u0332"):
+				// overlines and underlines extend across the whole base
+				for _, r := range text {
+					t.write(string(r) + mark)
+				}
+			default:
+				// braces and other decorations without a textual equivalent
+				t.write(text)
+			}
+			t.operand = true
+			return
+		}
+	}
+	switch {
+	case textAtomic(base), base.Tag == "mo", base.Tag == "munder", base.Tag == "mover", base.Tag == "munderover":
+		t.node(base)
+	default:
+		t.write("(" + t.sub(base, false) + ")")
+	}
+	t.unspace()
+	if sub != nil {
+		t.write(t.script(sub, subscriptRunes, "_"))
+	}
+	if sup != nil {
+		t.write(t.script(sup, superscriptRunes, "^"))
+	}
+	t.operand = true
+	if leaf := speechLeaf(base); leaf != nil && leaf.Tag == "mo" && leaf.Attrib["largeop"] == "true" {
+		// sums and integrals are followed by their summands
+		t.space()
+		t.operand = false
+	} else if leaf != nil && leaf.Tag == "mi" && utf8.RuneCountInString(nodeText(leaf)) > 1 {
+		// as are limits and the like
+		t.space()
+		t.operand = false
+	}
+}
+
+// table writes the rows of an <mtable>. Within fences, as in a matrix, the cells of a row are separated by commas and
+// the rows by semicolons. Otherwise, each row is written on its own line, followed by its equation number, if any.
+func (t *textWriter) table(n *MMLNode, inline bool) {
+	first := true
+	for _, row := range n.Children {
+		if row == nil || (row.Tag != "mtr" && row.Tag != "mlabeledtr") {
+			continue
+		}
+		cells := row.Children
+		var label string
+		if row.Tag == "mlabeledtr" && len(cells) > 0 {
+			label = strings.TrimSpace(t.sub(cells[0], false))
+			cells = cells[1:]
+		}
+		if !first {
+			if inline {
+				t.write("; ")
+			} else {
+				t.write("\n")
+			}
+		}
+		first = false
+		t.operand = false
+		for j, cell := range cells {
+			if j > 0 && inline {
+				t.write(", ")
+				t.operand = false
+			}
+			t.node(cell)
+		}
+		if label != "" {
+			t.write("    " + label)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package treeblood
 func (n *MMLNode) transformByVariant(variant string) {
 	rules, ok := transforms[variant]
 	if !ok {
-		logger.Println("Unknown variant transform:", variant)
 		return
 	}
 	chars := []rune(n.Text)
@@ -25,35 +24,45 @@ func (n *MMLNode) transformByVariant(variant string) {
 	n.Text = string(chars)
 }
 
-func (n *MMLNode) set_variants_from_context(context parseContext) {
-	var variant string
+// mathvariantFromContext returns the value of the MathML mathvariant attribute that corresponds to the font variant
+// bits of context, or the empty string if no variant is set.
+func mathvariantFromContext(context parseContext) string {
 	switch isolateMathVariant(context) {
 	case ctxVarNormal:
-		n.Attrib["mathvariant"] = "normal"
-		return
+		return "normal"
 	case ctxVarBb:
-		variant = "double-struck"
+		return "double-struck"
 	case ctxVarBold:
-		variant = "bold"
+		return "bold"
 	case ctxVarBold | ctxVarItalic:
-		variant = "bold-italic"
+		return "bold-italic"
 	case ctxVarScriptChancery, ctxVarScriptRoundhand:
-		variant = "script"
+		return "script"
 	case ctxVarFrak:
-		variant = "fraktur"
+		return "fraktur"
 	case ctxVarItalic:
-		variant = "italic"
+		return "italic"
 	case ctxVarSans:
-		variant = "sans-serif"
+		return "sans-serif"
 	case ctxVarSans | ctxVarBold:
-		variant = "bold-sans-serif"
+		return "bold-sans-serif"
 	case ctxVarSans | ctxVarBold | ctxVarItalic:
-		variant = "sans-serif-bold-italic"
+		return "sans-serif-bold-italic"
 	case ctxVarSans | ctxVarItalic:
-		variant = "sans-serif-italic"
+		return "sans-serif-italic"
 	case ctxVarMono:
-		variant = "monospace"
-	case 0:
+		return "monospace"
+	}
+	return ""
+}
+
+func (n *MMLNode) set_variants_from_context(context parseContext) {
+	variant := mathvariantFromContext(context)
+	switch variant {
+	case "normal":
+		n.Attrib["mathvariant"] = "normal"
+		return
+	case "":
 		return
 	}
 	n.transformByVariant(variant)